@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ResultCache хранит итоговый результат MultiHash по входному значению
+type ResultCache interface {
+	Get(key string) (string, bool)
+	Set(key, value string, ttl time.Duration)
+}
+
+type CacheStats struct {
+	Hits   uint32
+	Misses uint32
+}
+
+type cacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+func (e *cacheEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		items:    make(map[string]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (lc *LRUCache) Get(key string) (string, bool) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	el, ok := lc.items[key]
+	if !ok {
+		return "", false
+	}
+	entry := el.Value.(*cacheEntry)
+	if entry.expired(time.Now()) {
+		lc.order.Remove(el)
+		delete(lc.items, key)
+		return "", false
+	}
+	lc.order.MoveToFront(el)
+	return entry.value, true
+}
+
+func (lc *LRUCache) Set(key, value string, ttl time.Duration) {
+	lc.mu.Lock()
+	defer lc.mu.Unlock()
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	if el, ok := lc.items[key]; ok {
+		el.Value = &cacheEntry{key: key, value: value, expires: expires}
+		lc.order.MoveToFront(el)
+		return
+	}
+	lc.items[key] = lc.order.PushFront(&cacheEntry{key: key, value: value, expires: expires})
+	if lc.capacity > 0 && lc.order.Len() > lc.capacity {
+		oldest := lc.order.Back()
+		lc.order.Remove(oldest)
+		delete(lc.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+type fileCacheRecord struct {
+	Key     string `json:"key"`
+	Value   string `json:"value"`
+	Expires int64  `json:"expires,omitempty"`
+}
+
+// FileCache держит записи в памяти и дописывает каждую новую строкой jsonl,
+// так что кеш переживает перезапуски. Последняя запись по ключу выигрывает
+type FileCache struct {
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]*cacheEntry
+}
+
+func NewFileCache(path string) (*FileCache, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	fc := &FileCache{file: file, entries: make(map[string]*cacheEntry)}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec fileCacheRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		entry := &cacheEntry{key: rec.Key, value: rec.Value}
+		if rec.Expires != 0 {
+			entry.expires = time.Unix(0, rec.Expires)
+		}
+		fc.entries[rec.Key] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return fc, nil
+}
+
+func (fc *FileCache) Get(key string) (string, bool) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	entry, ok := fc.entries[key]
+	if !ok || entry.expired(time.Now()) {
+		return "", false
+	}
+	return entry.value, true
+}
+
+func (fc *FileCache) Set(key, value string, ttl time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	entry := &cacheEntry{key: key, value: value}
+	rec := fileCacheRecord{Key: key, Value: value}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+		rec.Expires = entry.expires.UnixNano()
+	}
+	fc.entries[key] = entry
+	if line, err := json.Marshal(rec); err == nil {
+		fc.file.Write(append(line, '\n'))
+	}
+}
+
+func (fc *FileCache) Close() error {
+	return fc.file.Close()
+}
+
+// CachedSigner заменяет в конвейере связку SingleHash+MultiHash:
+// если результат для входного значения уже есть в кеше - он сразу уходит дальше,
+// иначе считается тем же кодом, что и в SingleHash и MultiHash, и сохраняется
+type CachedSigner struct {
+	Cache ResultCache
+	TTL   time.Duration
+	Stats CacheStats
+	// Primary и Secondary - как у NewSingleHashJob, по умолчанию crc32 и md5
+	Primary   Hasher
+	Secondary Hasher
+}
+
+func NewCachedSigner(cache ResultCache, ttl time.Duration) *CachedSigner {
+	return &CachedSigner{Cache: cache, TTL: ttl}
+}
+
+func (cs *CachedSigner) Job(in, out chan interface{}) {
+	var primary, secondary Hasher = CRC32Hasher{}, MD5Hasher{}
+	if cs.Primary != nil {
+		primary = cs.Primary
+	}
+	if cs.Secondary != nil {
+		secondary = cs.Secondary
+	}
+	md5Gate := newSerialHasher(secondary, false)
+	var wg sync.WaitGroup
+	for v := range in {
+		data := fmt.Sprint(v)
+		if cs.Cache != nil {
+			if result, ok := cs.Cache.Get(data); ok {
+				atomic.AddUint32(&cs.Stats.Hits, 1)
+				out <- result
+				continue
+			}
+			atomic.AddUint32(&cs.Stats.Misses, 1)
+		}
+
+		wg.Add(1)
+		go func(data string) {
+			defer wg.Done()
+			single, _ := singleHashOf(context.Background(), primary, md5Gate, data)
+			result := multiHashOf(context.Background(), multiHashThreads, primary, single)
+			if cs.Cache != nil {
+				cs.Cache.Set(data, result, cs.TTL)
+			}
+			out <- result
+		}(data)
+	}
+	wg.Wait()
+}
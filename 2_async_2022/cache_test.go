@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"fmt"
+	"hash/crc32"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+const signerExpected = "1173136728138862632818075107442090076184424490584241521304_1696913515191343735512658979631549563179965036907783101867_27225454331033649287118297354036464389062965355426795162684_29568666068035183841425683795340791879727309630931025356555_3994492081516972096677631278379039212655368881548151736_4958044192186797981418233587017209679042592862002427381542_4958044192186797981418233587017209679042592862002427381542"
+
+// withFastSigners подменяет функции расчета на такие же, но без задержек,
+// и считает вызовы crc32
+func withFastSigners(t *testing.T) *uint32 {
+	t.Helper()
+	var crc32Calls uint32
+	origMd5, origCrc32 := DataSignerMd5, DataSignerCrc32
+	DataSignerMd5 = func(data string) string {
+		return fmt.Sprintf("%x", md5.Sum([]byte(data+DataSignerSalt)))
+	}
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(&crc32Calls, 1)
+		return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data+DataSignerSalt))), 10)
+	}
+	t.Cleanup(func() {
+		DataSignerMd5, DataSignerCrc32 = origMd5, origCrc32
+	})
+	return &crc32Calls
+}
+
+func runCachedSigner(cs *CachedSigner) string {
+	var result string
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			for _, v := range []int{0, 1, 1, 2, 3, 5, 8} {
+				out <- v
+			}
+		}),
+		JobFromFunc(cs.Job),
+		JobFromFunc(CombineResults),
+		JobFromFunc(func(in, out chan interface{}) {
+			result = (<-in).(string)
+		}),
+	)
+	return result
+}
+
+func TestCachedSigner(t *testing.T) {
+	crc32Calls := withFastSigners(t)
+
+	fileCache, err := NewFileCache(filepath.Join(t.TempDir(), "cache.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fileCache.Close()
+
+	caches := []struct {
+		name  string
+		cache ResultCache
+	}{
+		{"disabled", nil},
+		{"lru", NewLRUCache(100)},
+		{"file", fileCache},
+	}
+	for _, tc := range caches {
+		t.Run(tc.name, func(t *testing.T) {
+			cs := NewCachedSigner(tc.cache, 0)
+
+			atomic.StoreUint32(crc32Calls, 0)
+			if got := runCachedSigner(cs); got != signerExpected {
+				t.Errorf("cold run results not match\nGot: %v\nExpected: %v", got, signerExpected)
+			}
+			if n := atomic.LoadUint32(crc32Calls); n != 7*8 {
+				t.Errorf("cold run: expected %d crc32 calls, got %d", 7*8, n)
+			}
+
+			atomic.StoreUint32(crc32Calls, 0)
+			if got := runCachedSigner(cs); got != signerExpected {
+				t.Errorf("warm run results not match\nGot: %v\nExpected: %v", got, signerExpected)
+			}
+			if tc.cache == nil {
+				return
+			}
+			if n := atomic.LoadUint32(crc32Calls); n != 0 {
+				t.Errorf("warm run: expected no crc32 calls, got %d", n)
+			}
+			if cs.Stats.Hits != 7 || cs.Stats.Misses != 7 {
+				t.Errorf("unexpected cache stats %+v", cs.Stats)
+			}
+		})
+	}
+
+	reopened, err := NewFileCache(fileCache.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if _, ok := reopened.Get("8"); !ok {
+		t.Error("file cache lost entries after reopen")
+	}
+}
+
+func TestCachedSignerHashers(t *testing.T) {
+	run := func(jobs ...job) []string {
+		var got []string
+		jobs = append([]job{JobFromFunc(func(in, out chan interface{}) {
+			out <- 1
+		})}, jobs...)
+		ExecutePipeline(context.Background(), append(jobs, JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v.(string))
+			}
+		}))...)
+		return got
+	}
+	multiHash, err := NewMultiHashJobWithHasher(multiHashThreads, MockHasher("p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := run(NewSingleHashJob(MockHasher("p"), MockHasher("s")), multiHash)
+	cs := &CachedSigner{Cache: NewLRUCache(10), Primary: MockHasher("p"), Secondary: MockHasher("s")}
+	if got := run(JobFromFunc(cs.Job)); len(got) != 1 || got[0] != expected[0] {
+		t.Errorf("expected the same result as the stages %v, got %v", expected, got)
+	}
+}
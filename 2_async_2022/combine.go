@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// CombineEncoding - как записывать отдельные результаты в итоговую строку
+type CombineEncoding string
+
+const (
+	// CombineRaw - результаты как есть, через Separator
+	CombineRaw CombineEncoding = "none"
+	// CombineBase64 - каждый результат в base64, разделитель в нем не встретится
+	CombineBase64 CombineEncoding = "base64"
+	// CombineJSON - отсортированные результаты одним json массивом, Separator не нужен
+	CombineJSON CombineEncoding = "json"
+)
+
+type CombineOpts struct {
+	Separator       string
+	Encoding        CombineEncoding
+	TrailingNewline bool
+}
+
+// DefaultCombineOpts - поведение CombineResults из задания
+var DefaultCombineOpts = CombineOpts{Separator: "_", Encoding: CombineRaw}
+
+// NewCombineResults собирает все результаты, сортирует их по исходным
+// значениям и отдает одной строкой в формате opts. При отмене ctx ничего
+// не отдает: результат по части входа никому не нужен. Ошибка - opts с
+// неизвестной Encoding, она проверяется здесь, а не на данных
+func NewCombineResults(opts CombineOpts) (job, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	return func(ctx context.Context, in, out chan interface{}) {
+		var sl []string
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				break
+			}
+			sl = append(sl, v.(string))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		sort.Strings(sl)
+		result := opts.encode(sl)
+		fmt.Println("CombineResults", result)
+		send(ctx, out, result)
+	}, nil
+}
+
+func (opts CombineOpts) validate() error {
+	switch opts.Encoding {
+	case CombineRaw, "", CombineBase64, CombineJSON:
+		return nil
+	default:
+		return fmt.Errorf("unknown combine encoding %q", opts.Encoding)
+	}
+}
+
+// encode - итоговая строка, opts уже прошли validate
+func (opts CombineOpts) encode(items []string) string {
+	var result string
+	switch opts.Encoding {
+	case CombineBase64:
+		encoded := make([]string, len(items))
+		for i, item := range items {
+			encoded[i] = base64.StdEncoding.EncodeToString([]byte(item))
+		}
+		result = strings.Join(encoded, opts.Separator)
+	case CombineJSON:
+		if items == nil {
+			items = []string{}
+		}
+		// []string в json всегда кодируется
+		data, _ := json.Marshal(items)
+		result = string(data)
+	default:
+		result = strings.Join(items, opts.Separator)
+	}
+	if opts.TrailingNewline {
+		result += "\n"
+	}
+	return result
+}
+
+// StreamingCombineResults - CombineResults для больших входов: держит в памяти
+// не больше batchSize результатов и, набрав столько, отдает их отсортированными
+// одной строкой через DefaultCombineOpts. Остаток отдается, когда вход закрыт.
+// Порядок только внутри батча: батчи идут в порядке прихода и друг с другом не
+// сравниваются, так что полный порядок, как у CombineResults, будет, только
+// если весь вход влез в один батч. batchSize < 1 считается за 1
+func StreamingCombineResults(batchSize int) job {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return func(ctx context.Context, in, out chan interface{}) {
+		batch := make([]string, 0, batchSize)
+		flush := func() bool {
+			sort.Strings(batch)
+			ok := send(ctx, out, DefaultCombineOpts.encode(batch))
+			batch = batch[:0]
+			return ok
+		}
+		for {
+			v, ok := recv(ctx, in)
+			if !ok {
+				break
+			}
+			batch = append(batch, v.(string))
+			if len(batch) == batchSize && !flush() {
+				return
+			}
+		}
+		if len(batch) > 0 && ctx.Err() == nil {
+			flush()
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCombineResultsModes(t *testing.T) {
+	withFastSigners(t)
+
+	cases := []struct {
+		name     string
+		opts     CombineOpts
+		expected string
+	}{
+		{"default", DefaultCombineOpts, signerExpected},
+		{"separator", CombineOpts{Separator: "|", TrailingNewline: true}, strings.ReplaceAll(signerExpected, "_", "|") + "\n"},
+		{"base64", CombineOpts{Separator: ",", Encoding: CombineBase64},
+			"MTE3MzEzNjcyODEzODg2MjYzMjgxODA3NTEwNzQ0MjA5MDA3NjE4NDQyNDQ5MDU4NDI0MTUyMTMwNA==," +
+				"MTY5NjkxMzUxNTE5MTM0MzczNTUxMjY1ODk3OTYzMTU0OTU2MzE3OTk2NTAzNjkwNzc4MzEwMTg2Nw==," +
+				"MjcyMjU0NTQzMzEwMzM2NDkyODcxMTgyOTczNTQwMzY0NjQzODkwNjI5NjUzNTU0MjY3OTUxNjI2ODQ=," +
+				"Mjk1Njg2NjYwNjgwMzUxODM4NDE0MjU2ODM3OTUzNDA3OTE4Nzk3MjczMDk2MzA5MzEwMjUzNTY1NTU=," +
+				"Mzk5NDQ5MjA4MTUxNjk3MjA5NjY3NzYzMTI3ODM3OTAzOTIxMjY1NTM2ODg4MTU0ODE1MTczNg==," +
+				"NDk1ODA0NDE5MjE4Njc5Nzk4MTQxODIzMzU4NzAxNzIwOTY3OTA0MjU5Mjg2MjAwMjQyNzM4MTU0Mg==," +
+				"NDk1ODA0NDE5MjE4Njc5Nzk4MTQxODIzMzU4NzAxNzIwOTY3OTA0MjU5Mjg2MjAwMjQyNzM4MTU0Mg=="},
+		{"json", CombineOpts{Separator: "ignored", Encoding: CombineJSON, TrailingNewline: true},
+			`["1173136728138862632818075107442090076184424490584241521304",` +
+				`"1696913515191343735512658979631549563179965036907783101867",` +
+				`"27225454331033649287118297354036464389062965355426795162684",` +
+				`"29568666068035183841425683795340791879727309630931025356555",` +
+				`"3994492081516972096677631278379039212655368881548151736",` +
+				`"4958044192186797981418233587017209679042592862002427381542",` +
+				`"4958044192186797981418233587017209679042592862002427381542"]` + "\n"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			combine, err := NewCombineResults(tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var result interface{}
+			ExecutePipeline(context.Background(),
+				JobFromFunc(func(in, out chan interface{}) {
+					for _, v := range []int{0, 1, 1, 2, 3, 5, 8} {
+						out <- v
+					}
+				}),
+				JobFromFunc(NewCachedSigner(nil, 0).Job),
+				combine,
+				JobFromFunc(func(in, out chan interface{}) {
+					result = <-in
+				}),
+			)
+			if result != tc.expected {
+				t.Errorf("results not match\nGot: %v\nExpected: %v", result, tc.expected)
+			}
+		})
+	}
+
+	combineJSON, err := NewCombineResults(CombineOpts{Encoding: CombineJSON})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result interface{}
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {}),
+		combineJSON,
+		JobFromFunc(func(in, out chan interface{}) {
+			result = <-in
+		}),
+	)
+	if result != "[]" {
+		t.Errorf("expected an empty json array, got %v", result)
+	}
+	if _, err := NewCombineResults(CombineOpts{Encoding: "xml"}); err == nil {
+		t.Error("expected an error for an unknown encoding")
+	}
+}
+
+func TestStreamingCombineResults(t *testing.T) {
+	run := func(batchSize int, items ...string) []string {
+		var got []string
+		ExecutePipeline(context.Background(),
+			JobFromFunc(func(in, out chan interface{}) {
+				for _, item := range items {
+					out <- item
+				}
+			}),
+			StreamingCombineResults(batchSize),
+			JobFromFunc(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v.(string))
+				}
+			}),
+		)
+		return got
+	}
+
+	items := strings.Split(signerExpected, "_")
+	reversed := make([]string, len(items))
+	for i, item := range items {
+		reversed[len(items)-1-i] = item
+	}
+	// весь вход в одном батче - то же, что CombineResults
+	if got := run(100, reversed...); len(got) != 1 || got[0] != signerExpected {
+		t.Errorf("expected %q, got %q", signerExpected, got)
+	}
+	expected := []string{"b_c_d", "a_e_f", "g"}
+	if got := run(3, "d", "c", "b", "f", "e", "a", "g"); strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected sorted batches %v, got %v", expected, got)
+	}
+	if got := run(3); len(got) != 0 {
+		t.Errorf("expected nothing for empty input, got %v", got)
+	}
+}
+
+// BenchmarkStreamingCombineResults - живая куча после GC не растет с размером входа
+func BenchmarkStreamingCombineResults(b *testing.B) {
+	for _, items := range []int{100000, 1000000} {
+		b.Run(strconv.Itoa(items), func(b *testing.B) {
+			b.ReportAllocs()
+			var peak uint64
+			for i := 0; i < b.N; i++ {
+				runtime.GC()
+				ExecutePipeline(context.Background(),
+					JobFromFunc(func(in, out chan interface{}) {
+						for j := 0; j < items; j++ {
+							out <- strconv.Itoa(items - j)
+						}
+					}),
+					StreamingCombineResults(1000),
+					JobFromFunc(func(in, out chan interface{}) {
+						var ms runtime.MemStats
+						for n := 0; ; n++ {
+							if _, ok := <-in; !ok {
+								break
+							}
+							// батчей по 1000 выходит items/1000, смотрим 10 раз за прогон
+							if n%(items/1000/10) == 0 {
+								runtime.GC()
+								runtime.ReadMemStats(&ms)
+								if ms.HeapAlloc > peak {
+									peak = ms.HeapAlloc
+								}
+							}
+						}
+					}),
+				)
+			}
+			b.ReportMetric(float64(peak)/(1<<20), "peak-live-heap-MiB")
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"hash/crc32"
@@ -9,7 +10,7 @@ import (
 	"time"
 )
 
-type job func(in, out chan interface{})
+type job func(ctx context.Context, in, out chan interface{})
 
 const (
 	MaxInputDataLen = 100
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrJob - job, который может сломаться. Ошибка останавливает весь конвейер
+type ErrJob func(ctx context.Context, in, out chan interface{}) error
+
+// PipelineError - первая ошибка конвейера, Stage - номер job'а с нуля
+type PipelineError struct {
+	Stage int
+	Err   error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("stage %d: %v", e.Stage, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// ErrJobFromJob - адаптер для job'ов, которые не возвращают ошибок
+func ErrJobFromJob(j job) ErrJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		j(ctx, in, out)
+		return nil
+	}
+}
+
+// ExecutePipelineErr - ExecutePipeline, который, как errgroup, на первой ошибке
+// job'а отменяет ctx остальных, закрывая их входы, и сразу возвращает
+// *PipelineError, не дожидаясь их выхода. Ошибки, случившиеся позже, теряются.
+// Без ошибок ждет все job'ы и возвращает ctx.Err()
+func ExecutePipelineErr(parent context.Context, stages ...ErrJob) error {
+	ctx, cancel := context.WithCancel(parent)
+	errs, done := startPipeline(ctx, PipelineOptions{}, stages, nil)
+	select {
+	case err := <-errs:
+		cancel()
+		return err
+	case <-done:
+		cancel()
+	case <-parent.Done():
+		// зависшие job'ы не ждем, см. ExecutePipeline
+		cancel()
+		return parent.Err()
+	}
+	// job мог упасть последним, тогда done и ошибка готовы одновременно
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return parent.Err()
+	}
+}
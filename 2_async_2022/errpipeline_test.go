@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExecutePipelineErr(t *testing.T) {
+	errBroken := errors.New("broken input")
+	var collected uint32
+	var slowDone int32
+
+	start := time.Now()
+	err := ExecutePipelineErr(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for i := 0; ; i++ {
+				select {
+				case out <- i:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for v := range in {
+				if v.(int) == 10 {
+					return errBroken
+				}
+				out <- v
+			}
+			return nil
+		},
+		// медленный job после упавшего не держит возврат
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+				atomic.AddUint32(&collected, 1)
+			}
+			time.Sleep(200 * time.Millisecond)
+			atomic.StoreInt32(&slowDone, 1)
+		})),
+	)
+
+	var pErr *PipelineError
+	if !errors.As(err, &pErr) || pErr.Stage != 1 || !errors.Is(err, errBroken) {
+		t.Fatalf("expected PipelineError from stage 1, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("must return without waiting for other stages, took %s", elapsed)
+	}
+	if atomic.LoadInt32(&slowDone) != 0 {
+		t.Errorf("returned after the slow stage finished")
+	}
+	time.Sleep(300 * time.Millisecond)
+	// значения, застрявшие между job'ами при отмене, выбрасываются
+	if n := atomic.LoadUint32(&collected); n > 10 {
+		t.Errorf("expected at most 10 values before the failure, got %d", n)
+	}
+	if atomic.LoadInt32(&slowDone) != 1 {
+		t.Errorf("downstream stage was not stopped by closing its input")
+	}
+
+	// без ошибок - как ExecutePipeline
+	err = ExecutePipelineErr(context.Background(),
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) { out <- 1 })),
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+			}
+		})),
+	)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"runtime"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -22,18 +24,18 @@ func TestByIlia(t *testing.T) {
 
 	var recieved uint32
 	freeFlowJobs := []job{
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			out <- uint32(1)
 			out <- uint32(3)
 			out <- uint32(4)
 		}),
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			for val := range in {
 				out <- val.(uint32) * 3
 				time.Sleep(time.Millisecond * 100)
 			}
 		}),
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			for val := range in {
 				fmt.Println("collected", val)
 				atomic.AddUint32(&recieved, val.(uint32))
@@ -43,7 +45,7 @@ func TestByIlia(t *testing.T) {
 
 	start := time.Now()
 
-	ExecutePipeline(freeFlowJobs...)
+	ExecutePipeline(context.Background(), freeFlowJobs...)
 
 	end := time.Since(start)
 
@@ -57,3 +59,266 @@ func TestByIlia(t *testing.T) {
 		t.Errorf("f3 have not collected inputs, recieved = %d", recieved)
 	}
 }
+
+func TestExecutePipelineCancel(t *testing.T) {
+	var produced, collected uint32
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := ExecutePipeline(ctx,
+		// бесконечный источник сам смотрит на ctx
+		job(func(ctx context.Context, in, out chan interface{}) {
+			for i := 0; ; i++ {
+				select {
+				case out <- i:
+					atomic.AddUint32(&produced, 1)
+				case <-ctx.Done():
+					return
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}),
+		// старые job'ы без ctx завершаются, когда им закрывают вход
+		JobFromFunc(func(in, out chan interface{}) {
+			for val := range in {
+				out <- val.(int) * 2
+			}
+		}),
+		JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+				atomic.AddUint32(&collected, 1)
+			}
+		}),
+	)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("pipeline did not stop after cancel, took %s", elapsed)
+	}
+	// job'ы могут еще дорабатывать, ExecutePipeline их после отмены не ждет
+	if collected, produced := atomic.LoadUint32(&collected), atomic.LoadUint32(&produced); collected == 0 || collected > produced {
+		t.Errorf("unexpected counts: produced %d, collected %d", produced, collected)
+	}
+
+	if err := ExecutePipeline(context.Background(), JobFromFunc(func(in, out chan interface{}) {})); err != nil {
+		t.Errorf("expected nil for a finished pipeline, got %v", err)
+	}
+}
+
+// hungHasher не отвечает, пока не закроют block
+type hungHasher chan struct{}
+
+func (h hungHasher) Hash(data string) string {
+	<-h
+	return data
+}
+
+func TestExecutePipelineStuckStage(t *testing.T) {
+	before := runtime.NumGoroutine()
+	block := make(chan struct{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var results uint32
+	start := time.Now()
+	err := ExecutePipeline(ctx,
+		func(ctx context.Context, in, out chan interface{}) {
+			for i := 0; send(ctx, out, i); i++ {
+			}
+		},
+		// md5 висит, SingleHash все равно выходит по ctx
+		NewSingleHashJob(MockHasher("p"), hungHasher(block)),
+		// застрявший job: не смотрит ни на ctx, ни на вход и сам не вернется
+		func(ctx context.Context, in, out chan interface{}) {
+			<-block
+		},
+		MultiHash,
+		combineResults,
+		JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+				atomic.AddUint32(&results, 1)
+			}
+		}),
+	)
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("pipeline did not stop after the timeout, took %s", elapsed)
+	}
+	if n := atomic.LoadUint32(&results); n != 0 {
+		t.Errorf("expected no combined result for a cancelled pipeline, got %d", n)
+	}
+
+	// пока застрявшее висит, остаются только брошенные: сам job, relay,
+	// дочитывающий его выход, горутина, ждущая все job'ы, и зависший md5.
+	// Все остальное уже вышло по отмене. Подсчет ждет, пока рантайм уберет
+	// завершившиеся
+	const stuck = 4
+	waitGoroutines(before + stuck)
+	if n := runtime.NumGoroutine(); n > before+stuck {
+		t.Errorf("goroutines leaked while a job is stuck: %d before, %d after, %d allowed", before, n, before+stuck)
+	}
+
+	// отпущенные выходят тоже
+	close(block)
+	waitGoroutines(before)
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("goroutines leaked: %d before, %d after", before, n)
+	}
+}
+
+// waitGoroutines ждет до секунды, пока горутин станет не больше n
+func waitGoroutines(n int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSingleHashHungMd5(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	in, out := make(chan interface{}, 3), make(chan interface{}, 3)
+	in <- 0
+	in <- 1
+	in <- 1
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		NewSingleHashJobMemo(MockHasher("p"), hungHasher(block))(ctx, in, out)
+	}()
+	select {
+	case <-returned:
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("SingleHash is stuck on a hung md5 after cancel")
+	}
+	if len(out) != 0 {
+		t.Errorf("expected no results without md5, got %d", len(out))
+	}
+}
+
+func TestExecutePipelineWithOptions(t *testing.T) {
+	written := make(chan struct{})
+	var got []int
+	err := ExecutePipelineWithOptions(context.Background(), PipelineOptions{StageBufs: []int{3}},
+		JobFromFunc(func(in, out chan interface{}) {
+			for i := 0; i < 3; i++ {
+				out <- i
+			}
+			close(written)
+		}),
+		// без буфера источник встал бы на втором значении
+		JobFromFunc(func(in, out chan interface{}) {
+			select {
+			case <-written:
+			case <-time.After(time.Second):
+				t.Error("source blocked on a buffered stage")
+			}
+			for v := range in {
+				got = append(got, v.(int))
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != 0 || got[2] != 2 {
+		t.Errorf("expected 0, 1, 2 in order, got %v", got)
+	}
+
+	if err := ExecutePipelineWithOptions(context.Background(), PipelineOptions{StageBufs: []int{1, -1}}); err == nil {
+		t.Error("expected an error for a negative buffer size")
+	}
+}
+
+// benchStages - 10 job'ов, где каждый второй заметно медленнее соседей
+func benchStages(n int) []job {
+	jobs := []job{JobFromFunc(func(in, out chan interface{}) {
+		for i := 0; i < n; i++ {
+			out <- uint32(i)
+		}
+	})}
+	for s := 1; s < 9; s++ {
+		work := 10
+		if s%2 == 0 {
+			work = 2000
+		}
+		jobs = append(jobs, JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				x := v.(uint32)
+				for i := 0; i < work; i++ {
+					x = x*31 + 7
+				}
+				out <- x
+			}
+		}))
+	}
+	return append(jobs, JobFromFunc(func(in, out chan interface{}) {
+		for range in {
+		}
+	}))
+}
+
+func BenchmarkExecutePipeline(b *testing.B) {
+	for _, buf := range []int{0, 1, 16, 128} {
+		bufs := make([]int, 9)
+		for i := range bufs {
+			bufs[i] = buf
+		}
+		b.Run(fmt.Sprintf("buf=%d", buf), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				ExecutePipelineWithOptions(context.Background(), PipelineOptions{StageBufs: bufs}, benchStages(1000)...)
+			}
+		})
+	}
+}
+
+func TestMultiHashN(t *testing.T) {
+	for _, threads := range []int{0, -1, 65} {
+		if _, err := NewMultiHashJob(threads); err == nil {
+			t.Errorf("expected an error for %d threads", threads)
+		}
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected MultiHashN(0) to panic")
+			}
+		}()
+		MultiHashN(0)
+	}()
+
+	withFastSigners(t)
+	DataSignerCrc32 = fastCrc32
+	multiHash, err := NewMultiHashJob(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			out <- "a"
+			out <- "b"
+		}),
+		multiHash,
+		JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v.(string))
+			}
+		}),
+	)
+	// потоки склеиваются по номеру, в каком бы порядке ни досчитались
+	expected := map[string]bool{
+		fastCrc32("0a") + fastCrc32("1a") + fastCrc32("2a"): true,
+		fastCrc32("0b") + fastCrc32("1b") + fastCrc32("2b"): true,
+	}
+	if len(got) != 2 || !expected[got[0]] || !expected[got[1]] || got[0] == got[1] {
+		t.Errorf("unexpected results %v", got)
+	}
+}
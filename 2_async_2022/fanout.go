@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// FanOut запускает n копий fn, раздает им значения из in по кругу и сводит
+// все, что они пишут, в общий out. Порядок на выходе не сохраняется. Job
+// возвращается, только когда вышли все копии, так что out закрывается после них.
+// Копия, вышедшая раньше времени, не блокирует раздачу: ее вход дочитывается
+// и выбрасывается
+func FanOut(n int, fn job) job {
+	if n < 1 {
+		n = 1
+	}
+	return func(ctx context.Context, in, out chan interface{}) {
+		var wg sync.WaitGroup
+		inputs := make([]chan interface{}, n)
+		for i := range inputs {
+			inputs[i] = make(chan interface{})
+			wg.Add(1)
+			go func(workerIn chan interface{}) {
+				defer wg.Done()
+				fn(ctx, workerIn, out)
+				for range workerIn {
+				}
+			}(inputs[i])
+		}
+		next := 0
+		for v := range in {
+			inputs[next] <- v
+			next = (next + 1) % n
+		}
+		for _, workerIn := range inputs {
+			close(workerIn)
+		}
+		wg.Wait()
+	}
+}
+
+// FanIn сводит inputs в один канал: на каждый вход своя горутина, выход
+// закрывается, когда дочитаны все входы. Порядок между входами не сохраняется
+func FanIn(inputs ...<-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	var wg sync.WaitGroup
+	for _, input := range inputs {
+		wg.Add(1)
+		go func(input <-chan interface{}) {
+			defer wg.Done()
+			for v := range input {
+				out <- v
+			}
+		}(input)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// FanInJob - FanIn как job для начала конвейера: свой in он не читает, а
+// отдает в out все из inputs и выходит, когда они закрыты. При отмене ctx
+// выходит сразу, а то, что еще придет во входы, дочитывается в фоне и выбрасывается
+func FanInJob(inputs ...<-chan interface{}) job {
+	return func(ctx context.Context, in, out chan interface{}) {
+		merged := FanIn(inputs...)
+		// чтобы писатели во входы не встали после отмены
+		defer func() {
+			go func() {
+				for range merged {
+				}
+			}()
+		}()
+		for {
+			select {
+			case v, ok := <-merged:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
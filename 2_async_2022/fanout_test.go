@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFanOut(t *testing.T) {
+	const items = 100
+	var got []int
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			for i := 0; i < items; i++ {
+				out <- i
+			}
+		}),
+		// первое значение считается дольше всех, остальные его обгоняют
+		FanOut(4, JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				if v.(int) == 0 {
+					time.Sleep(50 * time.Millisecond)
+				}
+				out <- v.(int) * 10
+			}
+		})),
+		JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v.(int))
+			}
+		}),
+	)
+
+	if len(got) != items {
+		t.Fatalf("expected %d items, got %d", items, len(got))
+	}
+	if got[0] == 0 {
+		t.Errorf("expected the slow first item to be overtaken, got it first")
+	}
+	sort.Ints(got)
+	for i, v := range got {
+		if v != i*10 {
+			t.Fatalf("item %d lost or duplicated: got %v", i, got)
+		}
+	}
+
+	// копия, которая бросила свой вход, не должна вешать раздачу
+	var taken int
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			for i := 0; i < 10; i++ {
+				out <- i
+			}
+		}),
+		FanOut(2, JobFromFunc(func(in, out chan interface{}) {
+			if v := <-in; v.(int)%2 == 0 {
+				return
+			}
+			for v := range in {
+				out <- v
+			}
+		})),
+		JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+				taken++
+			}
+		}),
+	)
+	if taken != 4 {
+		t.Errorf("expected 4 items from the worker that kept reading, got %d", taken)
+	}
+}
+
+func sourceChan(from, to int) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for i := from; i < to; i++ {
+			ch <- i
+		}
+	}()
+	return ch
+}
+
+func TestFanIn(t *testing.T) {
+	var got []int
+	for v := range FanIn(sourceChan(0, 50), sourceChan(50, 100), sourceChan(100, 100)) {
+		got = append(got, v.(int))
+	}
+	sort.Ints(got)
+	if len(got) != 100 || got[0] != 0 || got[99] != 99 {
+		t.Fatalf("expected 0..99 from all inputs, got %v", got)
+	}
+	if _, ok := <-FanIn(); ok {
+		t.Errorf("FanIn without inputs must close its output")
+	}
+
+	var sum int
+	ExecutePipeline(context.Background(),
+		FanInJob(sourceChan(0, 10), sourceChan(10, 20)),
+		FanOut(3, JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				out <- v.(int) * 2
+			}
+		})),
+		JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				sum += v.(int)
+			}
+		}),
+	)
+	if sum != 2*190 {
+		t.Errorf("expected %d, got %d", 2*190, sum)
+	}
+}
+
+// BenchmarkMerge сравнивает FanIn со связкой, как перед CombineResults, где
+// все писатели пишут прямо в общий канал, а закрывает его WaitGroup
+func BenchmarkMerge(b *testing.B) {
+	const inputs, items = 8, 1000
+	b.Run("FanIn", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			chs := make([]<-chan interface{}, inputs)
+			for j := range chs {
+				chs[j] = sourceChan(0, items)
+			}
+			for range FanIn(chs...) {
+			}
+		}
+	})
+	b.Run("shared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			out := make(chan interface{})
+			var wg sync.WaitGroup
+			for j := 0; j < inputs; j++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for k := 0; k < items; k++ {
+						out <- k
+					}
+				}()
+			}
+			go func() {
+				wg.Wait()
+				close(out)
+			}()
+			for range out {
+			}
+		}
+	})
+}
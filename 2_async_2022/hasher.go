@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+)
+
+// Hasher - подпись данных для SingleHash и MultiHash
+type Hasher interface {
+	Hash(data string) string
+}
+
+// CRC32Hasher - DataSignerCrc32, каждый вызов идет секунду
+type CRC32Hasher struct{}
+
+func (CRC32Hasher) Hash(data string) string {
+	return DataSignerCrc32(data)
+}
+
+// MD5Hasher - DataSignerMd5, одновременно может идти только один вызов
+type MD5Hasher struct{}
+
+func (MD5Hasher) Hash(data string) string {
+	return DataSignerMd5(data)
+}
+
+// SHA256Hasher - sha256 в hex с той же DataSignerSalt, без задержек
+type SHA256Hasher struct{}
+
+func (SHA256Hasher) Hash(data string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(data+DataSignerSalt)))
+}
+
+// serialHasher пускает к hasher по одному вызову за раз, как требует
+// DataSignerMd5. С memo одинаковые данные за время жизни serialHasher, то есть
+// за один запуск job'а, считаются один раз: повтор ждет первый вызов или сразу
+// берет готовое, как в singleflight, только результат не забывается
+type serialHasher struct {
+	hasher Hasher
+	sem    chan struct{}
+	memo   bool
+
+	mu    sync.Mutex
+	calls map[string]*serialHashCall
+}
+
+type serialHashCall struct {
+	done chan struct{}
+	hash string
+	ok   bool
+}
+
+func newSerialHasher(hasher Hasher, memo bool) *serialHasher {
+	return &serialHasher{hasher: hasher, sem: make(chan struct{}, 1), memo: memo, calls: make(map[string]*serialHashCall)}
+}
+
+// Hash ждет очереди и подпись, пока ctx не отменен. false - ctx отменили
+// раньше. Зависший hasher держит очередь, но Hash из-за него не висит
+func (sh *serialHasher) Hash(ctx context.Context, data string) (string, bool) {
+	if !sh.memo {
+		return sh.start(ctx, data).wait(ctx)
+	}
+	sh.mu.Lock()
+	call, ok := sh.calls[data]
+	if !ok {
+		call = sh.start(ctx, data)
+		sh.calls[data] = call
+	}
+	sh.mu.Unlock()
+	return call.wait(ctx)
+}
+
+// start встает в очередь в своей горутине. Если ctx отменят раньше, чем
+// подойдет очередь, hasher не зовется
+func (sh *serialHasher) start(ctx context.Context, data string) *serialHashCall {
+	call := &serialHashCall{done: make(chan struct{})}
+	go func() {
+		defer close(call.done)
+		select {
+		case sh.sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-sh.sem }()
+		call.hash = sh.hasher.Hash(data)
+		call.ok = true
+	}()
+	return call
+}
+
+func (call *serialHashCall) wait(ctx context.Context) (string, bool) {
+	select {
+	case <-call.done:
+		return call.hash, call.ok
+	case <-ctx.Done():
+		return "", false
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MockHasher - подпись без задержек, по которой видно, что и как считалось
+type MockHasher string
+
+func (m MockHasher) Hash(data string) string {
+	return string(m) + "(" + data + ")"
+}
+
+func TestHashers(t *testing.T) {
+	if got := (SHA256Hasher{}).Hash("abc"); got != "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad" {
+		t.Errorf("unexpected sha256 %s", got)
+	}
+	withFastSigners(t)
+	if got, expected := (CRC32Hasher{}).Hash("1"), DataSignerCrc32("1"); got != expected {
+		t.Errorf("expected CRC32Hasher to use DataSignerCrc32, got %s instead of %s", got, expected)
+	}
+
+	multiHash, err := NewMultiHashJobWithHasher(2, MockHasher("p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			out <- 1
+		}),
+		NewSingleHashJob(MockHasher("p"), MockHasher("s")),
+		multiHash,
+		JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v.(string))
+			}
+		}),
+	)
+	if expected := "p(0p(1)~p(s(1)))p(1p(1)~p(s(1)))"; len(got) != 1 || got[0] != expected {
+		t.Errorf("expected %s, got %v", expected, got)
+	}
+}
+
+// slowMockHasher - MockHasher, который отвечает тем дольше, чем короче данные,
+// чтобы значения обгоняли друг друга. Запускать с -race
+type slowMockHasher string
+
+func (m slowMockHasher) Hash(data string) string {
+	time.Sleep(time.Duration(20-len(data)) * time.Millisecond)
+	return MockHasher(m).Hash(data)
+}
+
+func TestSingleHashPairs(t *testing.T) {
+	const items = 20
+	var got []string
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			for i := 0; i < items; i++ {
+				out <- i
+			}
+		}),
+		NewSingleHashJob(slowMockHasher("p"), MockHasher("s")),
+		JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v.(string))
+			}
+		}),
+	)
+	if len(got) != items {
+		t.Fatalf("expected %d results, got %d", items, len(got))
+	}
+	seen := make(map[string]bool)
+	for _, result := range got {
+		var data int
+		if _, err := fmt.Sscanf(result, "p(%d)~", &data); err != nil {
+			t.Fatalf("unexpected result %q", result)
+		}
+		if expected := fmt.Sprintf("p(%d)~p(s(%d))", data, data); result != expected || seen[result] {
+			t.Errorf("crc32 of different items mixed up: %q instead of %q", result, expected)
+		}
+		seen[result] = true
+	}
+}
+
+// sleepHasher - MockHasher с задержкой, который считает вызовы и сколько их
+// шло одновременно
+type sleepHasher struct {
+	mock  MockHasher
+	delay time.Duration
+
+	mu                   sync.Mutex
+	calls, running, peak int
+}
+
+func (h *sleepHasher) Hash(data string) string {
+	h.mu.Lock()
+	h.calls++
+	h.running++
+	if h.running > h.peak {
+		h.peak = h.running
+	}
+	h.mu.Unlock()
+	time.Sleep(h.delay)
+	h.mu.Lock()
+	h.running--
+	h.mu.Unlock()
+	return h.mock.Hash(data)
+}
+
+func TestSingleHashMd5Gate(t *testing.T) {
+	const (
+		items, distinct = 20, 4
+		md5Delay        = 25 * time.Millisecond
+		crc32Delay      = 50 * time.Millisecond
+	)
+	cases := []struct {
+		name     string
+		newJob   func(primary, secondary Hasher) job
+		md5Calls int
+	}{
+		{"per item", NewSingleHashJob, items},
+		{"memo", NewSingleHashJobMemo, distinct},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := &sleepHasher{mock: "p", delay: crc32Delay}
+			secondary := &sleepHasher{mock: "s", delay: md5Delay}
+			var got []string
+			start := time.Now()
+			ExecutePipeline(context.Background(),
+				JobFromFunc(func(in, out chan interface{}) {
+					for i := 0; i < items; i++ {
+						out <- i % distinct
+					}
+				}),
+				tc.newJob(primary, secondary),
+				JobFromFunc(func(in, out chan interface{}) {
+					for v := range in {
+						got = append(got, v.(string))
+					}
+				}),
+			)
+			elapsed := time.Since(start)
+
+			if len(got) != items {
+				t.Fatalf("expected %d results, got %d", items, len(got))
+			}
+			for _, result := range got {
+				var data int
+				if _, err := fmt.Sscanf(result, "p(%d)~", &data); err != nil {
+					t.Fatalf("unexpected result %q", result)
+				}
+				if expected := fmt.Sprintf("p(%d)~p(s(%d))", data, data); result != expected {
+					t.Errorf("expected %q, got %q", expected, result)
+				}
+			}
+			if secondary.peak != 1 {
+				t.Errorf("md5 must run one at a time, got %d concurrent calls", secondary.peak)
+			}
+			if secondary.calls != tc.md5Calls {
+				t.Errorf("expected %d md5 calls, got %d", tc.md5Calls, secondary.calls)
+			}
+			// crc32(md5) ждет свой md5, так что быстрее очереди md5 плюс один
+			// crc32 не выйдет. Сверху проверяем только, что crc32 не встали в
+			// очередь вслед за md5, иначе было бы не меньше items*crc32Delay
+			if serial := time.Duration(tc.md5Calls)*md5Delay + crc32Delay; elapsed < serial || elapsed >= items*crc32Delay {
+				t.Errorf("expected from %s to %s, got %s", serial, items*crc32Delay, elapsed)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/md5"
 	"fmt"
 	"hash/crc32"
@@ -27,7 +28,7 @@ func TestPipeline(t *testing.T) {
 	var ok = true
 	var recieved uint32
 	freeFlowJobs := []job{
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			out <- 1
 			time.Sleep(10 * time.Millisecond)
 			currRecieved := atomic.LoadUint32(&recieved)
@@ -46,13 +47,13 @@ func TestPipeline(t *testing.T) {
 				ok = false
 			}
 		}),
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			for _ = range in {
 				atomic.AddUint32(&recieved, 1)
 			}
 		}),
 	}
-	ExecutePipeline(freeFlowJobs...)
+	ExecutePipeline(context.Background(), freeFlowJobs...)
 	if !ok || recieved == 0 {
 		t.Errorf("no value free flow - dont collect them")
 	}
@@ -123,15 +124,15 @@ func TestSigner(t *testing.T) {
 	// inputData := []int{0,1}
 
 	hashSignJobs := []job{
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			for _, fibNum := range inputData {
 				out <- fibNum
 			}
 		}),
-		job(SingleHash),
-		job(MultiHash),
-		job(CombineResults),
-		job(func(in, out chan interface{}) {
+		JobFromFunc(SingleHash),
+		MultiHash,
+		JobFromFunc(CombineResults),
+		JobFromFunc(func(in, out chan interface{}) {
 			dataRaw := <-in
 			data, ok := dataRaw.(string)
 			if !ok {
@@ -143,7 +144,7 @@ func TestSigner(t *testing.T) {
 
 	start := time.Now()
 
-	ExecutePipeline(hashSignJobs...)
+	ExecutePipeline(context.Background(), hashSignJobs...)
 
 	end := time.Since(start)
 
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Signer считает хеш строки, для дерева обычно DataSignerCrc32
+type Signer func(data string) string
+
+// Leaf - результат MultiHash с номером входного значения, по номерам
+// листья встают в дерево в порядке входа, а не в порядке готовности
+type Leaf struct {
+	Seq  int
+	Hash string
+}
+
+// MerkleRoot - итог CombineMerkle. Depth - число уровней над листьями
+type MerkleRoot struct {
+	Root   string
+	Depth  int
+	Leaves int
+}
+
+// merkleBatch - сколько пар одного уровня считается параллельно при работе с диском
+const merkleBatch = 1024
+
+var errLeafOutOfRange = errors.New("leaf index out of range")
+
+// SequencedSigner - SingleHash и MultiHash одной стадией, которая нумерует
+// входные значения в порядке поступления и отдает Leaf для CombineMerkle
+func SequencedSigner(in, out chan interface{}) {
+	var wg sync.WaitGroup
+	md5Gate := newSerialHasher(MD5Hasher{}, false)
+	seq := 0
+	for v := range in {
+		wg.Add(1)
+		go func(seq int, data string) {
+			defer wg.Done()
+			single, _ := singleHashOf(context.Background(), CRC32Hasher{}, md5Gate, data)
+			out <- Leaf{Seq: seq, Hash: multiHashOf(context.Background(), multiHashThreads, CRC32Hasher{}, single)}
+		}(seq, fmt.Sprint(v))
+		seq++
+	}
+	wg.Wait()
+}
+
+// CombineMerkle - альтернатива CombineResults: собирает листья и отдает
+// MerkleRoot бинарного дерева, где родитель - signer(left + right), а непарный
+// последний узел уровня поднимается выше как есть. Leaf встают по Seq,
+// обычные строки - в порядке прихода
+func CombineMerkle(signer Signer) job {
+	return func(_ context.Context, in, out chan interface{}) {
+		leaves, err := collectLeaves(in)
+		if err != nil {
+			out <- err
+			return
+		}
+		tree := BuildMerkleTree(leaves, signer)
+		out <- MerkleRoot{Root: tree.Root(), Depth: tree.Depth(), Leaves: len(leaves)}
+	}
+}
+
+// CombineMerkleOnDisk строит то же дерево, но держит уровни во временных
+// файлах в dir, в памяти остаются только листья, пришедшие раньше своей очереди,
+// и одна пачка пар. Ошибки диска уходят в out значением error
+func CombineMerkleOnDisk(signer Signer, dir string) job {
+	return func(_ context.Context, in, out chan interface{}) {
+		root, err := merkleOnDisk(in, signer, dir)
+		if err != nil {
+			out <- err
+			return
+		}
+		out <- root
+	}
+}
+
+// collectLeaves дочитывает in даже после ошибки, чтобы не встал предыдущий этап
+func collectLeaves(in chan interface{}) ([]string, error) {
+	bySeq := make(map[int]string)
+	arrival := 0
+	var inErr error
+	for v := range in {
+		leaf, err := toLeaf(v, arrival)
+		arrival++
+		if err != nil {
+			inErr = err
+			continue
+		}
+		if _, ok := bySeq[leaf.Seq]; ok {
+			inErr = fmt.Errorf("duplicate leaf %d", leaf.Seq)
+			continue
+		}
+		bySeq[leaf.Seq] = leaf.Hash
+	}
+	if inErr != nil {
+		return nil, inErr
+	}
+	leaves := make([]string, len(bySeq))
+	for seq, hash := range bySeq {
+		if seq < 0 || seq >= len(leaves) {
+			return nil, fmt.Errorf("leaf %d: sequence has gaps", seq)
+		}
+		leaves[seq] = hash
+	}
+	return leaves, nil
+}
+
+func toLeaf(v interface{}, arrival int) (Leaf, error) {
+	switch v := v.(type) {
+	case Leaf:
+		return v, nil
+	case string:
+		return Leaf{Seq: arrival, Hash: v}, nil
+	default:
+		return Leaf{}, fmt.Errorf("unexpected leaf %T", v)
+	}
+}
+
+// MerkleTree хранит все уровни, от листьев до корня, чтобы строить доказательства
+type MerkleTree struct {
+	levels [][]string
+}
+
+func BuildMerkleTree(leaves []string, signer Signer) *MerkleTree {
+	tree := &MerkleTree{levels: [][]string{leaves}}
+	for level := leaves; len(level) > 1; {
+		level = hashLevel(level, signer)
+		tree.levels = append(tree.levels, level)
+	}
+	return tree
+}
+
+// Root пустого дерева - пустая строка
+func (mt *MerkleTree) Root() string {
+	top := mt.levels[len(mt.levels)-1]
+	if len(top) == 0 {
+		return ""
+	}
+	return top[0]
+}
+
+func (mt *MerkleTree) Depth() int {
+	return len(mt.levels) - 1
+}
+
+// ProofStep - соседний узел на пути от листа к корню
+type ProofStep struct {
+	Hash string
+	// Left - сосед стоит слева, то есть родитель signer(Hash + текущий)
+	Left bool
+}
+
+// Proof возвращает путь от листа index к корню. На уровнях, где узел
+// поднимался без пары, шага нет
+func (mt *MerkleTree) Proof(index int) ([]ProofStep, error) {
+	if index < 0 || index >= len(mt.levels[0]) {
+		return nil, errLeafOutOfRange
+	}
+	var proof []ProofStep
+	for _, level := range mt.levels[:len(mt.levels)-1] {
+		sibling := index ^ 1
+		if sibling < len(level) {
+			proof = append(proof, ProofStep{Hash: level[sibling], Left: sibling < index})
+		}
+		index /= 2
+	}
+	return proof, nil
+}
+
+// VerifyMerkleProof проверяет, что leaf входит в дерево с корнем root
+func VerifyMerkleProof(leaf string, proof []ProofStep, root string, signer Signer) bool {
+	hash := leaf
+	for _, step := range proof {
+		if step.Left {
+			hash = signer(step.Hash + hash)
+		} else {
+			hash = signer(hash + step.Hash)
+		}
+	}
+	return hash == root
+}
+
+// hashLevel считает следующий уровень, все пары параллельно - DataSignerCrc32 считается секунду
+func hashLevel(level []string, signer Signer) []string {
+	next := make([]string, (len(level)+1)/2)
+	var wg sync.WaitGroup
+	for i := 0; i+1 < len(level); i += 2 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			next[i/2] = signer(level[i] + level[i+1])
+		}(i)
+	}
+	if len(level)%2 == 1 {
+		next[len(next)-1] = level[len(level)-1]
+	}
+	wg.Wait()
+	return next
+}
+
+func merkleOnDisk(in chan interface{}, signer Signer, dir string) (MerkleRoot, error) {
+	level, err := os.CreateTemp(dir, "merkle-*.level")
+	if err != nil {
+		return MerkleRoot{}, err
+	}
+	defer func() {
+		level.Close()
+		os.Remove(level.Name())
+	}()
+
+	// листья пишутся по порядку Seq, забежавшие вперед ждут в pending
+	w := bufio.NewWriter(level)
+	pending := make(map[int]string)
+	next, arrival := 0, 0
+	var inErr error
+	for v := range in {
+		leaf, err := toLeaf(v, arrival)
+		arrival++
+		if err != nil {
+			inErr = err
+			continue
+		}
+		if _, ok := pending[leaf.Seq]; ok || leaf.Seq < next {
+			inErr = fmt.Errorf("duplicate leaf %d", leaf.Seq)
+			continue
+		}
+		pending[leaf.Seq] = leaf.Hash
+		for hash, ok := pending[next]; ok; hash, ok = pending[next] {
+			delete(pending, next)
+			if _, err := w.WriteString(strconv.Quote(hash) + "\n"); err != nil && inErr == nil {
+				inErr = err
+			}
+			next++
+		}
+	}
+	if inErr != nil {
+		return MerkleRoot{}, inErr
+	}
+	if len(pending) > 0 {
+		return MerkleRoot{}, fmt.Errorf("leaf %d: sequence has gaps", next)
+	}
+	if err := w.Flush(); err != nil {
+		return MerkleRoot{}, err
+	}
+
+	root := MerkleRoot{Leaves: next}
+	for count := next; count > 1; count = (count + 1) / 2 {
+		upper, err := os.CreateTemp(dir, "merkle-*.level")
+		if err != nil {
+			return MerkleRoot{}, err
+		}
+		err = hashLevelFile(level, upper, signer)
+		level.Close()
+		os.Remove(level.Name())
+		level = upper
+		if err != nil {
+			return MerkleRoot{}, err
+		}
+		root.Depth++
+	}
+	if next == 1 || root.Depth > 0 {
+		if _, err := level.Seek(0, io.SeekStart); err != nil {
+			return MerkleRoot{}, err
+		}
+		if root.Root, err = readNode(bufio.NewReader(level)); err != nil {
+			return MerkleRoot{}, err
+		}
+	}
+	return root, nil
+}
+
+// hashLevelFile читает уровень из from пачками и дописывает следующий в to
+func hashLevelFile(from, to *os.File, signer Signer) error {
+	if _, err := from.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r, w := bufio.NewReader(from), bufio.NewWriter(to)
+	for {
+		batch := make([]string, 0, 2*merkleBatch)
+		for len(batch) < cap(batch) {
+			node, err := readNode(r)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			batch = append(batch, node)
+		}
+		if len(batch) == 0 {
+			break
+		}
+		// пачка четная, кроме последней, так что непарный узел - последний на уровне
+		for _, node := range hashLevel(batch, signer) {
+			if _, err := w.WriteString(strconv.Quote(node) + "\n"); err != nil {
+				return err
+			}
+		}
+		if len(batch) < cap(batch) {
+			break
+		}
+	}
+	return w.Flush()
+}
+
+func readNode(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return "", io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strconv.Unquote(strings.TrimSuffix(line, "\n"))
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// fastCrc32 - DataSignerCrc32 без секундной задержки
+func fastCrc32(data string) string {
+	return strconv.FormatUint(uint64(crc32.ChecksumIEEE([]byte(data))), 10)
+}
+
+// referenceMerkle - то же дерево в лоб, без горутин и файлов
+func referenceMerkle(leaves []string) (root string, depth int) {
+	level := append([]string(nil), leaves...)
+	for len(level) > 1 {
+		var next []string
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+			} else {
+				next = append(next, fastCrc32(level[i]+level[i+1]))
+			}
+		}
+		level = next
+		depth++
+	}
+	if len(level) == 1 {
+		root = level[0]
+	}
+	return root, depth
+}
+
+func runMerkle(t *testing.T, combine job, leaves []Leaf) interface{} {
+	t.Helper()
+	var result interface{}
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			for _, leaf := range leaves {
+				out <- leaf
+			}
+		}),
+		combine,
+		JobFromFunc(func(in, out chan interface{}) {
+			result = <-in
+		}),
+	)
+	return result
+}
+
+func TestCombineMerkle(t *testing.T) {
+	dir := t.TempDir()
+	for _, n := range []int{0, 1, 2, 3, 5, 8, 13, 2*merkleBatch + 3} {
+		hashes := make([]string, n)
+		leaves := make([]Leaf, n)
+		for i := range hashes {
+			hashes[i] = fastCrc32(strconv.Itoa(i))
+			leaves[i] = Leaf{Seq: i, Hash: hashes[i]}
+		}
+		// порядок готовности не должен влиять на корень
+		rand.Shuffle(len(leaves), func(i, j int) { leaves[i], leaves[j] = leaves[j], leaves[i] })
+
+		root, depth := referenceMerkle(hashes)
+		expected := MerkleRoot{Root: root, Depth: depth, Leaves: n}
+		for name, combine := range map[string]job{
+			"memory": CombineMerkle(fastCrc32),
+			"disk":   CombineMerkleOnDisk(fastCrc32, dir),
+		} {
+			if got := runMerkle(t, combine, leaves); got != expected {
+				t.Errorf("%s, %d leaves: expected %+v, got %+v", name, n, expected, got)
+			}
+		}
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected temporary levels to be removed, got %d files", len(entries))
+	}
+
+	for name, combine := range map[string]job{
+		"memory": CombineMerkle(fastCrc32),
+		"disk":   CombineMerkleOnDisk(fastCrc32, dir),
+	} {
+		if _, ok := runMerkle(t, combine, []Leaf{{Seq: 0, Hash: "a"}, {Seq: 2, Hash: "c"}}).(error); !ok {
+			t.Errorf("%s: expected an error for a gap in the sequence", name)
+		}
+		if _, ok := runMerkle(t, combine, []Leaf{{Seq: 0, Hash: "a"}, {Seq: 0, Hash: "b"}, {Seq: 1, Hash: "c"}}).(error); !ok {
+			t.Errorf("%s: expected an error for a duplicate leaf", name)
+		}
+	}
+}
+
+func TestMerkleProof(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 6, 7, 11} {
+		leaves := make([]string, n)
+		for i := range leaves {
+			leaves[i] = fmt.Sprintf("leaf%d", i)
+		}
+		tree := BuildMerkleTree(leaves, fastCrc32)
+		for i, leaf := range leaves {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !VerifyMerkleProof(leaf, proof, tree.Root(), fastCrc32) {
+				t.Errorf("%d leaves: proof for leaf %d does not verify", n, i)
+			}
+			if VerifyMerkleProof(leaf+"x", proof, tree.Root(), fastCrc32) && n > 1 {
+				t.Errorf("%d leaves: proof verifies a tampered leaf %d", n, i)
+			}
+		}
+		if _, err := tree.Proof(n); err != errLeafOutOfRange {
+			t.Errorf("expected errLeafOutOfRange, got %v", err)
+		}
+	}
+}
+
+func TestSequencedSigner(t *testing.T) {
+	md5, crc := DataSignerMd5, DataSignerCrc32
+	defer func() { DataSignerMd5, DataSignerCrc32 = md5, crc }()
+	DataSignerMd5 = func(data string) string { return data + "md5" }
+	DataSignerCrc32 = fastCrc32
+
+	inputData := []int{0, 1, 1, 2, 3}
+	var expected []string
+	for _, v := range inputData {
+		data := strconv.Itoa(v)
+		single := fastCrc32(data) + "~" + fastCrc32(data+"md5")
+		var multi string
+		for th := 0; th < multiHashThreads; th++ {
+			multi += fastCrc32(strconv.Itoa(th) + single)
+		}
+		expected = append(expected, multi)
+	}
+	root, depth := referenceMerkle(expected)
+
+	var result interface{}
+	ExecutePipeline(context.Background(),
+		JobFromFunc(func(in, out chan interface{}) {
+			for _, v := range inputData {
+				out <- v
+			}
+		}),
+		JobFromFunc(SequencedSigner),
+		CombineMerkle(DataSignerCrc32),
+		JobFromFunc(func(in, out chan interface{}) {
+			result = <-in
+		}),
+	)
+	if want := (MerkleRoot{Root: root, Depth: depth, Leaves: len(inputData)}); result != want {
+		t.Errorf("expected %+v, got %+v", want, result)
+	}
+}
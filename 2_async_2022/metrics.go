@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+const defaultMetricsInterval = time.Second
+
+// NamedJob - job с именем для PipelineMetrics
+type NamedJob struct {
+	Name string
+	Fn   job
+}
+
+// PipelineMetrics - состояние одного job'а. ItemsIn - сколько значений ему
+// передали, ItemsOut - сколько он отдал. AvgDurationNs - время работы job'а,
+// поделенное на ItemsOut, то есть сколько в среднем стоит одно значение на выходе
+type PipelineMetrics struct {
+	StageName     string
+	ItemsIn       uint64
+	ItemsOut      uint64
+	AvgDurationNs int64
+}
+
+type stageStats struct {
+	name string
+	out  chan interface{}
+	// taken - сколько relay забрал из out, passed - сколько отдал следующему job'у
+	taken    uint64
+	passed   uint64
+	started  int64
+	finished int64
+}
+
+type pipelineStats struct {
+	stages []*stageStats
+}
+
+func newPipelineStats(names []string) *pipelineStats {
+	ps := &pipelineStats{stages: make([]*stageStats, len(names))}
+	for i, name := range names {
+		ps.stages[i] = &stageStats{name: name}
+	}
+	return ps
+}
+
+func (ps *pipelineStats) snapshot() []PipelineMetrics {
+	now := time.Now().UnixNano()
+	metrics := make([]PipelineMetrics, len(ps.stages))
+	for i, st := range ps.stages {
+		m := PipelineMetrics{StageName: st.name}
+		if i > 0 {
+			m.ItemsIn = atomic.LoadUint64(&ps.stages[i-1].passed)
+		}
+		// то, что лежит в буфере выхода, job уже отдал
+		m.ItemsOut = atomic.LoadUint64(&st.taken) + uint64(len(st.out))
+		started, finished := atomic.LoadInt64(&st.started), atomic.LoadInt64(&st.finished)
+		if finished == 0 {
+			finished = now
+		}
+		if started != 0 && m.ItemsOut > 0 {
+			m.AvgDurationNs = (finished - started) / int64(m.ItemsOut)
+		}
+		metrics[i] = m
+	}
+	return metrics
+}
+
+// ExecutePipelineNamed - ExecutePipelineWithOptions, где у job'ов есть имена
+// для PipelineOptions.MetricsCallback. По таймеру колбэк вызывается из фоновой
+// горутины, последний раз - уже после нее, так что одновременно с собой он не работает
+func ExecutePipelineNamed(ctx context.Context, opts PipelineOptions, jobs ...NamedJob) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	stages := make([]ErrJob, len(jobs))
+	names := make([]string, len(jobs))
+	for i, j := range jobs {
+		stages[i] = ErrJobFromJob(j.Fn)
+		names[i] = j.Name
+	}
+	stats := newPipelineStats(names)
+	_, done := startPipeline(ctx, opts, stages, stats)
+	if opts.MetricsCallback == nil {
+		// после отмены зависшие job'ы не ждем, см. ExecutePipeline
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		return ctx.Err()
+	}
+
+	interval := opts.MetricsInterval
+	if interval <= 0 {
+		interval = defaultMetricsInterval
+	}
+	reporterDone := make(chan struct{})
+	go func() {
+		defer close(reporterDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				opts.MetricsCallback(stats.snapshot())
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	<-reporterDone
+	opts.MetricsCallback(stats.snapshot())
+	return ctx.Err()
+}
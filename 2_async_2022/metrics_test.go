@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPipelineMetrics(t *testing.T) {
+	var mu sync.Mutex
+	var reports [][]PipelineMetrics
+	opts := PipelineOptions{
+		StageBufs:       []int{0, 4},
+		MetricsInterval: 20 * time.Millisecond,
+		MetricsCallback: func(m []PipelineMetrics) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, m)
+		},
+	}
+	err := ExecutePipelineNamed(context.Background(), opts,
+		NamedJob{Name: "source", Fn: JobFromFunc(func(in, out chan interface{}) {
+			for i := 0; i < 10; i++ {
+				out <- i
+			}
+		})},
+		NamedJob{Name: "slow", Fn: JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				time.Sleep(10 * time.Millisecond)
+				out <- v
+				out <- v
+			}
+		})},
+		NamedJob{Name: "sink", Fn: JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+			}
+		})},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 2 {
+		t.Fatalf("expected periodic reports and a final one, got %d", len(reports))
+	}
+	final := reports[len(reports)-1]
+	expected := []PipelineMetrics{
+		{StageName: "source", ItemsIn: 0, ItemsOut: 10},
+		{StageName: "slow", ItemsIn: 10, ItemsOut: 20},
+		{StageName: "sink", ItemsIn: 20, ItemsOut: 0},
+	}
+	for i, m := range final {
+		if m.StageName != expected[i].StageName || m.ItemsIn != expected[i].ItemsIn || m.ItemsOut != expected[i].ItemsOut {
+			t.Errorf("stage %d: expected %+v, got %+v", i, expected[i], m)
+		}
+	}
+	// 10 значений по 10 мс на 20 выходов - не меньше 5 мс на значение
+	if final[1].AvgDurationNs < int64(5*time.Millisecond) {
+		t.Errorf("unexpected slow stage duration %v", time.Duration(final[1].AvgDurationNs))
+	}
+	if first := reports[0]; first[1].ItemsOut >= 20 {
+		t.Errorf("expected the first report while the pipeline is running, got %+v", first)
+	}
+}
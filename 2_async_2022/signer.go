@@ -1,124 +1,379 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 func main() {
 	var result string
 	inputData := []int{0, 1}
 	hashSignJobs := []job{
-		job(func(in, out chan interface{}) {
+		JobFromFunc(func(in, out chan interface{}) {
 			for _, fibNum := range inputData {
 				out <- fibNum
 			}
 		}),
-		job(SingleHash),
-		job(MultiHash),
-		job(CombineResults),
-		job(func(in, out chan interface{}) {
+		SingleHashCtx,
+		MultiHash,
+		combineResults,
+		JobFromFunc(func(in, out chan interface{}) {
 			dataRaw := <-in
 			data, _ := dataRaw.(string)
 			result = data
 		}),
 	}
-	ExecutePipeline(hashSignJobs...)
+	if err := ExecutePipeline(context.Background(), hashSignJobs...); err != nil {
+		fmt.Println(err)
+		return
+	}
 	fmt.Println(result)
 }
 
-func ExecutePipeline(freeFlowJobs ...job) {
+// JobFromFunc - адаптер для job'ов старого вида, без ctx
+func JobFromFunc(fn func(in, out chan interface{})) job {
+	return func(_ context.Context, in, out chan interface{}) {
+		fn(in, out)
+	}
+}
+
+// ExecutePipeline ждет, пока завершатся все job'ы. При отмене ctx входы
+// job'ов закрываются, чтобы они дочитали и вышли, а то, что еще отдают
+// предыдущие, выбрасывается. Самих job'ов после отмены уже не ждет и сразу
+// возвращает ctx.Err(): job, который не смотрит ни на ctx, ни на вход,
+// остается висеть, его горутины брошены и выйдут, только если он вернется сам
+func ExecutePipeline(ctx context.Context, freeFlowJobs ...job) error {
+	return ExecutePipelineWithOptions(ctx, PipelineOptions{}, freeFlowJobs...)
+}
+
+// recv читает из in, пока ctx не отменен. false - вход закрыт или ctx отменен
+func recv(ctx context.Context, in chan interface{}) (interface{}, bool) {
+	select {
+	case v, ok := <-in:
+		return v, ok
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// send пишет в out, пока ctx не отменен. false - значение не отдано
+func send(ctx context.Context, out chan interface{}, v interface{}) bool {
+	select {
+	case out <- v:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// PipelineOptions - настройки ExecutePipelineWithOptions. StageBufs[i] - буфер
+// канала между job'ами i и i+1, недостающие каналы без буфера
+type PipelineOptions struct {
+	StageBufs []int
+	// MetricsCallback получает PipelineMetrics по всем job'ам раз в
+	// MetricsInterval, по умолчанию раз в секунду, и еще раз после завершения
+	MetricsCallback func([]PipelineMetrics)
+	MetricsInterval time.Duration
+	// TraceCollector, если задан, копит события всех TracingJob конвейера
+	TraceCollector *PipelineTrace
+}
+
+func (opts PipelineOptions) validate() error {
+	for i, n := range opts.StageBufs {
+		if n < 0 {
+			return fmt.Errorf("stage %d: buffer size cannot be %d", i, n)
+		}
+	}
+	return nil
+}
+
+// stageBuf - буфер выхода job'а i, у последнего выход никто не читает
+func (opts PipelineOptions) stageBuf(i, stages int) int {
+	if i+1 >= stages || i >= len(opts.StageBufs) {
+		return 0
+	}
+	return opts.StageBufs[i]
+}
+
+// ExecutePipelineWithOptions - ExecutePipeline с буферами между job'ами: быстрый
+// job не ждет, пока медленный следующий заберет каждое значение
+func ExecutePipelineWithOptions(ctx context.Context, opts PipelineOptions, freeFlowJobs ...job) error {
+	named := make([]NamedJob, len(freeFlowJobs))
+	for i, j := range freeFlowJobs {
+		named[i] = NamedJob{Name: fmt.Sprintf("stage %d", i), Fn: j}
+	}
+	return ExecutePipelineNamed(ctx, opts, named...)
+}
+
+// startPipeline запускает job'ы, связывая их через relay. done закрывается,
+// когда вышли все job'ы и relay, errs получает ошибки job'ов, места хватит всем.
+// stats, если не nil, заполняется по ходу работы
+func startPipeline(ctx context.Context, opts PipelineOptions, stages []ErrJob, stats *pipelineStats) (<-chan *PipelineError, <-chan struct{}) {
+	if stats == nil {
+		stats = newPipelineStats(make([]string, len(stages)))
+	}
+	if opts.TraceCollector != nil {
+		ctx = context.WithValue(ctx, traceCollectorKey{}, opts.TraceCollector)
+	}
 	var wg sync.WaitGroup
+	errs := make(chan *PipelineError, len(stages))
 	in := make(chan interface{})
-	for _, funcWorkers := range freeFlowJobs {
-		out := make(chan interface{})
+	// первый вход никто не пишет, закрываем его только по отмене
+	stopFirst := make(chan struct{})
+	go func(first chan interface{}) {
+		select {
+		case <-ctx.Done():
+			close(first)
+		case <-stopFirst:
+		}
+	}(in)
+	for i, stage := range stages {
+		out := make(chan interface{}, opts.stageBuf(i, len(stages)))
+		st := stats.stages[i]
+		st.out = out
 		wg.Add(1)
-		go func(in chan interface{}, out chan interface{}, wg *sync.WaitGroup, workers job) {
+		go func(i int, in chan interface{}, out chan interface{}, stage ErrJob) {
 			defer wg.Done()
 			defer close(out)
-			workers(in, out)
-		}(in, out, &wg, funcWorkers)
-		in = out
+			atomic.StoreInt64(&st.started, time.Now().UnixNano())
+			defer func() { atomic.StoreInt64(&st.finished, time.Now().UnixNano()) }()
+			if err := stage(ctx, in, out); err != nil {
+				errs <- &PipelineError{Stage: i, Err: err}
+			}
+		}(i, in, out, stage)
+		if i+1 < len(stages) {
+			next := make(chan interface{})
+			wg.Add(1)
+			go func(from, to chan interface{}) {
+				defer wg.Done()
+				relay(ctx, from, to, st)
+			}(out, next)
+			in = next
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopFirst)
+		close(done)
+	}()
+	return errs, done
+}
+
+// relay передает значения между job'ами, пока ctx не отменен. После отмены
+// закрывает to и дочитывает from, чтобы предыдущий job не встал на записи
+// st - статистика job'а, который пишет в from
+func relay(ctx context.Context, from, to chan interface{}, st *stageStats) {
+	defer func() {
+		for range from {
+			atomic.AddUint64(&st.taken, 1)
+		}
+	}()
+	defer close(to)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-from:
+			if !ok {
+				return
+			}
+			atomic.AddUint64(&st.taken, 1)
+			select {
+			case to <- v:
+				atomic.AddUint64(&st.passed, 1)
+			case <-ctx.Done():
+				return
+			}
+		}
 	}
-	wg.Wait()
 }
 
-func getAlgo(ch chan string, data string) {
-	ch <- DataSignerCrc32(data)
+func getAlgo(ch chan string, hasher Hasher, data string) {
+	ch <- hasher.Hash(data)
 }
 
 func SingleHash(in, out chan interface{}) {
-	var wg sync.WaitGroup
-	var wgAlgo sync.WaitGroup
-	crc32Receiver := make(chan string)
-	crc32WithMd5Receiver := make(chan string)
-	for v := range in {
-		wg.Add(1)
-		data := v.(int)
-		md5 := DataSignerMd5(strconv.Itoa(v.(int)))
-		go func(wg *sync.WaitGroup, wgAdditional *sync.WaitGroup, out chan interface{}, data int, hash string) {
-			defer wg.Done()
-			wgAdditional.Add(1)
-			go getAlgo(crc32Receiver, strconv.Itoa(data))
-			go getAlgo(crc32WithMd5Receiver, hash)
-			wgAdditional.Done()
-			crc32 := <-crc32Receiver
-			crc32WithMd5 := <-crc32WithMd5Receiver
-			wgAdditional.Wait()
-			result := crc32 + "~" + crc32WithMd5
-			fmt.Printf("%v SingleHash data %v\n", data, data)
-			fmt.Printf("%v SingleHash md5(data) %v\n", data, md5)
-			fmt.Printf("%v SingleHash crc32(md5(data)) %v\n", data, crc32WithMd5)
-			fmt.Printf("%v SingleHash crc32(data) %v\n", data, crc32)
-			fmt.Printf("%v SingleHash result %v\n", data, result)
-			out <- result
-		}(&wg, &wgAlgo, out, data, md5)
+	SingleHashCtx(context.Background(), in, out)
+}
+
+// SingleHashCtx - SingleHash как job: при отмене ctx перестает брать новые
+// значения и не ждет ни подписей, ни пока заберут уже посчитанные
+func SingleHashCtx(ctx context.Context, in, out chan interface{}) {
+	singleHash(ctx, CRC32Hasher{}, MD5Hasher{}, false, in, out)
+}
+
+// NewSingleHashJob - SingleHashCtx со своими подписями: primary вместо crc32,
+// secondary вместо md5. secondary зовется по одному значению за раз, как md5
+func NewSingleHashJob(primary, secondary Hasher) job {
+	return func(ctx context.Context, in, out chan interface{}) {
+		singleHash(ctx, primary, secondary, false, in, out)
+	}
+}
+
+// NewSingleHashJobMemo - NewSingleHashJob, в котором secondary для одинаковых
+// значений за один запуск считается один раз. По умолчанию так не делается:
+// md5 зовется на каждое значение, сколько бы раз оно ни повторялось
+func NewSingleHashJobMemo(primary, secondary Hasher) job {
+	return func(ctx context.Context, in, out chan interface{}) {
+		singleHash(ctx, primary, secondary, true, in, out)
 	}
-	wg.Wait()
 }
 
-func MultiHash(in, out chan interface{}) {
+func singleHash(ctx context.Context, primary, secondary Hasher, memo bool, in, out chan interface{}) {
 	var wg sync.WaitGroup
-	var wgThreads sync.WaitGroup
-	for v := range in {
+	md5Gate := newSerialHasher(secondary, memo)
+	for {
+		v, ok := recv(ctx, in)
+		if !ok {
+			break
+		}
 		wg.Add(1)
-		data := v.(string)
-		go func(wg *sync.WaitGroup, out chan interface{}, data string) {
+		go func(data int) {
 			defer wg.Done()
-			var result string
-			maxThreads := 6
-			threadsSlice := make([]string, maxThreads, maxThreads)
-			for i := 0; i < maxThreads; i++ {
-				thread := i
-				wgThreads.Add(1)
-				go func(wg *sync.WaitGroup, th int, data string, threadSlice []string) {
-					defer wg.Done()
-					threadsSlice[th] = DataSignerCrc32(strconv.Itoa(th) + data)
-					fmt.Printf("%v MultiHash: crc32(th+step1) %v %v\n", data, thread, threadsSlice[th])
-				}(&wgThreads, thread, data, threadsSlice)
+			if result, ok := singleHashOf(ctx, primary, md5Gate, strconv.Itoa(data)); ok {
+				send(ctx, out, result)
 			}
-			wgThreads.Wait()
-			result = strings.Join(threadsSlice, "")
-			out <- result
-		}(&wg, out, data)
+		}(v.(int))
 	}
 	wg.Wait()
 }
 
+// singleHashOf - SingleHash одного значения: crc32(data)~crc32(md5(data)).
+// Его же считают CachedSigner и TypedSingleHash. false - ctx отменили, не
+// дождавшись подписей, зависшие подписи так и остаются в своих горутинах
+func singleHashOf(ctx context.Context, primary Hasher, md5Gate *serialHasher, data string) (string, bool) {
+	// свои каналы на каждое значение, иначе результаты соседей перепутаются.
+	// С буфером getAlgo не ждет чтения и выходит сам
+	crc32Receiver := make(chan string, 1)
+	crc32WithMd5Receiver := make(chan string, 1)
+	// crc32(data) не ждет очереди к md5
+	go getAlgo(crc32Receiver, primary, data)
+	md5, ok := md5Gate.Hash(ctx, data)
+	if !ok {
+		return "", false
+	}
+	go getAlgo(crc32WithMd5Receiver, primary, md5)
+	crc32, ok := recvHash(ctx, crc32Receiver)
+	if !ok {
+		return "", false
+	}
+	crc32WithMd5, ok := recvHash(ctx, crc32WithMd5Receiver)
+	if !ok {
+		return "", false
+	}
+	result := crc32 + "~" + crc32WithMd5
+	fmt.Printf("%v SingleHash data %v\n", data, data)
+	fmt.Printf("%v SingleHash md5(data) %v\n", data, md5)
+	fmt.Printf("%v SingleHash crc32(md5(data)) %v\n", data, crc32WithMd5)
+	fmt.Printf("%v SingleHash crc32(data) %v\n", data, crc32)
+	fmt.Printf("%v SingleHash result %v\n", data, result)
+	return result, true
+}
+
+// recvHash ждет подпись от getAlgo, пока ctx не отменен
+func recvHash(ctx context.Context, ch chan string) (string, bool) {
+	select {
+	case hash := <-ch:
+		return hash, true
+	case <-ctx.Done():
+		return "", false
+	}
+}
+
+const (
+	// multiHashThreads - сколько crc32 считается на одно значение в MultiHash
+	multiHashThreads    = 6
+	maxMultiHashThreads = 64
+)
+
+// MultiHash - MultiHashN на 6 потоков, как в задании
+var MultiHash = MultiHashN(multiHashThreads)
+
+// MultiHashN - MultiHash на threads потоков: на каждое значение считается
+// crc32(th+data) для th от 0 до threads-1, и они склеиваются по порядку th.
+// Паникует на threads вне 1..64, с ошибкой вместо паники - NewMultiHashJob
+func MultiHashN(threads int) job {
+	j, err := NewMultiHashJob(threads)
+	if err != nil {
+		panic(err)
+	}
+	return j
+}
+
+// NewMultiHashJob - MultiHashN, который проверяет threads
+func NewMultiHashJob(threads int) (job, error) {
+	return NewMultiHashJobWithHasher(threads, CRC32Hasher{})
+}
+
+// NewMultiHashJobWithHasher - NewMultiHashJob с primary вместо crc32
+func NewMultiHashJobWithHasher(threads int, primary Hasher) (job, error) {
+	if threads < 1 || threads > maxMultiHashThreads {
+		return nil, fmt.Errorf("multihash threads must be from 1 to %d, got %d", maxMultiHashThreads, threads)
+	}
+	return func(ctx context.Context, in, out chan interface{}) {
+		// значения считаются параллельно, каждое - своим FanOut по th
+		FanOut(MaxInputDataLen, func(ctx context.Context, in, out chan interface{}) {
+			multiHashOne(ctx, threads, primary, in, out)
+		})(ctx, in, out)
+	}, nil
+}
+
+type multiHashThread struct {
+	th   int
+	hash string
+}
+
+func multiHashOne(ctx context.Context, threads int, primary Hasher, in, out chan interface{}) {
+	for {
+		v, ok := recv(ctx, in)
+		if !ok {
+			return
+		}
+		if !send(ctx, out, multiHashOf(ctx, threads, primary, v.(string))) {
+			return
+		}
+	}
+}
+
+// multiHashOf - MultiHash одного значения: crc32(th+data) по всем th, склеенные
+// по порядку. Его же считают CachedSigner и TypedMultiHash
+func multiHashOf(ctx context.Context, threads int, primary Hasher, data string) string {
+	ths := make(chan interface{}, threads)
+	for th := 0; th < threads; th++ {
+		ths <- th
+	}
+	close(ths)
+	results := make(chan interface{}, threads)
+	FanOut(threads, JobFromFunc(func(in, out chan interface{}) {
+		for v := range in {
+			th := v.(int)
+			hash := primary.Hash(strconv.Itoa(th) + data)
+			fmt.Printf("%v MultiHash: crc32(th+step1) %v %v\n", data, th, hash)
+			out <- multiHashThread{th: th, hash: hash}
+		}
+	}))(ctx, ths, results)
+	close(results)
+
+	threadsSlice := make([]string, threads)
+	for r := range results {
+		thread := r.(multiHashThread)
+		threadsSlice[thread.th] = thread.hash
+	}
+	return strings.Join(threadsSlice, "")
+}
+
+// combineResults - NewCombineResults с DefaultCombineOpts, они всегда проходят проверку
+var combineResults, _ = NewCombineResults(DefaultCombineOpts)
+
+// CombineResults - NewCombineResults с DefaultCombineOpts
 func CombineResults(in, out chan interface{}) {
-	var result string
-	var sl []string
-	for v := range in {
-		hash := v.(string)
-		sl = append(sl, hash)
-	}
-	sort.Strings(sl)
-	result = strings.Join(sl, "_")
-	fmt.Println("CombineResults", result)
-	out <- result
+	combineResults(context.Background(), in, out)
 }
 
 //func SingleHashSync(data int) string {
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// TestSoak гоняет конвейер непрерывно и следит, чтобы горутины и куча не росли.
+// Запускается только с SIGNER_SOAK=<длительность>, например
+//
+//	SIGNER_SOAK=5m go test -run TestSoak -timeout 10m
+//
+// Первая четверть времени - прогрев, дальше каждый замер сравнивается с базовым
+func TestSoak(t *testing.T) {
+	raw := os.Getenv("SIGNER_SOAK")
+	if raw == "" {
+		t.Skip("set SIGNER_SOAK to a duration to run the soak test")
+	}
+	duration, err := time.ParseDuration(raw)
+	if err != nil {
+		t.Fatalf("SIGNER_SOAK: %v", err)
+	}
+	const (
+		itemsPerRun       = 50
+		sampleEvery       = 2 * time.Second
+		goroutineSlack    = 10
+		heapGrowthPercent = 50
+		heapSlack         = 4 << 20
+	)
+	withFastSigners(t)
+
+	// SingleHash и CombineResults печатают каждый шаг, на часах работы это гигабайты
+	stdout := os.Stdout
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		devNull.Close()
+	}()
+
+	sample := func() (int, uint64) {
+		runtime.GC()
+		var stats runtime.MemStats
+		runtime.ReadMemStats(&stats)
+		return runtime.NumGoroutine(), stats.HeapAlloc
+	}
+
+	var runs, items int
+	var baseGoroutines int
+	var baseHeap uint64
+	start := time.Now()
+	warmUp := start.Add(duration / 4)
+	nextSample := start.Add(sampleEvery)
+	for time.Since(start) < duration {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			ExecutePipeline(context.Background(),
+				JobFromFunc(func(in, out chan interface{}) {
+					for i := 0; i < itemsPerRun; i++ {
+						out <- runs*itemsPerRun + i
+					}
+				}),
+				JobFromFunc(SingleHash),
+				MultiHash,
+				JobFromFunc(func(in, out chan interface{}) {
+					for range in {
+						items++
+					}
+				}),
+			)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("pipeline run %d did not finish, %d goroutines alive", runs, runtime.NumGoroutine())
+		}
+		runs++
+
+		if time.Now().Before(nextSample) {
+			continue
+		}
+		nextSample = time.Now().Add(sampleEvery)
+		goroutines, heap := sample()
+		switch {
+		case time.Now().Before(warmUp):
+			continue
+		case baseHeap == 0:
+			baseGoroutines, baseHeap = goroutines, heap
+			t.Logf("baseline after %d runs: %d goroutines, %d bytes of heap", runs, goroutines, heap)
+		case goroutines > baseGoroutines+goroutineSlack:
+			t.Fatalf("goroutines grew from %d to %d after %d runs", baseGoroutines, goroutines, runs)
+		case heap > baseHeap+baseHeap*heapGrowthPercent/100+heapSlack:
+			t.Fatalf("heap grew from %d to %d bytes after %d runs", baseHeap, heap, runs)
+		}
+	}
+
+	if items != runs*itemsPerRun {
+		t.Errorf("expected %d items through the pipeline, got %d", runs*itemsPerRun, items)
+	}
+	t.Logf("%d runs, %d items in %v", runs, items, time.Since(start).Round(time.Second))
+}
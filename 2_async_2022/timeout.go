@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrStageTimeout - job не уложился в WithTimeout
+var ErrStageTimeout = errors.New("stage timed out")
+
+// WithTimeout ограничивает fn по времени: отсчет d начинается с первого значения
+// на входе, а не с запуска. По истечении ctx fn отменяется, job сразу выходит
+// с ErrStageTimeout, закрывая свой out, а то, что еще осталось во входе и что
+// fn успеет написать, дочитывается в фоне и выбрасывается. Ошибку job'ы
+// без ошибок вернуть не могут, поэтому это ErrJob для ExecutePipelineErr.
+// fn, который не смотрит на ctx и висит, так и останется висеть, но конвейер
+// его уже не ждет
+func WithTimeout(d time.Duration, fn job) ErrJob {
+	return func(ctx context.Context, in, out chan interface{}) error {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		// свои каналы у fn, чтобы он не писал в out после нашего выхода
+		fnIn, fnOut := make(chan interface{}), make(chan interface{})
+		go func() {
+			defer close(fnOut)
+			fn(ctx, fnIn, fnOut)
+		}()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+		defer func() {
+			if timer != nil {
+				timer.Stop()
+			}
+		}()
+		var inV, outV interface{}
+		var hasIn, hasOut bool
+		for {
+			// пока значение не отдано, новое не берем: nil каналы выключают case
+			recvIn, sendIn := in, fnIn
+			if hasIn {
+				recvIn = nil
+			} else {
+				sendIn = nil
+			}
+			recvOut, sendOut := fnOut, out
+			if hasOut {
+				recvOut = nil
+			} else {
+				sendOut = nil
+			}
+
+			select {
+			case v, ok := <-recvIn:
+				if !ok {
+					in = nil
+					close(fnIn)
+					continue
+				}
+				if timer == nil {
+					timer = time.NewTimer(d)
+					timeout = timer.C
+				}
+				inV, hasIn = v, true
+			case sendIn <- inV:
+				hasIn = false
+			case v, ok := <-recvOut:
+				if !ok {
+					// fn вышел сам, остаток входа ему уже не нужен
+					if in != nil {
+						for range in {
+						}
+					}
+					return nil
+				}
+				outV, hasOut = v, true
+			case sendOut <- outV:
+				hasOut = false
+			case <-timeout:
+				cancel()
+				if in != nil {
+					close(fnIn)
+					go func(in chan interface{}) {
+						for range in {
+						}
+					}(in)
+				}
+				go func() {
+					for range fnOut {
+					}
+				}()
+				return fmt.Errorf("%w after %s", ErrStageTimeout, d)
+			}
+		}
+	}
+}
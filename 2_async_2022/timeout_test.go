@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	closed := make(chan time.Duration, 1)
+	start := time.Now()
+	err := ExecutePipelineErr(context.Background(),
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) {
+			out <- 1
+			out <- 2
+		})),
+		// медленный job, который не смотрит на ctx
+		WithTimeout(100*time.Millisecond, JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+				time.Sleep(time.Second)
+			}
+		})),
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+			}
+			closed <- time.Since(start)
+		})),
+	)
+	if !errors.Is(err, ErrStageTimeout) {
+		t.Fatalf("expected ErrStageTimeout, got %v", err)
+	}
+	select {
+	case after := <-closed:
+		if after > 300*time.Millisecond {
+			t.Errorf("expected the next stage input closed soon after the timeout, got %s", after)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("the next stage input was not closed")
+	}
+
+	// отсчет идет от первого значения, а не от запуска
+	var got []interface{}
+	err = ExecutePipelineErr(context.Background(),
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) {
+			time.Sleep(150 * time.Millisecond)
+			out <- 1
+		})),
+		WithTimeout(100*time.Millisecond, JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				out <- v
+			}
+		})),
+		ErrJobFromJob(JobFromFunc(func(in, out chan interface{}) {
+			for v := range in {
+				got = append(got, v)
+			}
+		})),
+	)
+	if err != nil || len(got) != 1 {
+		t.Errorf("expected the stage to finish in time, got %v and %v", got, err)
+	}
+}
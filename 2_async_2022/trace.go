@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TraceDirection - значение вошло в job или вышло из него
+type TraceDirection string
+
+const (
+	TraceIn  TraceDirection = "in"
+	TraceOut TraceDirection = "out"
+)
+
+// TraceEvent - одно значение на входе или выходе job'а. ItemID растет с каждым
+// событием во всем процессе, так что по нему видно, в каком порядке что случилось
+type TraceEvent struct {
+	ItemID    uint64
+	Stage     string
+	Direction TraceDirection
+	Value     interface{}
+	At        time.Time
+}
+
+// PipelineTrace копит TraceEvent всех TracingJob конвейера, к которому он
+// подключен через PipelineOptions.TraceCollector
+type PipelineTrace struct {
+	mu     sync.Mutex
+	events []TraceEvent
+}
+
+// Events отдает копию событий в порядке ItemID
+func (pt *PipelineTrace) Events() []TraceEvent {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	return append([]TraceEvent(nil), pt.events...)
+}
+
+// Values отдает значения, прошедшие через job name в направлении dir
+func (pt *PipelineTrace) Values(name string, dir TraceDirection) []interface{} {
+	var values []interface{}
+	for _, e := range pt.Events() {
+		if e.Stage == name && e.Direction == dir {
+			values = append(values, e.Value)
+		}
+	}
+	return values
+}
+
+type traceCollectorKey struct{}
+
+var traceItemID uint64
+
+// TracingJob пишет в slog.Debug каждое значение на входе и выходе fn с
+// новым ItemID, а если у конвейера есть TraceCollector, то и в него
+func TracingJob(name string, fn job) job {
+	return func(ctx context.Context, in, out chan interface{}) {
+		collector, _ := ctx.Value(traceCollectorKey{}).(*PipelineTrace)
+		trace := func(dir TraceDirection, v interface{}) {
+			// под мьютексом коллектора, чтобы события в нем шли по порядку ItemID
+			if collector != nil {
+				collector.mu.Lock()
+				defer collector.mu.Unlock()
+			}
+			e := TraceEvent{ItemID: atomic.AddUint64(&traceItemID, 1), Stage: name, Direction: dir, Value: v, At: time.Now()}
+			slog.DebugContext(ctx, "pipeline item", "stage", name, "direction", string(dir), "item_id", e.ItemID, "value", v)
+			if collector != nil {
+				collector.events = append(collector.events, e)
+			}
+		}
+
+		fnIn, fnOut := make(chan interface{}), make(chan interface{})
+		go func() {
+			defer close(fnIn)
+			for v := range in {
+				trace(TraceIn, v)
+				fnIn <- v
+			}
+		}()
+		fnDone := make(chan struct{})
+		go func() {
+			defer close(fnDone)
+			fn(ctx, fnIn, fnOut)
+			close(fnOut)
+			// fn мог выйти, не дочитав вход
+			for range fnIn {
+			}
+		}()
+		for v := range fnOut {
+			trace(TraceOut, v)
+			out <- v
+		}
+		<-fnDone
+	}
+}
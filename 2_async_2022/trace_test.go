@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestTracingJob(t *testing.T) {
+	withFastSigners(t)
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	inputs := []int{0, 1, 1, 2, 3, 5, 8}
+	trace := &PipelineTrace{}
+	err := ExecutePipelineWithOptions(context.Background(), PipelineOptions{TraceCollector: trace},
+		JobFromFunc(func(in, out chan interface{}) {
+			for _, v := range inputs {
+				out <- v
+			}
+		}),
+		TracingJob("SingleHash", JobFromFunc(SingleHash)),
+		TracingJob("MultiHash", MultiHash),
+		JobFromFunc(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strs := func(values []interface{}) []string {
+		res := make([]string, len(values))
+		for i, v := range values {
+			res[i] = v.(string)
+		}
+		sort.Strings(res)
+		return res
+	}
+	if n := len(trace.Values("SingleHash", TraceIn)); n != len(inputs) {
+		t.Fatalf("expected %d items into SingleHash, got %d", len(inputs), n)
+	}
+	singleOut, multiIn := strs(trace.Values("SingleHash", TraceOut)), strs(trace.Values("MultiHash", TraceIn))
+	if strings.Join(singleOut, ",") != strings.Join(multiIn, ",") || len(multiIn) != len(inputs) {
+		t.Errorf("items lost between SingleHash and MultiHash: %v vs %v", singleOut, multiIn)
+	}
+	if n := len(trace.Values("MultiHash", TraceOut)); n != len(inputs) {
+		t.Errorf("expected %d items out of MultiHash, got %d", len(inputs), n)
+	}
+
+	events := trace.Events()
+	for i := 1; i < len(events); i++ {
+		if events[i].ItemID <= events[i-1].ItemID {
+			t.Fatalf("item ids must grow: %d after %d", events[i].ItemID, events[i-1].ItemID)
+		}
+	}
+	if n := strings.Count(logs.String(), "stage=MultiHash direction=out"); n != len(inputs) {
+		t.Errorf("expected %d debug lines for MultiHash output, got %d", len(inputs), n)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Stage - типизированный job: читает I из in, пишет O в out. Закрывать out
+// не нужно, это делает тот, кто запустил стадию
+type Stage[I, O any] func(in <-chan I, out chan<- O)
+
+// Pipe2 связывает две стадии каналом B. Первая запускается в своей горутине,
+// ее выход закрывается, когда она вернулась. Если вторая вышла, не дочитав,
+// остаток выхода первой выбрасывается. Возвращается, когда вышли обе
+func Pipe2[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(in <-chan A, out chan<- C) {
+		mid := make(chan B)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer close(mid)
+			first(in, mid)
+		}()
+		second(mid, out)
+		for range mid {
+		}
+		<-done
+	}
+}
+
+// Pipe3 - Pipe2 на три стадии
+func Pipe3[A, B, C, D any](first Stage[A, B], second Stage[B, C], third Stage[C, D]) Stage[A, D] {
+	return Pipe2(Pipe2(first, second), third)
+}
+
+// RunStage отдает stage все items и собирает то, что она написала, дожидаясь ее
+func RunStage[I, O any](stage Stage[I, O], items ...I) []O {
+	in, out := make(chan I), make(chan O)
+	go func() {
+		defer close(in)
+		for _, item := range items {
+			in <- item
+		}
+	}()
+	go func() {
+		defer close(out)
+		stage(in, out)
+		// stage могла выйти, не дочитав вход
+		for range in {
+		}
+	}()
+	var results []O
+	for v := range out {
+		results = append(results, v)
+	}
+	return results
+}
+
+// TypedSingleHash - SingleHash на Stage, считается тем же singleHashOf.
+// Порядок на выходе не сохраняется
+func TypedSingleHash(in <-chan int, out chan<- string) {
+	var wg sync.WaitGroup
+	md5Gate := newSerialHasher(MD5Hasher{}, false)
+	for v := range in {
+		wg.Add(1)
+		go func(data string) {
+			defer wg.Done()
+			single, _ := singleHashOf(context.Background(), CRC32Hasher{}, md5Gate, data)
+			out <- single
+		}(strconv.Itoa(v))
+	}
+	wg.Wait()
+}
+
+// TypedMultiHash - MultiHash на Stage, значения считаются параллельно
+func TypedMultiHash(in <-chan string, out chan<- string) {
+	var wg sync.WaitGroup
+	for single := range in {
+		wg.Add(1)
+		go func(single string) {
+			defer wg.Done()
+			out <- multiHashOf(context.Background(), multiHashThreads, CRC32Hasher{}, single)
+		}(single)
+	}
+	wg.Wait()
+}
+
+// TypedCombineResults - CombineResults на Stage с DefaultCombineOpts
+func TypedCombineResults(in <-chan string, out chan<- string) {
+	var sl []string
+	for v := range in {
+		sl = append(sl, v)
+	}
+	sort.Strings(sl)
+	out <- DefaultCombineOpts.encode(sl)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTypedSigner(t *testing.T) {
+	withFastSigners(t)
+	got := RunStage(Pipe3(TypedSingleHash, TypedMultiHash, TypedCombineResults), 0, 1, 1, 2, 3, 5, 8)
+	if len(got) != 1 || got[0] != signerExpected {
+		t.Errorf("results not match\nGot: %v\nExpected: %v", got, signerExpected)
+	}
+}
+
+func TestPipe2(t *testing.T) {
+	itoa := Stage[int, string](func(in <-chan int, out chan<- string) {
+		for v := range in {
+			out <- strconv.Itoa(v)
+		}
+	})
+	// вторая стадия берет одно значение и выходит, первая не должна встать
+	first := Stage[string, string](func(in <-chan string, out chan<- string) {
+		if v, ok := <-in; ok {
+			out <- v + "!"
+		}
+	})
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+	if got := RunStage(Pipe2(itoa, first), items...); len(got) != 1 || got[0] != "0!" {
+		t.Errorf("expected only the first item, got %v", got)
+	}
+}
@@ -0,0 +1,82 @@
+package __async_2023
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CombineOptions - настройки NewCombineResults
+type CombineOptions struct {
+	// Limit - сколько строк отдать после сортировки, 0 без ограничения
+	Limit int
+	// GroupByUser сортирует сначала по владельцу и пишет его в начало строки:
+	// "user@example.com: true 123". Владелец есть только в UserMsgData
+	GroupByUser bool
+}
+
+type CombineOption func(*CombineOptions)
+
+// Limit оставляет первые n строк, n <= 0 снимает ограничение
+func Limit(n int) CombineOption {
+	return func(o *CombineOptions) {
+		if n < 0 {
+			n = 0
+		}
+		o.Limit = n
+	}
+}
+
+// GroupByUser группирует строки по владельцу письма, группы идут по email
+func GroupByUser() CombineOption {
+	return func(o *CombineOptions) {
+		o.GroupByUser = true
+	}
+}
+
+// NewCombineResults собирает CombineResults с опциями. Без опций это тот же
+// CombineResults: спам раньше, внутри по id. Одинаковые письма остаются в том
+// порядке, в каком пришли. Принимает MsgData и UserMsgData
+func NewCombineResults(opts ...CombineOption) cmd {
+	var o CombineOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(in, out chan interface{}) {
+		var results []UserMsgData
+		for v := range in {
+			msgData, ok := v.(UserMsgData)
+			if !ok {
+				msgData.MsgData = v.(MsgData)
+			}
+			results = append(results, msgData)
+		}
+		for _, line := range o.lines(results) {
+			out <- line
+		}
+	}
+}
+
+// lines сортирует results и превращает их в строки выдачи
+func (o CombineOptions) lines(results []UserMsgData) []string {
+	sort.SliceStable(results, func(i, j int) bool {
+		if o.GroupByUser && results[i].User.Email != results[j].User.Email {
+			return results[i].User.Email < results[j].User.Email
+		}
+		if results[i].HasSpam != results[j].HasSpam {
+			return results[i].HasSpam
+		}
+		return results[i].ID < results[j].ID
+	})
+	if o.Limit > 0 && len(results) > o.Limit {
+		results = results[:o.Limit]
+	}
+	lines := make([]string, len(results))
+	for i, result := range results {
+		if o.GroupByUser {
+			lines[i] = fmt.Sprintf("%s: %t %d", result.User.Email, result.HasSpam, result.ID)
+			continue
+		}
+		lines[i] = fmt.Sprintf("%t %d", result.HasSpam, result.ID)
+	}
+	return lines
+}
@@ -0,0 +1,113 @@
+package __async_2023
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCatMsgData(data []UserMsgData, withUser bool) cmd {
+	return func(in, out chan interface{}) {
+		for _, d := range data {
+			if withUser {
+				out <- d
+			} else {
+				out <- d.MsgData
+			}
+		}
+	}
+}
+
+func TestNewCombineResults(t *testing.T) {
+	a, b := User{Email: "a@mail.ru"}, User{Email: "b@mail.ru"}
+	data := []UserMsgData{
+		{MsgData{ID: 5, HasSpam: false}, b},
+		{MsgData{ID: 3, HasSpam: true}, b},
+		{MsgData{ID: 7, HasSpam: true}, a},
+		{MsgData{ID: 3, HasSpam: true}, a},
+		{MsgData{ID: 1, HasSpam: false}, a},
+	}
+	run := func(opts ...CombineOption) []string {
+		var got []string
+		RunPipeline(newCatMsgData(data, true), NewCombineResults(opts...), newCollectStrings(&got))
+		return got
+	}
+
+	// обычные MsgData от SelectMessages
+	var old []string
+	RunPipeline(newCatMsgData(data, false), CombineResults, newCollectStrings(&old))
+	assert.Equal(t, []string{"true 3", "true 3", "true 7", "false 1", "false 5"}, old)
+	assert.Equal(t, old, run())
+
+	assert.Equal(t, []string{"true 3", "true 3"}, run(Limit(2)))
+	assert.Equal(t, old, run(Limit(0)))
+	assert.Equal(t, old, run(Limit(100)))
+
+	// одинаковые письма разных юзеров идут в порядке прихода
+	assert.Equal(t, []string{
+		"a@mail.ru: true 3",
+		"a@mail.ru: true 7",
+		"a@mail.ru: false 1",
+		"b@mail.ru: true 3",
+		"b@mail.ru: false 5",
+	}, run(GroupByUser()))
+	assert.Equal(t, []string{"a@mail.ru: true 3", "a@mail.ru: true 7"}, run(GroupByUser(), Limit(2)))
+}
+
+func TestGroupByUserPipeline(t *testing.T) {
+	stat = Stat{}
+	var grouped []string
+	RunPipeline(
+		cmd(newCatStrings([]string{"harry.dubois@mail.ru", "batman@mail.ru", "d.vader@mail.ru"}, 0)),
+		cmd(SelectUsers),
+		cmd(SelectUserMessages),
+		cmd(CheckSpam),
+		NewCombineResults(GroupByUser()),
+		cmd(newCollectStrings(&grouped)),
+	)
+	// по вызову на юзера, иначе владельцев писем не различить
+	assert.Equal(t, uint32(3), stat.RunGetMessages)
+	assert.Zero(t, stat.ErrorHasSpam)
+
+	var emails []string
+	for _, line := range grouped {
+		email, _, ok := strings.Cut(line, ": ")
+		assert.True(t, ok, line)
+		if len(emails) == 0 || emails[len(emails)-1] != email {
+			emails = append(emails, email)
+		}
+	}
+	assert.True(t, sort.StringsAreSorted(emails), "groups must be sorted by email: %v", emails)
+	assert.Equal(t, []string{"bruce.wayne@mail.ru", "d.vader@mail.ru", "harry.dubois@mail.ru"}, emails)
+	assert.Len(t, grouped, int(stat.RunHasSpam))
+}
+
+func TestSelectUserMessages(t *testing.T) {
+	a, b := User{ID: 1, Email: "a@mail.ru"}, User{ID: 2, Email: "b@mail.ru"}
+	expected := make(map[MsgID]User)
+	for _, u := range []User{a, b} {
+		msgIDs, err := GetMessages(u)
+		assert.NoError(t, err)
+		for _, id := range msgIDs {
+			expected[id] = u
+		}
+	}
+
+	got := make(map[MsgID]User)
+	RunPipeline(
+		func(in, out chan interface{}) {
+			out <- a
+			out <- b
+		},
+		cmd(SelectUserMessages),
+		func(in, out chan interface{}) {
+			for v := range in {
+				msg := v.(UserMsgID)
+				got[msg.ID] = msg.User
+			}
+		},
+	)
+	assert.Equal(t, expected, got)
+}
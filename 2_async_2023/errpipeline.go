@@ -0,0 +1,195 @@
+package __async_2023
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrCmd - стадия, которая может сломаться. Ошибка останавливает весь конвейер
+type ErrCmd func(ctx context.Context, in, out chan interface{}) error
+
+// PipelineError - первая ошибка конвейера, Stage - номер стадии с нуля
+type PipelineError struct {
+	Stage int
+	Err   error
+}
+
+func (e *PipelineError) Error() string {
+	return fmt.Sprintf("stage %d: %v", e.Stage, e.Err)
+}
+
+func (e *PipelineError) Unwrap() error {
+	return e.Err
+}
+
+// CmdWithError - адаптер для обычных cmd, они никогда не ломаются
+func CmdWithError(c cmd) ErrCmd {
+	return func(_ context.Context, in, out chan interface{}) error {
+		c(in, out)
+		return nil
+	}
+}
+
+// RunPipelineErr - RunPipeline, который, как errgroup, на первой ошибке стадии
+// отменяет ctx и закрывает входы остальных, чтобы они дочитали и вышли, и сразу
+// возвращает *PipelineError, не дожидаясь их. Ошибки, случившиеся позже, теряются.
+// Без ошибок ждет все стадии и возвращает ctx.Err()
+func RunPipelineErr(parent context.Context, cmds ...ErrCmd) error {
+	ctx, cancel := context.WithCancel(parent)
+	errs, done := startErrPipeline(ctx, cmds, pipelineRun{})
+	select {
+	case err := <-errs:
+		cancel()
+		return err
+	case <-done:
+		cancel()
+	}
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return parent.Err()
+	}
+}
+
+// RunPipelineWithErrors - RunPipelineErr, который не бросает стадии на первой
+// ошибке. Она так же отменяет ctx и закрывает входы остальных стадий, чтобы они
+// вышли, а то, что еще пишут предыдущие, дочитывается и выбрасывается. Но
+// RunPipelineWithErrors ждет все стадии и возвращает все их ошибки разом через
+// errors.Join, каждую как *PipelineError, по порядку стадий. Без ошибок
+// возвращает ctx.Err()
+func RunPipelineWithErrors(parent context.Context, cmds ...ErrCmd) error {
+	return runPipelineWithErrors(parent, pipelineRun{}, cmds)
+}
+
+func runPipelineWithErrors(parent context.Context, run pipelineRun, cmds []ErrCmd) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	errs, done := startErrPipeline(ctx, cmds, run)
+
+	var all []*PipelineError
+	for running := true; running; {
+		select {
+		case err := <-errs:
+			cancel()
+			all = append(all, err)
+		case <-done:
+			running = false
+		}
+	}
+	// стадии вышли, все ошибки уже в буфере
+	for len(errs) > 0 {
+		all = append(all, <-errs)
+	}
+	if len(all) == 0 {
+		return parent.Err()
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Stage < all[j].Stage })
+	joined := make([]error, len(all))
+	for i, err := range all {
+		joined[i] = err
+	}
+	return errors.Join(joined...)
+}
+
+// pipelineRun - чем отличаются запуски конвейера. bufs[i] - буфер выхода
+// стадии i, как PipelineOptions.StageBufs. progress, если задан, - учет
+// прогресса каждой стадии для RunPipelineWithHeartbeat
+type pipelineRun struct {
+	bufs     []int
+	progress []*stageProgress
+}
+
+// buf - буфер выхода стадии i, у последней выход никто не читает
+func (run pipelineRun) buf(i, stages int) int {
+	if i+1 >= stages || i >= len(run.bufs) {
+		return 0
+	}
+	return run.bufs[i]
+}
+
+func (run pipelineRun) stage(i int) *stageProgress {
+	if run.progress == nil {
+		return nil
+	}
+	return run.progress[i]
+}
+
+// startErrPipeline запускает стадии, связывая их через forward. Через него
+// идут все запуски конвейера. done закрывается, когда вышли все стадии и
+// forward, errs получает ошибки стадий, места хватит всем
+func startErrPipeline(ctx context.Context, cmds []ErrCmd, run pipelineRun) (<-chan *PipelineError, <-chan struct{}) {
+	errs := make(chan *PipelineError, len(cmds))
+	wg := &sync.WaitGroup{}
+
+	in := make(chan interface{})
+	stopFirst := make(chan struct{})
+	go func(first chan interface{}) {
+		// первый вход никто не пишет, его закрывает только отмена
+		select {
+		case <-ctx.Done():
+			close(first)
+		case <-stopFirst:
+		}
+	}(in)
+	for i, c := range cmds {
+		out := make(chan interface{}, run.buf(i, len(cmds)))
+		wg.Add(1)
+		go func(i int, c ErrCmd, in, out chan interface{}) {
+			defer wg.Done()
+			defer close(out)
+			if err := c(ctx, in, out); err != nil {
+				errs <- &PipelineError{Stage: i, Err: err}
+			}
+		}(i, c, in, out)
+		if i+1 < len(cmds) {
+			next := make(chan interface{})
+			wg.Add(1)
+			go func(from, to chan interface{}, upstream, downstream *stageProgress) {
+				defer wg.Done()
+				forward(ctx, from, to, upstream, downstream)
+			}(out, next, run.stage(i), run.stage(i+1))
+			in = next
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(stopFirst)
+		close(done)
+	}()
+	return errs, done
+}
+
+// forward передает значения между стадиями до отмены ctx, после нее закрывает
+// to и дочитывает from, чтобы предыдущая стадия не встала на записи.
+// upstream и downstream - учет прогресса стадий по обе стороны, может быть nil
+func forward(ctx context.Context, from, to chan interface{}, upstream, downstream *stageProgress) {
+	defer func() {
+		for range from {
+		}
+	}()
+	defer close(to)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case v, ok := <-from:
+			if !ok {
+				return
+			}
+			upstream.sent()
+			downstream.pending()
+			select {
+			case to <- v:
+				downstream.taken()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
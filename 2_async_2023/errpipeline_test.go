@@ -0,0 +1,160 @@
+package __async_2023
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPipelineErr(t *testing.T) {
+	errTooMany := errors.New("too many users")
+	var slowDone int32
+
+	start := time.Now()
+	err := RunPipelineErr(context.Background(),
+		func(ctx context.Context, in, out chan interface{}) error {
+			for i := 0; ; i++ {
+				select {
+				case out <- User{ID: uint64(i)}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		},
+		func(ctx context.Context, in, out chan interface{}) error {
+			for v := range in {
+				if v.(User).ID == 5 {
+					return errTooMany
+				}
+				out <- v
+			}
+			return nil
+		},
+		CmdWithError(func(in, out chan interface{}) {
+			for range in {
+			}
+			time.Sleep(200 * time.Millisecond)
+			atomic.StoreInt32(&slowDone, 1)
+		}),
+	)
+
+	var pErr *PipelineError
+	assert.True(t, errors.As(err, &pErr), "ожидали PipelineError, а получили %v", err)
+	assert.Equal(t, 1, pErr.Stage)
+	assert.ErrorIs(t, err, errTooMany)
+	assert.Less(t, time.Since(start), 100*time.Millisecond,
+		"ошибка должна возвращаться, не дожидаясь остальных стадий")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&slowDone))
+
+	// у последней стадии закрыли вход, и она завершилась сама
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&slowDone) == 1 }, time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, RunPipelineErr(context.Background(),
+		CmdWithError(newCatStrings([]string{"a", "b"}, 0)),
+		CmdWithError(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	))
+}
+
+func TestRunPipelineWithErrors(t *testing.T) {
+	errTooMany := errors.New("too many users")
+	errIncomplete := errors.New("incomplete input")
+	var sent, producerDone int32
+
+	result := make(chan error, 1)
+	go func() {
+		result <- RunPipelineWithErrors(context.Background(),
+			// производитель не смотрит ни на что и пишет до конца
+			func(_ context.Context, in, out chan interface{}) error {
+				for i := 0; i < 1000; i++ {
+					out <- User{ID: uint64(i)}
+					atomic.AddInt32(&sent, 1)
+				}
+				atomic.StoreInt32(&producerDone, 1)
+				return nil
+			},
+			func(_ context.Context, in, out chan interface{}) error {
+				for v := range in {
+					if v.(User).ID == 5 {
+						return errTooMany
+					}
+					out <- v
+				}
+				return nil
+			},
+			func(_ context.Context, in, out chan interface{}) error {
+				var n int
+				for range in {
+					n++
+				}
+				if n < 1000 {
+					return errIncomplete
+				}
+				return nil
+			},
+		)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(2 * time.Second):
+		t.Fatal("pipeline deadlocked on a producer after a stage error")
+	}
+	assert.ErrorIs(t, err, errTooMany)
+	assert.ErrorIs(t, err, errIncomplete)
+	assert.Equal(t, "stage 1: too many users\nstage 2: incomplete input", err.Error())
+	// ошибка не бросает производителя: его записи дочитываются до конца
+	assert.Equal(t, int32(1), atomic.LoadInt32(&producerDone))
+	assert.Equal(t, int32(1000), atomic.LoadInt32(&sent))
+
+	assert.NoError(t, RunPipelineWithErrors(context.Background(),
+		func(_ context.Context, in, out chan interface{}) error {
+			out <- "a"
+			return nil
+		},
+		func(_ context.Context, in, out chan interface{}) error {
+			for range in {
+			}
+			return nil
+		},
+	))
+}
+
+func TestRunPipelineWithErrorsDone(t *testing.T) {
+	errBroken := errors.New("broken")
+	// внешний вызов, который сам не ответит никогда
+	external := make(chan struct{})
+
+	result := make(chan error, 1)
+	go func() {
+		result <- RunPipelineWithErrors(context.Background(),
+			func(ctx context.Context, in, out chan interface{}) error {
+				select {
+				case <-external:
+					return nil
+				case <-ctx.Done():
+					return context.Canceled
+				}
+			},
+			func(_ context.Context, in, out chan interface{}) error {
+				return errBroken
+			},
+		)
+	}()
+
+	var err error
+	select {
+	case err = <-result:
+	case <-time.After(time.Second):
+		t.Fatal("a stage waiting on an external call did not see ctx cancel")
+	}
+	assert.ErrorIs(t, err, errBroken)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,169 @@
+package __async_2023
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// StageHeartbeat - состояние одной стадии на момент heartbeat'а
+type StageHeartbeat struct {
+	Name string
+	// In, Out - сколько элементов стадия взяла и отдала с прошлого heartbeat'а
+	In, Out uint64
+	// Pending - на входе стадии лежит элемент, который она еще не забрала
+	Pending bool
+	// Idle - сколько прошло с последнего взятого или отданного элемента
+	Idle time.Duration
+}
+
+// defaultHeartbeatInterval - Interval, если он не задан
+const defaultHeartbeatInterval = time.Second
+
+type HeartbeatConfig struct {
+	// Interval <= 0 заменяется на defaultHeartbeatInterval
+	Interval time.Duration
+	// StallAfter - через сколько без прогресса при непустом входе стадия считается зависшей
+	StallAfter time.Duration
+	// OnHeartbeat и OnStall по умолчанию пишут в лог
+	OnHeartbeat func([]StageHeartbeat)
+	OnStall     func(StageHeartbeat)
+}
+
+type stageProgress struct {
+	name         string
+	in, out      uint64
+	lastProgress int64
+	pendingSince int64
+}
+
+func (sp *stageProgress) touch() {
+	atomic.StoreInt64(&sp.lastProgress, time.Now().UnixNano())
+}
+
+func cmdName(c cmd, i int) string {
+	name := runtime.FuncForPC(reflect.ValueOf(c).Pointer()).Name()
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	if name == "" || strings.HasPrefix(name, "func") {
+		return fmt.Sprintf("stage%d", i)
+	}
+	return name
+}
+
+// sent - стадия отдала элемент, forward его забрал
+func (sp *stageProgress) sent() {
+	if sp == nil {
+		return
+	}
+	atomic.AddUint64(&sp.out, 1)
+	sp.touch()
+}
+
+// pending - forward держит элемент для стадии, пока она его не заберет
+func (sp *stageProgress) pending() {
+	if sp == nil {
+		return
+	}
+	atomic.StoreInt64(&sp.pendingSince, time.Now().UnixNano())
+}
+
+// taken - стадия забрала элемент со входа
+func (sp *stageProgress) taken() {
+	if sp == nil {
+		return
+	}
+	atomic.StoreInt64(&sp.pendingSince, 0)
+	atomic.AddUint64(&sp.in, 1)
+	sp.touch()
+}
+
+// RunPipelineWithHeartbeat - RunPipeline, который раз в Interval сообщает о
+// прогрессе каждой стадии и предупреждает о зависших: тех, у кого на входе
+// элемент ждет дольше StallAfter, а сама стадия ничего не брала и не отдавала.
+// стадии без входа просто простаивают и зависшими не считаются
+func RunPipelineWithHeartbeat(cfg HeartbeatConfig, cmds ...cmd) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultHeartbeatInterval
+	}
+	if cfg.OnHeartbeat == nil {
+		cfg.OnHeartbeat = logHeartbeat
+	}
+	if cfg.OnStall == nil {
+		cfg.OnStall = func(hb StageHeartbeat) {
+			log.Printf("stall: %s has pending input and no progress for %v", hb.Name, hb.Idle.Round(time.Millisecond))
+		}
+	}
+
+	now := time.Now().UnixNano()
+	stages := make([]*stageProgress, len(cmds))
+	for i, c := range cmds {
+		stages[i] = &stageProgress{name: cmdName(c, i), lastProgress: now}
+	}
+
+	stop := make(chan struct{})
+	monitorDone := make(chan struct{})
+	go func() {
+		defer close(monitorDone)
+		monitorStages(cfg, stages, stop)
+	}()
+	runPipeline(pipelineRun{progress: stages}, cmds)
+	close(stop)
+	<-monitorDone
+}
+
+func monitorStages(cfg HeartbeatConfig, stages []*stageProgress, stop <-chan struct{}) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	prevIn := make([]uint64, len(stages))
+	prevOut := make([]uint64, len(stages))
+	stalled := make([]bool, len(stages))
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			beats := make([]StageHeartbeat, len(stages))
+			for i, sp := range stages {
+				in, out := atomic.LoadUint64(&sp.in), atomic.LoadUint64(&sp.out)
+				pendingSince := atomic.LoadInt64(&sp.pendingSince)
+				beats[i] = StageHeartbeat{
+					Name:    sp.name,
+					In:      in - prevIn[i],
+					Out:     out - prevOut[i],
+					Pending: pendingSince != 0,
+					Idle:    now.Sub(time.Unix(0, atomic.LoadInt64(&sp.lastProgress))),
+				}
+				prevIn[i], prevOut[i] = in, out
+
+				// об одном зависании предупреждаем один раз, до следующего прогресса
+				waiting := beats[i].Pending && now.Sub(time.Unix(0, pendingSince)) > cfg.StallAfter
+				if waiting && beats[i].Idle > cfg.StallAfter {
+					if !stalled[i] {
+						cfg.OnStall(beats[i])
+					}
+					stalled[i] = true
+				} else {
+					stalled[i] = false
+				}
+			}
+			cfg.OnHeartbeat(beats)
+		}
+	}
+}
+
+func logHeartbeat(beats []StageHeartbeat) {
+	parts := make([]string, len(beats))
+	for i, hb := range beats {
+		parts[i] = fmt.Sprintf("%s in=%d out=%d", hb.Name, hb.In, hb.Out)
+		if hb.Pending {
+			parts[i] += " pending"
+		}
+	}
+	log.Printf("heartbeat: %s", strings.Join(parts, " | "))
+}
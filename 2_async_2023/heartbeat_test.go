@@ -0,0 +1,86 @@
+package __async_2023
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func slowStage(in, out chan interface{}) {
+	for v := range in {
+		time.Sleep(150 * time.Millisecond)
+		out <- v
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	mu := &sync.Mutex{}
+	var stalls []string
+	var beats int
+	received := map[string]uint64{}
+
+	RunPipelineWithHeartbeat(HeartbeatConfig{
+		Interval:   10 * time.Millisecond,
+		StallAfter: 60 * time.Millisecond,
+		OnHeartbeat: func(hbs []StageHeartbeat) {
+			mu.Lock()
+			defer mu.Unlock()
+			beats++
+			for _, hb := range hbs {
+				received[hb.Name] += hb.In
+			}
+		},
+		OnStall: func(hb StageHeartbeat) {
+			mu.Lock()
+			defer mu.Unlock()
+			stalls = append(stalls, hb.Name)
+		},
+	},
+		cmd(func(in, out chan interface{}) {
+			for i := 0; i < 3; i++ {
+				out <- i
+			}
+		}),
+		cmd(slowStage),
+		cmd(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+
+	mu.Lock()
+	defer mu.Unlock()
+	// медленная стадия зависает на втором и третьем элементе, а простаивающая
+	// после нее стадия без входа зависшей не считается
+	assert.Equal(t, []string{"slowStage", "slowStage"}, stalls)
+	assert.Greater(t, beats, 10)
+	// последний heartbeat мог не успеть до конца конвейера
+	assert.LessOrEqual(t, received["stage2"], uint64(3))
+	assert.Equal(t, uint64(0), received["stage0"])
+
+	beatsAfterRun := beats
+	mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	mu.Lock()
+	assert.Equal(t, beatsAfterRun, beats, "monitor must stop with the pipeline")
+}
+
+// с нулевым Interval time.NewTicker паниковал
+func TestHeartbeatZeroInterval(t *testing.T) {
+	var got []interface{}
+	assert.NotPanics(t, func() {
+		RunPipelineWithHeartbeat(HeartbeatConfig{},
+			cmd(func(in, out chan interface{}) {
+				out <- 1
+			}),
+			cmd(func(in, out chan interface{}) {
+				for v := range in {
+					got = append(got, v)
+				}
+			}),
+		)
+	})
+	assert.Equal(t, []interface{}{1}, got)
+}
@@ -0,0 +1,75 @@
+package __async_2023
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPipelineWithOptions(t *testing.T) {
+	written := make(chan struct{})
+	var got []string
+	err := RunPipelineWithOptions(PipelineOptions{StageBufs: []int{3}},
+		cmd(func(in, out chan interface{}) {
+			newCatStrings([]string{"a", "b", "c"}, 0)(in, out)
+			close(written)
+		}),
+		// без буфера источник встал бы на втором значении
+		cmd(func(in, out chan interface{}) {
+			select {
+			case <-written:
+			case <-time.After(time.Second):
+				t.Error("source blocked on a buffered stage")
+			}
+			newCollectStrings(&got)(in, out)
+		}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, got)
+
+	assert.Error(t, RunPipelineWithOptions(PipelineOptions{StageBufs: []int{-1}}))
+}
+
+// benchCmds - 10 команд, где каждая вторая заметно медленнее соседей
+func benchCmds(n int) []cmd {
+	cmds := []cmd{func(in, out chan interface{}) {
+		for i := 0; i < n; i++ {
+			out <- uint64(i)
+		}
+	}}
+	for s := 1; s < 9; s++ {
+		work := 10
+		if s%2 == 0 {
+			work = 2000
+		}
+		cmds = append(cmds, func(in, out chan interface{}) {
+			for v := range in {
+				x := v.(uint64)
+				for i := 0; i < work; i++ {
+					x = x*31 + 7
+				}
+				out <- x
+			}
+		})
+	}
+	return append(cmds, func(in, out chan interface{}) {
+		for range in {
+		}
+	})
+}
+
+func BenchmarkRunPipeline(b *testing.B) {
+	for _, buf := range []int{0, 1, 16, 128} {
+		bufs := make([]int, 9)
+		for i := range bufs {
+			bufs[i] = buf
+		}
+		b.Run(fmt.Sprintf("buf=%d", buf), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				RunPipelineWithOptions(PipelineOptions{StageBufs: bufs}, benchCmds(1000)...)
+			}
+		})
+	}
+}
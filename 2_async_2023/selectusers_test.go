@@ -0,0 +1,67 @@
+package __async_2023
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// запускать с -race: SelectUsers из двух конвейеров с общим SeenUsers
+func TestSelectUsersSharedSeen(t *testing.T) {
+	var emails []string
+	for i := 0; i < 300; i++ {
+		emails = append(emails, fmt.Sprintf("user%d@mail.ru", i%40))
+	}
+	emails = append(emails, "batman@mail.ru", "bruce.wayne@mail.ru", "spiderman@mail.ru", "peter.parker@mail.ru")
+
+	seen := NewMemSeenUsers()
+	var mu sync.Mutex
+	counts := make(map[uint64]int)
+	collect := func(in, out chan interface{}) {
+		for v := range in {
+			mu.Lock()
+			counts[v.(User).ID]++
+			mu.Unlock()
+		}
+	}
+
+	wg := &sync.WaitGroup{}
+	for _, part := range [][]string{emails[:len(emails)/2], emails[len(emails)/2:]} {
+		wg.Add(1)
+		go func(part []string) {
+			defer wg.Done()
+			RunPipeline(cmd(newCatStrings(part, 0)), NewSelectUsers(seen), collect)
+		}(part)
+	}
+	wg.Wait()
+
+	assert.Len(t, counts, 42)
+	for id, n := range counts {
+		assert.Equal(t, 1, n, "юзер %d отдан больше одного раза", id)
+	}
+}
+
+// раньше повтор юзера звал Unlock у незалоченного мьютекса и ронял тест
+func TestSelectUsersSameUser(t *testing.T) {
+	emails := make([]string, 1000)
+	for i := range emails {
+		emails[i] = "bruce.wayne@mail.ru"
+		if i%2 == 1 {
+			emails[i] = "batman@mail.ru"
+		}
+	}
+
+	var users []User
+	assert.NotPanics(t, func() {
+		RunPipeline(cmd(newCatStrings(emails, 0)), cmd(SelectUsers), func(in, out chan interface{}) {
+			for v := range in {
+				users = append(users, v.(User))
+			}
+		})
+	})
+	if assert.Len(t, users, 1) {
+		assert.Equal(t, "bruce.wayne@mail.ru", users[0].Email)
+	}
+}
@@ -1,50 +1,94 @@
 package __async_2023
 
 import (
+	"context"
 	"fmt"
 	"log"
-	"sort"
 	"sync"
 )
 
 func RunPipeline(cmds ...cmd) {
-	in := make(chan interface{})
-	wg := &sync.WaitGroup{}
-	for _, c := range cmds {
-		wg.Add(1)
-		out := make(chan interface{})
-		go func(c cmd, in, out chan interface{}) {
-			defer wg.Done()
-			defer close(out)
-			c(in, out)
-		}(c, in, out)
-		in = out
+	runPipeline(pipelineRun{}, cmds)
+}
+
+// PipelineOptions - настройки RunPipelineWithOptions. StageBufs[i] - буфер
+// канала между командами i и i+1, недостающие каналы без буфера
+type PipelineOptions struct {
+	StageBufs []int
+}
+
+// RunPipelineWithOptions - RunPipeline с буферами между командами, чтобы быстрая
+// команда не ждала медленную следующую на каждом значении
+func RunPipelineWithOptions(opts PipelineOptions, cmds ...cmd) error {
+	for i, n := range opts.StageBufs {
+		if n < 0 {
+			return fmt.Errorf("stage %d: buffer size cannot be %d", i, n)
+		}
 	}
-	wg.Wait()
+	runPipeline(pipelineRun{bufs: opts.StageBufs}, cmds)
+	return nil
 }
 
-func SelectUsers(in, out chan interface{}) {
-	wg := &sync.WaitGroup{}
-	mu := &sync.Mutex{}
-	processedUsers := make(map[uint64]struct{})
+// runPipeline запускает обычные cmd через runPipelineWithErrors
+func runPipeline(run pipelineRun, cmds []cmd) {
+	errCmds := make([]ErrCmd, len(cmds))
+	for i, c := range cmds {
+		errCmds[i] = CmdWithError(c)
+	}
+	// обычные cmd не ломаются, ошибки тут быть не может
+	_ = runPipelineWithErrors(context.Background(), run, errCmds)
+}
 
-	for v := range in {
-		wg.Add(1)
-		go func(email string) {
-			defer wg.Done()
-			defer mu.Unlock()
-			user := GetUser(email)
+// SeenUsers - набор уже отданных юзеров для SelectUsers. Seen отмечает id и
+// говорит, был ли он отмечен раньше. Зовется из разных горутин, так что должен
+// быть потокобезопасным. Общий набор на несколько конвейеров отдает каждого
+// юзера только одному из них
+type SeenUsers interface {
+	Seen(id uint64) bool
+}
 
-			mu.Lock()
-			if _, ok := processedUsers[user.ID]; ok {
-				return
-			}
-			processedUsers[user.ID] = struct{}{}
+// memSeenUsers - SeenUsers в памяти, по умолчанию у каждого SelectUsers свой
+type memSeenUsers struct {
+	mu  sync.Mutex
+	ids map[uint64]struct{}
+}
+
+func NewMemSeenUsers() SeenUsers {
+	return &memSeenUsers{ids: make(map[uint64]struct{})}
+}
 
-			out <- user
-		}(v.(string))
+func (s *memSeenUsers) Seen(id uint64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ids[id]; ok {
+		return true
+	}
+	s.ids[id] = struct{}{}
+	return false
+}
+
+func SelectUsers(in, out chan interface{}) {
+	NewSelectUsers(NewMemSeenUsers())(in, out)
+}
+
+// NewSelectUsers - SelectUsers, который отсеивает повторы через seen
+func NewSelectUsers(seen SeenUsers) cmd {
+	return func(in, out chan interface{}) {
+		wg := &sync.WaitGroup{}
+		for v := range in {
+			wg.Add(1)
+			go func(email string) {
+				defer wg.Done()
+				// GetUser и отправка идут без блокировок, под мьютексом только набор
+				user := GetUser(email)
+				if seen.Seen(user.ID) {
+					return
+				}
+				out <- user
+			}(v.(string))
+		}
+		wg.Wait()
 	}
-	wg.Wait()
 }
 
 func SelectMessages(in, out chan interface{}) {
@@ -88,43 +132,76 @@ func SelectMessages(in, out chan interface{}) {
 	wg.Wait()
 }
 
+// UserMsgID - письмо вместе с владельцем, см. SelectUserMessages
+type UserMsgID struct {
+	ID   MsgID
+	User User
+}
+
+// SelectUserMessages - SelectMessages, который помнит владельца каждого письма
+// и отдает UserMsgID. Из ответа GetMessages на батч не понять, чье письмо,
+// поэтому каждый юзер запрашивается отдельно, запросы идут параллельно
+func SelectUserMessages(in, out chan interface{}) {
+	wg := &sync.WaitGroup{}
+	for v := range in {
+		wg.Add(1)
+		go func(user User) {
+			defer wg.Done()
+			msgIDs, err := GetMessages(user)
+			if err != nil {
+				log.Printf("error: %v", err)
+				return
+			}
+			for _, msgID := range msgIDs {
+				out <- UserMsgID{ID: msgID, User: user}
+			}
+		}(v.(User))
+	}
+	wg.Wait()
+}
+
+// UserMsgData - MsgData вместе с владельцем письма, ее отдает CheckSpam на
+// UserMsgID от SelectUserMessages
+type UserMsgData struct {
+	MsgData
+	User User
+}
+
+// CheckSpam принимает MsgID от SelectMessages и отдает MsgData или UserMsgID
+// от SelectUserMessages и отдает UserMsgData
 func CheckSpam(in, out chan interface{}) {
 	done := make(chan struct{}, HasSpamMaxAsyncRequests)
 	wg := &sync.WaitGroup{}
-	for msgID := range in {
-		id := msgID.(MsgID)
+	for v := range in {
+		msg, withUser := v.(UserMsgID)
+		if !withUser {
+			msg.ID = v.(MsgID)
+		}
 
 		done <- struct{}{}
 		wg.Add(1)
 
-		go func(id MsgID) {
+		go func(msg UserMsgID, withUser bool) {
 			defer func() {
 				<-done
 				wg.Done()
 			}()
-			isSpam, err := HasSpam(id)
+			isSpam, err := HasSpam(msg.ID)
 			if err != nil {
 				log.Printf("error: %v", err)
 				return
 			}
-			out <- MsgData{ID: id, HasSpam: isSpam}
-		}(id)
+			data := MsgData{ID: msg.ID, HasSpam: isSpam}
+			if withUser {
+				out <- UserMsgData{MsgData: data, User: msg.User}
+				return
+			}
+			out <- data
+		}(msg, withUser)
 	}
 	wg.Wait()
 }
 
 func CombineResults(in, out chan interface{}) {
-	var results []MsgData
-	for msgData := range in {
-		results = append(results, msgData.(MsgData))
-	}
-	sort.Slice(results, func(i, j int) bool {
-		if results[i].HasSpam != results[j].HasSpam {
-			return results[i].HasSpam
-		}
-		return results[i].ID < results[j].ID
-	})
-	for _, result := range results {
-		out <- fmt.Sprintf("%t %d", result.HasSpam, result.ID)
-	}
+	NewCombineResults()(in, out)
 }
@@ -0,0 +1,272 @@
+package __async_2023
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+type TenantID string
+
+// Tenanted - конверт, в котором между стадиями Tenants ходит значение клиента:
+// email, User, MsgID, MsgData и строка результата
+type Tenanted struct {
+	Tenant TenantID
+	Value  interface{}
+}
+
+type TenantConfig struct {
+	// MaxSpamRequests - общий лимит параллельных HasSpam на все тенанты,
+	// по умолчанию HasSpamMaxAsyncRequests
+	MaxSpamRequests int
+	// TenantMaxSpamRequests - лимит для отдельных тенантов, остальным
+	// DefaultTenantMaxSpamRequests. 0 - только общий лимит
+	TenantMaxSpamRequests        map[TenantID]int
+	DefaultTenantMaxSpamRequests int
+}
+
+// TenantStat - счетчики одного тенанта
+type TenantStat struct {
+	Emails uint32
+	Users  uint32
+	// Duplicates - email'ы, которые оказались уже выбранным юзером этого тенанта
+	Duplicates uint32
+	Messages   uint32
+	Spam       uint32
+	Errors     uint32
+}
+
+// Tenants - конвейер для нескольких клиентов сразу. источник отдает Tenanted
+// с email'ом, стадии держат дедуп, батчи и счетчики отдельно для каждого
+// тенанта, так что одинаковые user_id и msg_id разных клиентов не смешиваются
+type Tenants struct {
+	cfg TenantConfig
+
+	mu    sync.Mutex
+	stats map[TenantID]*TenantStat
+}
+
+func NewTenants(cfg TenantConfig) *Tenants {
+	if cfg.MaxSpamRequests <= 0 {
+		cfg.MaxSpamRequests = HasSpamMaxAsyncRequests
+	}
+	return &Tenants{cfg: cfg, stats: make(map[TenantID]*TenantStat)}
+}
+
+func (t *Tenants) stat(tenant TenantID) *TenantStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.stats[tenant]
+	if !ok {
+		s = &TenantStat{}
+		t.stats[tenant] = s
+	}
+	return s
+}
+
+// Report - копия счетчиков по тенантам
+func (t *Tenants) Report() map[TenantID]TenantStat {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	report := make(map[TenantID]TenantStat, len(t.stats))
+	for tenant, s := range t.stats {
+		report[tenant] = TenantStat{
+			Emails:     atomic.LoadUint32(&s.Emails),
+			Users:      atomic.LoadUint32(&s.Users),
+			Duplicates: atomic.LoadUint32(&s.Duplicates),
+			Messages:   atomic.LoadUint32(&s.Messages),
+			Spam:       atomic.LoadUint32(&s.Spam),
+			Errors:     atomic.LoadUint32(&s.Errors),
+		}
+	}
+	return report
+}
+
+type tenantUser struct {
+	tenant TenantID
+	id     uint64
+}
+
+func (t *Tenants) SelectUsers(in, out chan interface{}) {
+	wg := &sync.WaitGroup{}
+	mu := &sync.Mutex{}
+	processedUsers := make(map[tenantUser]struct{})
+
+	for v := range in {
+		email := v.(Tenanted)
+		atomic.AddUint32(&t.stat(email.Tenant).Emails, 1)
+		wg.Add(1)
+		go func(tenant TenantID, email string) {
+			defer wg.Done()
+			user := GetUser(email)
+
+			key := tenantUser{tenant: tenant, id: user.ID}
+			mu.Lock()
+			_, dup := processedUsers[key]
+			processedUsers[key] = struct{}{}
+			mu.Unlock()
+			if dup {
+				atomic.AddUint32(&t.stat(tenant).Duplicates, 1)
+				return
+			}
+			atomic.AddUint32(&t.stat(tenant).Users, 1)
+
+			out <- Tenanted{Tenant: tenant, Value: user}
+		}(email.Tenant, email.Value.(string))
+	}
+	wg.Wait()
+}
+
+// SelectMessages собирает батчи отдельно по тенантам: GetMessages отдает
+// письма всего батча одним списком, и по смешанному батчу не понять, чьи они
+func (t *Tenants) SelectMessages(in, out chan interface{}) {
+	wg := &sync.WaitGroup{}
+	send := func(tenant TenantID, batch []User) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			msgIDs, err := GetMessages(batch...)
+			if err != nil {
+				atomic.AddUint32(&t.stat(tenant).Errors, 1)
+				log.Printf("tenant %s error: %v", tenant, err)
+				return
+			}
+			atomic.AddUint32(&t.stat(tenant).Messages, uint32(len(msgIDs)))
+			for _, msgID := range msgIDs {
+				out <- Tenanted{Tenant: tenant, Value: msgID}
+			}
+		}()
+	}
+
+	batches := make(map[TenantID][]User)
+	for v := range in {
+		user := v.(Tenanted)
+		batch := append(batches[user.Tenant], user.Value.(User))
+		if len(batch) == GetMessagesMaxUsersBatch {
+			send(user.Tenant, batch)
+			batch = nil
+		}
+		batches[user.Tenant] = batch
+	}
+	for tenant, batch := range batches {
+		if len(batch) > 0 {
+			send(tenant, batch)
+		}
+	}
+	wg.Wait()
+}
+
+func (t *Tenants) tenantLimit(tenant TenantID) int {
+	if limit, ok := t.cfg.TenantMaxSpamRequests[tenant]; ok {
+		return limit
+	}
+	return t.cfg.DefaultTenantMaxSpamRequests
+}
+
+// CheckSpam держит общий лимит антибрута и, если задан, лимит тенанта,
+// чтобы один большой клиент не занимал все запросы
+func (t *Tenants) CheckSpam(in, out chan interface{}) {
+	global := make(chan struct{}, t.cfg.MaxSpamRequests)
+	perTenant := make(map[TenantID]chan struct{})
+	wg := &sync.WaitGroup{}
+	for v := range in {
+		msg := v.(Tenanted)
+		sem, ok := perTenant[msg.Tenant]
+		if !ok {
+			if limit := t.tenantLimit(msg.Tenant); limit > 0 {
+				sem = make(chan struct{}, limit)
+			}
+			perTenant[msg.Tenant] = sem
+		}
+
+		wg.Add(1)
+		// сначала свой лимит, потом общий: ждущий своей очереди тенант
+		// не держит общий слот
+		go func(tenant TenantID, id MsgID, sem chan struct{}) {
+			defer wg.Done()
+			if sem != nil {
+				sem <- struct{}{}
+				defer func() { <-sem }()
+			}
+			global <- struct{}{}
+			isSpam, err := HasSpam(id)
+			<-global
+			if err != nil {
+				atomic.AddUint32(&t.stat(tenant).Errors, 1)
+				log.Printf("tenant %s error: %v", tenant, err)
+				return
+			}
+			if isSpam {
+				atomic.AddUint32(&t.stat(tenant).Spam, 1)
+			}
+			out <- Tenanted{Tenant: tenant, Value: MsgData{ID: id, HasSpam: isSpam}}
+		}(msg.Tenant, msg.Value.(MsgID), sem)
+	}
+	wg.Wait()
+}
+
+// CombineResults отдает секции по тенантам в порядке их id, внутри секции
+// строки "<has_spam> <msg_id>" в том же порядке, что и CombineResults
+func (t *Tenants) CombineResults(in, out chan interface{}) {
+	results := make(map[TenantID][]MsgData)
+	for v := range in {
+		msg := v.(Tenanted)
+		results[msg.Tenant] = append(results[msg.Tenant], msg.Value.(MsgData))
+	}
+	tenants := make([]TenantID, 0, len(results))
+	for tenant := range results {
+		tenants = append(tenants, tenant)
+	}
+	sort.Slice(tenants, func(i, j int) bool { return tenants[i] < tenants[j] })
+
+	for _, tenant := range tenants {
+		section := results[tenant]
+		sort.Slice(section, func(i, j int) bool {
+			if section[i].HasSpam != section[j].HasSpam {
+				return section[i].HasSpam
+			}
+			return section[i].ID < section[j].ID
+		})
+		for _, result := range section {
+			out <- Tenanted{Tenant: tenant, Value: fmt.Sprintf("%t %d", result.HasSpam, result.ID)}
+		}
+	}
+}
+
+// NewTenantFiles - последняя стадия, которая пишет результат каждого тенанта
+// в свой файл dir/<tenant>.txt. первую ошибку записи отдает в errp
+func NewTenantFiles(dir string, errp *error) cmd {
+	return func(in, out chan interface{}) {
+		files := make(map[TenantID]*os.File)
+		defer func() {
+			for _, f := range files {
+				if err := f.Close(); err != nil && *errp == nil {
+					*errp = err
+				}
+			}
+		}()
+		for v := range in {
+			line := v.(Tenanted)
+			if *errp != nil {
+				continue
+			}
+			f, ok := files[line.Tenant]
+			if !ok {
+				var err error
+				f, err = os.Create(filepath.Join(dir, string(line.Tenant)+".txt"))
+				if err != nil {
+					*errp = err
+					continue
+				}
+				files[line.Tenant] = f
+			}
+			if _, err := fmt.Fprintln(f, line.Value); err != nil {
+				*errp = err
+			}
+		}
+	}
+}
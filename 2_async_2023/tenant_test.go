@@ -0,0 +1,81 @@
+package __async_2023
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newCatTenants(emails map[TenantID][]string) func(in, out chan interface{}) {
+	return func(in, out chan interface{}) {
+		for tenant, list := range emails {
+			for _, email := range list {
+				out <- Tenanted{Tenant: tenant, Value: email}
+			}
+		}
+	}
+}
+
+// у тенантов общие юзеры, а значит и одинаковые user_id и msg_id,
+// но результаты и счетчики у каждого свои
+func TestTenants(t *testing.T) {
+	inputData := map[TenantID][]string{
+		"acme": {
+			"harry.dubois@mail.ru",
+			"batman@mail.ru",
+			"bruce.wayne@mail.ru",
+		},
+		"globex": {
+			"harry.dubois@mail.ru",
+			"bruce.wayne@mail.ru",
+			"d.vader@mail.ru",
+		},
+	}
+
+	dir := t.TempDir()
+	var writeErr error
+	tenants := NewTenants(TenantConfig{TenantMaxSpamRequests: map[TenantID]int{"acme": 2}})
+	stat = Stat{}
+	timeStart := time.Now()
+	RunPipeline(
+		cmd(newCatTenants(inputData)),
+		cmd(tenants.SelectUsers),
+		cmd(tenants.SelectMessages),
+		cmd(tenants.CheckSpam),
+		cmd(tenants.CombineResults),
+		cmd(NewTenantFiles(dir, &writeErr)),
+	)
+	assert.Less(t, time.Since(timeStart), 4*time.Second)
+	assert.NoError(t, writeErr)
+
+	results := map[TenantID][]string{}
+	for tenant := range inputData {
+		data, err := os.ReadFile(filepath.Join(dir, string(tenant)+".txt"))
+		assert.NoError(t, err)
+		results[tenant] = strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	globex := map[string]bool{}
+	for _, line := range results["globex"] {
+		globex[line] = true
+	}
+	for _, line := range results["acme"] {
+		assert.True(t, globex[line], "общие юзеры должны дать одинаковые письма, %q нет у globex", line)
+	}
+	assert.Greater(t, len(results["globex"]), len(results["acme"]),
+		"письма d.vader@mail.ru должны попасть только к globex")
+
+	report := tenants.Report()
+	acme, globexStat := report["acme"], report["globex"]
+	assert.Equal(t, TenantStat{Emails: 3, Users: 2, Duplicates: 1}, TenantStat{Emails: acme.Emails, Users: acme.Users, Duplicates: acme.Duplicates})
+	assert.Equal(t, TenantStat{Emails: 3, Users: 3}, TenantStat{Emails: globexStat.Emails, Users: globexStat.Users, Duplicates: globexStat.Duplicates})
+	assert.Equal(t, uint32(len(results["acme"])), acme.Messages)
+	assert.Equal(t, uint32(len(results["globex"])), globexStat.Messages)
+	assert.Zero(t, acme.Errors+globexStat.Errors)
+	// батчи не смешивают тенантов: по одному на пару юзеров и на остаток
+	assert.Equal(t, uint32(3), stat.RunGetMessages)
+	assert.Zero(t, stat.ErrorHasSpam)
+}
@@ -0,0 +1,70 @@
+package __async_2023
+
+// Stage - типизированный cmd: читает I из in, пишет O в out. Закрывать out
+// не нужно, это делает тот, кто запустил стадию
+type Stage[I, O any] func(in <-chan I, out chan<- O)
+
+// Pipe2 связывает две стадии каналом B. Первая запускается в своей горутине,
+// ее выход закрывается, когда она вернулась. Если вторая вышла, не дочитав,
+// остаток выхода первой выбрасывается. Возвращается, когда вышли обе
+func Pipe2[A, B, C any](first Stage[A, B], second Stage[B, C]) Stage[A, C] {
+	return func(in <-chan A, out chan<- C) {
+		mid := make(chan B)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			defer close(mid)
+			first(in, mid)
+		}()
+		second(mid, out)
+		for range mid {
+		}
+		<-done
+	}
+}
+
+// Pipe3 - Pipe2 на три стадии
+func Pipe3[A, B, C, D any](first Stage[A, B], second Stage[B, C], third Stage[C, D]) Stage[A, D] {
+	return Pipe2(Pipe2(first, second), third)
+}
+
+// RunStage отдает stage все items и собирает то, что она написала, дожидаясь ее
+func RunStage[I, O any](stage Stage[I, O], items ...I) []O {
+	in, out := make(chan I), make(chan O)
+	go func() {
+		defer close(in)
+		for _, item := range items {
+			in <- item
+		}
+	}()
+	go func() {
+		defer close(out)
+		stage(in, out)
+		// stage могла выйти, не дочитав вход
+		for range in {
+		}
+	}()
+	var results []O
+	for v := range out {
+		results = append(results, v)
+	}
+	return results
+}
+
+// TypedCombineResults - NewCombineResults на Stage. Письма без владельца -
+// UserMsgData с пустым User
+func TypedCombineResults(opts ...CombineOption) Stage[UserMsgData, string] {
+	var o CombineOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(in <-chan UserMsgData, out chan<- string) {
+		var results []UserMsgData
+		for msgData := range in {
+			results = append(results, msgData)
+		}
+		for _, line := range o.lines(results) {
+			out <- line
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package __async_2023
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTypedCombineResults(t *testing.T) {
+	double := Stage[MsgID, UserMsgData](func(in <-chan MsgID, out chan<- UserMsgData) {
+		for id := range in {
+			out <- UserMsgData{MsgData: MsgData{ID: id * 2, HasSpam: id%2 == 1}}
+		}
+	})
+	got := RunStage(Pipe2(double, TypedCombineResults()), 4, 1, 3, 2)
+	assert.Equal(t, []string{"true 2", "true 6", "false 4", "false 8"}, got)
+
+	// вторая стадия берет одно значение и выходит, первая не должна встать
+	first := Stage[string, string](func(in <-chan string, out chan<- string) {
+		if v, ok := <-in; ok {
+			out <- v
+		}
+	})
+	bang := Stage[string, string](func(in <-chan string, out chan<- string) {
+		for v := range in {
+			out <- v + "!"
+		}
+	})
+	assert.Equal(t, []string{"a!!"}, RunStage(Pipe3(bang, first, bang), "a", "b", "c", "d"))
+}
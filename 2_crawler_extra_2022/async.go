@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errAsyncWriterClosed = errors.New("async writer is closed")
+
+// asyncOp - строка на запись или, если flushed не nil, запрос на Flush
+type asyncOp struct {
+	data    string
+	flushed chan error
+}
+
+// AsyncWriter пишет в inner из одной фоновой горутины, Write только кладет
+// строку в очередь и ждет, лишь когда очередь заполнена. Первая ошибка inner
+// запоминается и возвращается из всех следующих вызовов
+type AsyncWriter struct {
+	inner DataWriter
+	queue chan asyncOp
+	done  chan struct{}
+
+	// closeMu держат на чтение, пока кладут в queue, чтобы Close не закрыл ее под ними
+	closeMu sync.RWMutex
+	closed  bool
+
+	errMu sync.Mutex
+	err   error
+}
+
+func NewAsyncWriter(inner DataWriter, bufSize int) *AsyncWriter {
+	aw := &AsyncWriter{
+		inner: inner,
+		queue: make(chan asyncOp, bufSize),
+		done:  make(chan struct{}),
+	}
+	go aw.loop()
+	return aw
+}
+
+func (aw *AsyncWriter) loop() {
+	defer close(aw.done)
+	for op := range aw.queue {
+		if op.flushed != nil {
+			if err := aw.inner.Flush(); err != nil {
+				aw.setErr(err)
+			}
+			op.flushed <- aw.lastErr()
+			continue
+		}
+		// после ошибки строки пропускаются, порядок в файле уже нарушен
+		if aw.lastErr() != nil {
+			continue
+		}
+		if err := aw.inner.Write(op.data); err != nil {
+			aw.setErr(err)
+		}
+	}
+}
+
+func (aw *AsyncWriter) setErr(err error) {
+	aw.errMu.Lock()
+	defer aw.errMu.Unlock()
+	if aw.err == nil {
+		aw.err = err
+	}
+}
+
+func (aw *AsyncWriter) lastErr() error {
+	aw.errMu.Lock()
+	defer aw.errMu.Unlock()
+	return aw.err
+}
+
+func (aw *AsyncWriter) Write(data string) error {
+	return aw.WriteCtx(context.Background(), data)
+}
+
+// WriteCtx перестает ждать места в очереди, когда ctx отменен, строка тогда не пишется
+func (aw *AsyncWriter) WriteCtx(ctx context.Context, data string) error {
+	if err := aw.lastErr(); err != nil {
+		return err
+	}
+	aw.closeMu.RLock()
+	defer aw.closeMu.RUnlock()
+	if aw.closed {
+		return errAsyncWriterClosed
+	}
+	select {
+	case aw.queue <- asyncOp{data: data}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush дожидается записи всего, что было в очереди до него, и сбрасывает inner
+func (aw *AsyncWriter) Flush() error {
+	aw.closeMu.RLock()
+	if aw.closed {
+		aw.closeMu.RUnlock()
+		return errAsyncWriterClosed
+	}
+	flushed := make(chan error, 1)
+	aw.queue <- asyncOp{flushed: flushed}
+	aw.closeMu.RUnlock()
+	return <-flushed
+}
+
+// Close сбрасывает очередь, останавливает горутину и закрывает inner
+func (aw *AsyncWriter) Close() error {
+	flushErr := aw.Flush()
+	if errors.Is(flushErr, errAsyncWriterClosed) {
+		return nil
+	}
+	aw.closeMu.Lock()
+	if aw.closed {
+		aw.closeMu.Unlock()
+		return nil
+	}
+	aw.closed = true
+	close(aw.queue)
+	aw.closeMu.Unlock()
+	<-aw.done
+
+	if err := aw.inner.Close(); err != nil && flushErr == nil {
+		return err
+	}
+	return flushErr
+}
+
+// Empty нужен TSVWriter для заголовка, его спрашивают до первой записи, пока горутина простаивает
+func (aw *AsyncWriter) Empty() bool {
+	if ew, ok := aw.inner.(emptyWriter); ok {
+		return ew.Empty()
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// slowWriter - memWriter, который долго пишет и может сломаться на строке failAt
+type slowWriter struct {
+	mu sync.Mutex
+	memWriter
+	delay  time.Duration
+	failAt int
+}
+
+func (sw *slowWriter) Write(data string) error {
+	time.Sleep(sw.delay)
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	if sw.failAt > 0 && len(sw.lines)+1 == sw.failAt {
+		return errors.New("disk full")
+	}
+	return sw.memWriter.Write(data)
+}
+
+func (sw *slowWriter) snapshot() (lines []string, flushes int, closed bool) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return append([]string(nil), sw.lines...), sw.flushes, sw.closed
+}
+
+func TestAsyncWriter(t *testing.T) {
+	inner := &slowWriter{delay: 5 * time.Millisecond}
+	aw := NewAsyncWriter(inner, 100)
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if err := aw.Write(fmt.Sprintf("line %d\n", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Errorf("Write must not wait for the inner writer, took %s", elapsed)
+	}
+	if err := aw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines, flushes, _ := inner.snapshot()
+	if len(lines) != 20 || flushes != 1 {
+		t.Fatalf("expected 20 lines and a flush after Flush, got %d and %d", len(lines), flushes)
+	}
+	for i, line := range lines {
+		if line != fmt.Sprintf("line %d\n", i) {
+			t.Errorf("lines out of order at %d: %q", i, line)
+		}
+	}
+
+	if err := aw.Write("last\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines, flushes, closed := inner.snapshot(); len(lines) != 21 || flushes != 2 || !closed {
+		t.Errorf("expected Close to flush the queue and close the writer, got %d lines, %d flushes, closed=%v", len(lines), flushes, closed)
+	}
+	if err := aw.Write("late\n"); !errors.Is(err, errAsyncWriterClosed) {
+		t.Errorf("expected errAsyncWriterClosed, got %v", err)
+	}
+	if err := aw.Close(); err != nil {
+		t.Errorf("second Close must be a no-op, got %v", err)
+	}
+}
+
+func TestAsyncWriterError(t *testing.T) {
+	inner := &slowWriter{failAt: 3}
+	aw := NewAsyncWriter(inner, 10)
+	for i := 0; i < 5; i++ {
+		aw.Write("line\n")
+	}
+	if err := aw.Flush(); err == nil || err.Error() != "disk full" {
+		t.Errorf("expected the write error from Flush, got %v", err)
+	}
+	if err := aw.Write("line\n"); err == nil {
+		t.Errorf("expected the error to stick")
+	}
+	if err := aw.Close(); err == nil {
+		t.Errorf("expected the error from Close")
+	}
+	if lines, _, closed := inner.snapshot(); len(lines) != 2 || !closed {
+		t.Errorf("expected writes to stop after the error and the writer to be closed, got %d lines, closed=%v", len(lines), closed)
+	}
+}
+
+func TestAsyncWritersConcurrent(t *testing.T) {
+	inner := &slowWriter{}
+	aw := NewAsyncWriter(inner, 4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := aw.Write(fmt.Sprintf("%d-%d\n", g, i)); err != nil {
+					t.Error(err)
+				}
+				if i%10 == 0 {
+					aw.Flush()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines, _, _ := inner.snapshot(); len(lines) != 400 {
+		t.Errorf("expected 400 lines, got %d", len(lines))
+	}
+}
+
+func TestWriteCtx(t *testing.T) {
+	inner := &slowWriter{delay: 200 * time.Millisecond}
+	aw := NewAsyncWriter(inner, 1)
+	// первая строка уходит в горутину, вторая занимает очередь
+	aw.Write("first\n")
+	aw.Write("second\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := aw.WriteCtx(ctx, "third\n"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("WriteCtx must not wait for the queue after the deadline, took %v", elapsed)
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines, _, _ := inner.snapshot(); len(lines) != 2 {
+		t.Errorf("cancelled line must not be written, got %q", lines)
+	}
+
+	// writer'ы без WriteCtx тоже не пишут после отмены
+	mw := &memWriter{}
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	if err := WriteCtx(cancelled, mw, "line\n"); !errors.Is(err, context.Canceled) || len(mw.lines) != 0 {
+		t.Errorf("expected cancelled write to be dropped, got %v %q", err, mw.lines)
+	}
+	wm := newJSONWriters(mw)
+	defer wm.Close()
+	if err := wm.WriteRecordCtx(cancelled, Record{URL: "http://example.com", Category: "good_site"}); !errors.Is(err, context.Canceled) || len(mw.lines) != 0 {
+		t.Errorf("expected manager to drop the record, got %v %q", err, mw.lines)
+	}
+}
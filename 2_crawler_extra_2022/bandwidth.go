@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// bandwidthChunks - на сколько кусков делится секундный бюджет, чтобы
+// одновременные загрузки чередовались, а не ждали друг друга целиком
+const bandwidthChunks = 20
+
+// BandwidthWindow задает лимит на часы [FromHour, ToHour), окно может
+// переходить через полночь, например с 22 до 7
+type BandwidthWindow struct {
+	FromHour    int
+	ToHour      int
+	BytesPerSec int64
+}
+
+func (bw BandwidthWindow) contains(hour int) bool {
+	if bw.FromHour <= bw.ToHour {
+		return hour >= bw.FromHour && hour < bw.ToHour
+	}
+	return hour >= bw.FromHour || hour < bw.ToHour
+}
+
+// BandwidthLimiter - общий на все загрузки лимит байт в секунду.
+// Тела ответов читаются кусками, и каждый кусок получает следующий
+// свободный слот по очереди, так что большая страница не забирает весь канал.
+// Лимит 0 значит без ограничений, считаются байты в любом случае
+type BandwidthLimiter struct {
+	mu       sync.Mutex
+	limit    int64
+	schedule []BandwidthWindow
+	next     time.Time
+	bytes    uint64
+}
+
+func NewBandwidthLimiter(bytesPerSec int64) *BandwidthLimiter {
+	return &BandwidthLimiter{limit: bytesPerSec}
+}
+
+// SetLimit меняет лимит на лету, он действует вне окон расписания
+func (bl *BandwidthLimiter) SetLimit(bytesPerSec int64) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.limit = bytesPerSec
+}
+
+// SetSchedule задает лимиты по часам, первое подошедшее окно выигрывает
+func (bl *BandwidthLimiter) SetSchedule(windows []BandwidthWindow) {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.schedule = append([]BandwidthWindow(nil), windows...)
+}
+
+// Bytes - сколько байт тел ответов прочитано
+func (bl *BandwidthLimiter) Bytes() uint64 {
+	return atomic.LoadUint64(&bl.bytes)
+}
+
+func (bl *BandwidthLimiter) limitAt(t time.Time) int64 {
+	for _, window := range bl.schedule {
+		if window.contains(t.Hour()) {
+			return window.BytesPerSec
+		}
+	}
+	return bl.limit
+}
+
+// chunk - сколько можно прочитать за раз при текущем лимите
+func (bl *BandwidthLimiter) chunk() int64 {
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	limit := bl.limitAt(time.Now())
+	if limit <= 0 {
+		return 0
+	}
+	if chunk := limit / bandwidthChunks; chunk > 0 {
+		return chunk
+	}
+	return 1
+}
+
+// reserve учитывает n прочитанных байт и возвращает, сколько ждать до конца их слота
+func (bl *BandwidthLimiter) reserve(n int) time.Duration {
+	atomic.AddUint64(&bl.bytes, uint64(n))
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	now := time.Now()
+	limit := bl.limitAt(now)
+	if limit <= 0 {
+		return 0
+	}
+	if bl.next.Before(now) {
+		bl.next = now
+	}
+	bl.next = bl.next.Add(time.Duration(int64(n) * int64(time.Second) / limit))
+
+	return bl.next.Sub(now)
+}
+
+func (bl *BandwidthLimiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, limiter: bl}
+}
+
+type throttledReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *BandwidthLimiter
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if chunk := tr.limiter.chunk(); chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := tr.r.Read(p)
+	if n == 0 {
+		return n, err
+	}
+
+	wait := tr.limiter.reserve(n)
+	if wait <= 0 {
+		return n, err
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return n, err
+	case <-tr.ctx.Done():
+		return n, tr.ctx.Err()
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBandwidthLimiter(t *testing.T) {
+	const (
+		bodySize = 100 << 10
+		limit    = 200 << 10
+	)
+	body := "<html><head><title>big</title></head><body>" + strings.Repeat("x", bodySize) + "</body></html>"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: 5 * time.Second}, RPS: 1000, Workers: 2, BytesPerSec: limit, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	finished := make([]time.Duration, 2)
+	var wg sync.WaitGroup
+	for i := range finished {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := c.fetchPage(context.Background(), &Site{Url: srv.URL}); err != nil {
+				t.Error(err)
+			}
+			finished[i] = time.Since(start)
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	// два тела по 100KB при 200KB/s - около секунды
+	if elapsed < 900*time.Millisecond || elapsed > 2*time.Second {
+		t.Errorf("expected ~1s for %d bytes at %d B/s, took %v", 2*len(body), limit, elapsed)
+	}
+	report := c.buildReport(elapsed, nil)
+	if report.BytesRead != uint64(2*len(body)) {
+		t.Errorf("expected %d bytes read, got %d", 2*len(body), report.BytesRead)
+	}
+	if report.BytesPerSec > limit*1.1 {
+		t.Errorf("measured %.0f B/s over the %d B/s limit", report.BytesPerSec, limit)
+	}
+	// при честном дележе обе загрузки заканчиваются почти одновременно,
+	// а не одна за половину времени
+	for i, d := range finished {
+		if d < elapsed*8/10 {
+			t.Errorf("download %d finished at %v of %v, bandwidth was not shared", i, d, elapsed)
+		}
+	}
+}
+
+func TestBandwidthSchedule(t *testing.T) {
+	bl := NewBandwidthLimiter(100)
+	bl.SetSchedule([]BandwidthWindow{
+		{FromHour: 22, ToHour: 7, BytesPerSec: 0},
+		{FromHour: 12, ToHour: 14, BytesPerSec: 50},
+	})
+
+	at := func(hour int) time.Time {
+		return time.Date(2024, 1, 1, hour, 30, 0, 0, time.Local)
+	}
+	cases := []struct {
+		hour  int
+		limit int64
+	}{
+		{23, 0},
+		{3, 0},
+		{7, 100},
+		{12, 50},
+		{14, 100},
+	}
+	for _, tc := range cases {
+		if got := bl.limitAt(at(tc.hour)); got != tc.limit {
+			t.Errorf("hour %d: expected limit %d, got %d", tc.hour, tc.limit, got)
+		}
+	}
+
+	bl.SetLimit(300)
+	if got := bl.limitAt(at(9)); got != 300 {
+		t.Errorf("expected limit 300 after SetLimit, got %d", got)
+	}
+}
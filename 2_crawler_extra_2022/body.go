@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultMaxBodyBytes = 5 << 20
+
+// decodeBody снимает gzip или deflate. Accept-Encoding мы ставим сами,
+// поэтому транспорт тело не распаковывает. deflate на практике бывает
+// и в zlib-обертке, и голым потоком, понимаем оба
+func decodeBody(resp *http.Response, body io.Reader) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		return gzip.NewReader(body)
+	case "deflate":
+		br := bufio.NewReader(body)
+		header, err := br.Peek(2)
+		if err == nil && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 && header[0]&0x0f == 8 {
+			return zlib.NewReader(br)
+		}
+		return flate.NewReader(br), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+// bodyLimiter отдает не больше n байт и запоминает, осталось ли что-то после
+type bodyLimiter struct {
+	r         io.Reader
+	n         int64
+	truncated bool
+}
+
+func (bl *bodyLimiter) Read(p []byte) (int, error) {
+	if bl.n <= 0 {
+		var probe [1]byte
+		if n, _ := io.ReadFull(bl.r, probe[:]); n > 0 {
+			bl.truncated = true
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > bl.n {
+		p = p[:bl.n]
+	}
+	n, err := bl.r.Read(p)
+	bl.n -= int64(n)
+	return n, err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func compress(t *testing.T, encoding, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "raw-deflate":
+		w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+	}
+	if _, err := io.WriteString(w, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCompressedBody(t *testing.T) {
+	html := "<html><head><title>compressed</title></head><body>" + strings.Repeat("text ", 1000) + "</body></html>"
+	for _, encoding := range []string{"gzip", "deflate", "raw-deflate"} {
+		t.Run(encoding, func(t *testing.T) {
+			body := compress(t, encoding, html)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+					t.Errorf("unexpected Accept-Encoding %q", r.Header.Get("Accept-Encoding"))
+				}
+				w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+				w.Header().Set("Content-Type", "text/html")
+				w.Write(body)
+			}))
+			defer srv.Close()
+
+			c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := c.fetchPage(context.Background(), &Site{Url: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.meta.Title != "compressed" {
+				t.Errorf("unexpected title %q", p.meta.Title)
+			}
+		})
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	filler := strings.Repeat("x", 64<<10)
+	pages := map[string]string{
+		"/early": "<html><head><title>early</title></head><body>" + filler + "</body></html>",
+		"/late":  "<html><body>" + filler + "</body><head><title>late</title></head></html>",
+		"/small": "<html><head><title>small</title></head></html>",
+	}
+	var served int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.WriteString(w, pages[r.URL.Path])
+		served = int64(n)
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.maxBodyBytes != 5<<20 {
+		t.Errorf("unexpected default MaxBodyBytes %d", c.maxBodyBytes)
+	}
+	c, err = NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, MaxBodyBytes: 4 << 10, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for path, title := range map[string]string{"/early": "early", "/small": "small"} {
+		p, err := c.fetchPage(context.Background(), &Site{Url: srv.URL + path})
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if p.meta.Title != title {
+			t.Errorf("%s: unexpected title %q", path, p.meta.Title)
+		}
+	}
+	if _, err := c.fetchPage(context.Background(), &Site{Url: srv.URL + "/late"}); err == nil || !strings.Contains(err.Error(), "no title in the first 4096 bytes") {
+		t.Errorf("expected over-limit page without early title to fail, got %v", err)
+	}
+	if served <= c.maxBodyBytes {
+		t.Fatalf("fixture is not over the limit: %d bytes", served)
+	}
+	// по лимиту на каждую большую страницу и байт, чтобы понять, что она длиннее
+	if read, max := c.Bandwidth().Bytes(), uint64(2*(c.maxBodyBytes+1)+int64(len(pages["/small"]))); read > max {
+		t.Errorf("read %d bytes, expected at most %d", read, max)
+	}
+}
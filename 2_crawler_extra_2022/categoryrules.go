@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// CategoryRule добавляет сайту категорию, если поле страницы подходит под Regex.
+// Field - имя колонки как в csv: title, description, og_title, url и т.д.,
+// а также Name любого ExtractionRule, например og_type
+type CategoryRule struct {
+	Name        string `json:"name"`
+	Field       string `json:"field"`
+	Regex       string `json:"regex"`
+	AddCategory string `json:"add_category"`
+
+	re *regexp.Regexp
+}
+
+func (cr CategoryRule) label() string {
+	if cr.Name != "" {
+		return cr.Name
+	}
+	return cr.AddCategory
+}
+
+// LoadCategoryRules читает правила из json массива и сразу проверяет их
+func LoadCategoryRules(path string) ([]CategoryRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []CategoryRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("category rules %s: %w", path, err)
+	}
+	if err := compileCategoryRules(rules); err != nil {
+		return nil, fmt.Errorf("category rules %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+func compileCategoryRules(rules []CategoryRule) error {
+	for i := range rules {
+		rule := &rules[i]
+		if rule.Field == "" || rule.Regex == "" || rule.AddCategory == "" {
+			return fmt.Errorf("rule %d: field, regex and add_category are required", i)
+		}
+		re, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return fmt.Errorf("rule %d (%s): %w", i, rule.label(), err)
+		}
+		rule.re = re
+	}
+	return nil
+}
+
+// setCategoryRules проверяет Options.CategoryRules и включает их
+func (c *Crawler) setCategoryRules(rules []CategoryRule) error {
+	rules = append([]CategoryRule(nil), rules...)
+	if err := compileCategoryRules(rules); err != nil {
+		return err
+	}
+	c.categoryRules = rules
+	return nil
+}
+
+// matchCategories возвращает категории, которых у сайта еще нет, и имена сработавших правил
+func (c *Crawler) matchCategories(rec Record, categories []string) (added, fired []string) {
+	for _, rule := range c.categoryRules {
+		if !rule.re.MatchString(recordColumn(rec, rule.Field)) {
+			continue
+		}
+		fired = append(fired, rule.label())
+		if !contains(categories, rule.AddCategory) && !contains(added, rule.AddCategory) {
+			added = append(added, rule.AddCategory)
+		}
+	}
+	return added, fired
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadCategoryRules(t *testing.T) {
+	dir := t.TempDir()
+	cases := map[string]string{
+		"valid":         `[{"name": "gambling", "field": "title", "regex": "(?i)casino|bet", "add_category": "gambling"}]`,
+		"bad regex":     `[{"field": "title", "regex": "casino(", "add_category": "gambling"}]`,
+		"no category":   `[{"field": "title", "regex": "casino"}]`,
+		"not json list": `{"field": "title"}`,
+	}
+	for name, config := range cases {
+		path := filepath.Join(dir, strings.ReplaceAll(name, " ", "_")+".json")
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+		rules, err := LoadCategoryRules(path)
+		if name == "valid" {
+			if err != nil || len(rules) != 1 || rules[0].re == nil {
+				t.Errorf("%s: expected a compiled rule, got %v, %v", name, rules, err)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewCrawler(Options{RPS: 1, Workers: 1, CategoryRules: []CategoryRule{{Field: "title", Regex: "[", AddCategory: "x"}}}); err == nil {
+		t.Errorf("expected NewCrawler to reject an invalid category rule regex")
+	}
+}
+
+func TestCategoryRules(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/casino", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>Best Casino Bets</title><meta property="og:type" content="article"></head></html>`))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>Recipes</title><meta property="og:type" content="website"></head></html>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	rules := append(append([]ExtractionRule(nil), DefaultExtractionRules...), ExtractionRule{Name: "og_type", Selector: "meta[property='og:type']", Attr: "content"})
+	categoryRules := []CategoryRule{
+		{Name: "casino", Field: "title", Regex: "(?i)casino", AddCategory: "gambling"},
+		{Name: "bets", Field: "title", Regex: "(?i)\\bbets?\\b", AddCategory: "gambling"},
+		{Name: "article", Field: "og_type", Regex: "^article$", AddCategory: "news"},
+		{Name: "already there", Field: "url", Regex: "casino", AddCategory: "good_site"},
+	}
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, WriterType: "test-category-rules-json", Status: DefaultStatusPolicy, Rules: rules, CategoryRules: categoryRules})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	writers := map[string]*memWriter{}
+	RegisterWriterFactory("test-category-rules", func(category string) (DataWriter, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		writers[category] = &memWriter{}
+		return writers[category], nil
+	})
+	if err := c.Start(context.Background(), writeSites(t, srv.URL+"/casino", srv.URL+"/plain")); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := map[string][]jsonRecord{}
+	for category, mw := range writers {
+		for _, line := range mw.lines {
+			var rec jsonRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatal(err)
+			}
+			lines[category] = append(lines[category], rec)
+		}
+	}
+	if len(lines) != 3 || len(lines["good_site"]) != 2 || len(lines["gambling"]) != 1 || len(lines["news"]) != 1 {
+		t.Fatalf("unexpected outputs %v", lines)
+	}
+	casino := lines["gambling"][0]
+	if casino.URL != srv.URL+"/casino" || casino.Category != "gambling" {
+		t.Errorf("unexpected gambling record %+v", casino.Record)
+	}
+	if expected := []string{"casino", "bets", "article", "already there"}; !reflect.DeepEqual(casino.Rules, expected) {
+		t.Errorf("expected fired rules %v, got %v", expected, casino.Rules)
+	}
+	for _, rec := range lines["good_site"] {
+		if rec.URL == srv.URL+"/plain" && len(rec.Rules) != 0 {
+			t.Errorf("expected no rules for the plain page, got %v", rec.Rules)
+		}
+	}
+	if expected := map[string]int{"good_site": 2, "gambling": 1, "news": 1}; !reflect.DeepEqual(c.Report().Categories, expected) {
+		t.Errorf("expected category lines %v, got %v", expected, c.Report().Categories)
+	}
+}
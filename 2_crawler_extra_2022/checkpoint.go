@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"time"
+)
+
+const (
+	checkpointSyncInterval = 5 * time.Second
+	// defaultCheckpointPath - файл прогресса для -resume без -checkpoint
+	defaultCheckpointPath = "checkpoint.jsonl"
+
+	statusOK      = "ok"
+	statusSkipped = "skipped"
+	statusFailed  = "failed"
+)
+
+type checkpointRecord struct {
+	URL        string `json:"url"`
+	Status     string `json:"status,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+	DoneAt     int64  `json:"done_at"`
+}
+
+// loadProgress читает обработанные урлы в c.seen, ключ - нормализованный урл,
+// как и при дедупликации
+func (c *Crawler) loadProgress(path string) error {
+	c.seen = make(map[string]struct{})
+
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec checkpointRecord
+		// недописанная при падении последняя строка просто пропускается
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil || rec.URL == "" {
+			continue
+		}
+		if rec.Status == statusFailed {
+			continue
+		}
+		c.seen[urlKey(rec.URL)] = struct{}{}
+	}
+	return scanner.Err()
+}
+
+// openCheckpoint открывает файл прогресса: на дозапись при продолжении в тот же файл,
+// иначе с нуля
+func (c *Crawler) openCheckpoint() error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if c.resumePath == c.checkpointPath {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(c.checkpointPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	c.checkpointWriter = &FileWriter{
+		Writer: bufio.NewWriter(file),
+		File:   file,
+	}
+	c.checkpointSynced = time.Now()
+
+	return nil
+}
+
+// isSeen - сайт уже обработан в прошлом запуске. Такие сайты не попадают
+// в checkSites и не считаются в checkCounter
+func (c *Crawler) isSeen(url string) bool {
+	_, ok := c.seen[urlKey(url)]
+	return ok
+}
+
+// checkpoint отмечает сайт в файле прогресса только после сброса выдачи:
+// иначе после падения сайт числится обработанным, а его строки потеряны,
+// и -resume его больше не обойдет
+func (c *Crawler) checkpoint(url string, siteErr error, writers *WriterManager) error {
+	if c.checkpointPath == "" {
+		return nil
+	}
+	if err := writers.Flush(); err != nil {
+		return fmt.Errorf("site %s is not marked done: %w", url, err)
+	}
+	return c.markDone(url, siteErr)
+}
+
+// markDone пишет итог по сайту в файл прогресса и сбрасывает буфер,
+// fsync делается не чаще checkpointSyncInterval
+func (c *Crawler) markDone(url string, siteErr error) error {
+	rec := checkpointRecord{URL: url, Status: statusOK, DoneAt: time.Now().Unix()}
+	var sErr *HTTPStatusError
+	var robotsErr *RobotsDisallowedError
+	switch {
+	case errors.Is(siteErr, errSiteSkipped), errors.As(siteErr, &robotsErr):
+		rec.Status = statusSkipped
+	case errors.As(siteErr, &sErr):
+		rec.Status, rec.StatusCode = statusFailed, sErr.StatusCode
+	case siteErr != nil:
+		rec.Status = statusFailed
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checkpointWriter == nil {
+		return nil
+	}
+	if err := c.checkpointWriter.Write(string(data) + "\n"); err != nil {
+		return err
+	}
+	if err := c.checkpointWriter.Flush(); err != nil {
+		return err
+	}
+	if time.Since(c.checkpointSynced) >= checkpointSyncInterval {
+		c.checkpointSynced = time.Now()
+		return c.checkpointWriter.File.Sync()
+	}
+	return nil
+}
+
+func (c *Crawler) closeCheckpoint() error {
+	if c.checkpointWriter == nil {
+		return nil
+	}
+	defer func() { c.checkpointWriter = nil }()
+	if err := c.checkpointWriter.Flush(); err != nil {
+		c.checkpointWriter.Close()
+		return err
+	}
+	if err := c.checkpointWriter.File.Sync(); err != nil {
+		c.checkpointWriter.Close()
+		return err
+	}
+	return c.checkpointWriter.Close()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer srv.Close()
+	checkpoint := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+
+	run := func(resume bool, paths ...string) {
+		t.Helper()
+		opts := Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 4, CheckpointPath: checkpoint, Status: DefaultStatusPolicy}
+		if resume {
+			opts.ResumeFrom = checkpoint
+		}
+		c, err := NewCrawler(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		urls := make([]string, len(paths))
+		for i, p := range paths {
+			urls[i] = srv.URL + p
+		}
+		if err := c.Start(context.Background(), writeSites(t, urls...)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run(false, "/a", "/b", "/broken")
+	run(true, "/a#top", "/b", "/broken", "/c")
+
+	expected := map[string]int{"/a": 1, "/b": 1, "/broken": 2, "/c": 1}
+	for path, n := range expected {
+		if hits[path] != n {
+			t.Errorf("expected %s to be fetched %d times, got %d", path, n, hits[path])
+		}
+	}
+
+	// без ResumeFrom файл прогресса начинается заново
+	run(false, "/c")
+	if hits["/c"] != 2 {
+		t.Errorf("expected fresh run to fetch /c again, got %d fetches", hits["/c"])
+	}
+	data, err := os.ReadFile(checkpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rec checkpointRecord
+	if lines := strings.Split(strings.TrimSpace(string(data)), "\n"); len(lines) != 1 {
+		t.Errorf("expected a single record after fresh run, got %q", lines)
+	} else if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil || rec.Status != statusOK {
+		t.Errorf("unexpected record %q", lines[0])
+	}
+}
+
+func TestCheckpointAfterFlush(t *testing.T) {
+	dir := t.TempDir()
+	var written string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/b" {
+			// /a уже отмечен в прогрессе, значит его строка должна быть в файле
+			data, _ := os.ReadFile(filepath.Join(dir, "good_site.tsv"))
+			written = string(data)
+		}
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, WriterType: "file", OutputDir: dir, CheckpointPath: filepath.Join(t.TempDir(), "checkpoint.jsonl"), Status: DefaultStatusPolicy,
+		// без чекпоинта выдача сбросилась бы только при закрытии
+		FlushInterval: -1, FlushLines: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), writeSites(t, srv.URL+"/a", srv.URL+"/b")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(written, srv.URL+"/a") {
+		t.Errorf("expected /a row to be flushed before its checkpoint, file had %q", written)
+	}
+}
+
+func TestCheckpointStatus(t *testing.T) {
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, CheckpointPath: filepath.Join(t.TempDir(), "progress.jsonl"), Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.openCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+	c.markDone("http://example.com/ok", nil)
+	c.markDone("http://example.com/robots", errSiteSkipped)
+	c.markDone("http://example.com/gone", &HTTPStatusError{URL: "http://example.com/gone", StatusCode: 404})
+	if err := c.closeCheckpoint(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.loadProgress(c.checkpointPath); err != nil {
+		t.Fatal(err)
+	}
+	for url, seen := range map[string]bool{
+		"http://EXAMPLE.com/ok":       true,
+		"http://example.com/robots":   true,
+		"http://example.com/gone":     false,
+		"http://example.com/new-site": false,
+	} {
+		if c.isSeen(url) != seen {
+			t.Errorf("%s: expected seen=%v", url, seen)
+		}
+	}
+}
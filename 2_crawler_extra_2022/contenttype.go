@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// sniffBytes - столько байт смотрит http.DetectContentType, больше ему не нужно
+const sniffBytes = 512
+
+// isHTMLContentType - только эти типы уходят в goquery
+func isHTMLContentType(mediaType string) bool {
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml"
+}
+
+// detectContentType берет media type из Content-Type, а если заголовка нет или
+// он не разбирается - угадывает по первым sniffBytes тела. Peek их не съедает,
+// тело потом читается с начала
+func detectContentType(header string, body *bufio.Reader) string {
+	if header != "" {
+		if mediaType, _, err := mime.ParseMediaType(header); err == nil {
+			return mediaType
+		}
+	}
+	head, _ := body.Peek(sniffBytes)
+	mediaType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return mediaType
+}
+
+// nonHTMLPage - ветка fetchAndParse для картинок, pdf и прочего не-html: тело
+// дочитывается в никуда, чтобы соединение вернулось в пул, а в выдачу идет
+// строка с пустыми title/description и типом. В кэш такие страницы не попадают
+func (c *Crawler) nonHTMLPage(resp *http.Response, body io.Reader, contentType string, start time.Time, remoteAddr string) (*page, error) {
+	io.Copy(io.Discard, body)
+
+	latency := time.Since(start)
+	atomic.AddUint64(&c.fetchedCounter, 1)
+	atomic.AddInt64(&c.latencyTotal, int64(latency))
+	return &page{
+		contentType: contentType,
+		nonHTML:     true,
+		statusCode:  resp.StatusCode,
+		fetchedAt:   time.Now(),
+		finalURL:    resp.Request.URL.String(),
+		remoteAddr:  remoteAddr,
+		latency:     latency,
+	}, nil
+}
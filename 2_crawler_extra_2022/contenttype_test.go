@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNonHTMLContent(t *testing.T) {
+	pdf := "%PDF-1.4\n" + strings.Repeat("x", 4096)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG\r\n\x1a\n"))
+		case "/pdf":
+			// без заголовка тип угадывается по началу тела
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte(pdf))
+		case "/sniffed-html":
+			w.Header()["Content-Type"] = nil
+			w.Write([]byte("<html><head><title>Sniffed</title></head></html>"))
+		default:
+			w.Header().Set("Content-Type", "application/xhtml+xml; charset=utf-8")
+			w.Write([]byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Strict</title></head></html>`))
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path, contentType, title string
+		nonHTML                  bool
+	}{
+		{"/image", "image/png", "", true},
+		{"/pdf", "application/pdf", "", true},
+		{"/sniffed-html", "text/html", "Sniffed", false},
+		{"/xhtml", "application/xhtml+xml", "Strict", false},
+	}
+	for _, tc := range cases {
+		p, err := c.fetchPage(context.Background(), &Site{Url: srv.URL + tc.path})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		if p.contentType != tc.contentType || p.nonHTML != tc.nonHTML || p.meta.Title != tc.title {
+			t.Errorf("%s: unexpected page %+v", tc.path, p)
+		}
+	}
+
+	mw := &memWriter{}
+	writers := newJSONWriters(mw)
+	if err := c.checkSite(context.Background(), &Site{Url: srv.URL + "/pdf", Categories: []string{"good_site"}}, writers); err != nil {
+		t.Fatal(err)
+	}
+	var rec jsonRecord
+	if len(mw.lines) != 1 || json.Unmarshal([]byte(mw.lines[0]), &rec) != nil || rec.ContentType != "application/pdf" || rec.Title != "" {
+		t.Errorf("expected a row with the content type and no title, got %q", mw.lines)
+	}
+
+	c.skipNonHTML = true
+	if err := c.checkSite(context.Background(), &Site{Url: srv.URL + "/image", Categories: []string{"good_site"}}, writers); err != errSiteSkipped {
+		t.Errorf("expected errSiteSkipped, got %v", err)
+	}
+	if len(mw.lines) != 1 {
+		t.Errorf("SkipNonHTML must drop the row, got %q", mw.lines)
+	}
+	if report := c.buildReport(time.Second, nil); report.NonHTML != 2 || report.Skipped != 1 {
+		t.Errorf("expected 2 non-html pages and 1 skipped, got %+v", report)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var errNoCookieJar = errors.New("no cookie jar configured")
+
+// SeedCookies кладет куки в Options.CookieJar до начала обхода, например сессию после логина.
+// domain - хост или урл, куки без Domain достанутся только этому хосту
+func (c *Crawler) SeedCookies(domain string, cookies []*http.Cookie) error {
+	if c.cookieJar == nil {
+		return errNoCookieJar
+	}
+	raw := domain
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("seed cookies for %q: %w", domain, err)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("seed cookies for %q: no host", domain)
+	}
+	c.cookieJar.SetCookies(u, cookies)
+	return nil
+}
+
+// warnCookiesRequired - без jar сессионная кука с логина до страниц не доедет
+func (c *Crawler) warnCookiesRequired(sites []*Site) {
+	if c.cookieJar != nil {
+		return
+	}
+	var required int
+	for _, site := range sites {
+		if site.CookiesRequired {
+			required++
+		}
+	}
+	if required > 0 {
+		log.Printf("%d sites require cookies, but no cookie jar is configured", required)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCookieJar(t *testing.T) {
+	var withSession, withoutSession uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err == nil && cookie.Value == "secret" {
+			atomic.AddUint32(&withSession, 1)
+		} else {
+			atomic.AddUint32(&withoutSession, 1)
+		}
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	site := fmt.Sprintf(`{"url": "%s/private", "state": "checked", "categories": ["good_site"], "cookies_required": true}`, srv.URL)
+	if err := os.WriteFile(path, []byte(site+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SeedCookies(u.Host, []*http.Cookie{{Name: "session", Value: "secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if withSession != 1 || withoutSession != 0 {
+		t.Errorf("expected the seeded cookie to be sent, got %d with and %d without", withSession, withoutSession)
+	}
+
+	c, err = NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, NoCookies: true, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SeedCookies(u.Host, []*http.Cookie{{Name: "session", Value: "secret"}}); !errors.Is(err, errNoCookieJar) {
+		t.Errorf("expected errNoCookieJar, got %v", err)
+	}
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if withoutSession != 1 {
+		t.Errorf("expected a request without cookies, got %d", withoutSession)
+	}
+}
+
+func TestCookieSession(t *testing.T) {
+	var sessions uint32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "from-login", Path: "/"})
+		w.Write([]byte("<html><head><title>login</title></head></html>"))
+	})
+	mux.HandleFunc("/content", func(w http.ResponseWriter, r *http.Request) {
+		if cookie, err := r.Cookie("session"); err == nil && cookie.Value == "from-login" {
+			atomic.AddUint32(&sessions, 1)
+		}
+		w.Write([]byte("<html><head><title>content</title></head></html>"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/login", "/content"} {
+		if _, err := c.fetchPage(context.Background(), &Site{Url: srv.URL + path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sessions != 1 {
+		t.Errorf("expected the login cookie on the next request, got %d", sessions)
+	}
+}
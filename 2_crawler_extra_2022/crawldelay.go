@@ -0,0 +1,51 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"time"
+)
+
+// defaultMaxCrawlDelay - Crawl-delay больше этого не ждем, хост пропускается
+const defaultMaxCrawlDelay = time.Minute
+
+// applyCrawlDelay ставит хосту интервал из Crawl-delay, если он строже
+// настроенного. Хосты с задержкой больше MaxCrawlDelay помечаются медленными,
+// и тогда возвращается false - сайт надо пропустить, а не ждать сутки
+func (c *Crawler) applyCrawlDelay(rawURL string, delay time.Duration) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+	host := u.Hostname()
+	max := c.maxCrawlDelay
+	if max <= 0 {
+		max = defaultMaxCrawlDelay
+	}
+	if delay > max {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.slowHosts == nil {
+			c.slowHosts = make(map[string]time.Duration)
+		}
+		if _, ok := c.slowHosts[host]; !ok {
+			log.Printf("%s: Crawl-delay %s is over %s, skipping the host", host, delay, max)
+		}
+		c.slowHosts[host] = delay
+		return false, nil
+	}
+
+	if delay < c.parser.hostLimiter.interval {
+		delay = c.parser.hostLimiter.interval
+	}
+	if err := c.parser.hostLimiter.SetInterval(rawURL, delay); err != nil {
+		return false, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.hostDelays == nil {
+		c.hostDelays = make(map[string]time.Duration)
+	}
+	c.hostDelays[host] = delay
+	return true, nil
+}
@@ -2,12 +2,24 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptrace"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -24,6 +36,19 @@ type Site struct {
 	ForMainPage     bool     `json:"for_main_page"`
 	CategoryAnother *string  `json:"category_another"`
 	Ctime           int64    `json:"ctime"`
+	Proxy           *string  `json:"proxy,omitempty"`
+	// CookiesRequired - сайт отдает контент только с сессионной кукой
+	CookiesRequired bool `json:"cookies_required,omitempty"`
+	// Depth - 0 у исходных сайтов, у найденных по ссылкам - сколько шагов от исходного
+	Depth int `json:"depth,omitempty"`
+	// заполняются после обхода при RecordMeta
+	StatusCode int   `json:"status_code,omitempty"`
+	LatencyMs  int64 `json:"latency_ms,omitempty"`
+
+	// line - строка во входном файле, 0 у сайтов не из файла
+	line int
+	// pending - воркер должен отпустить сайт в pendingWg после обработки
+	pending bool
 }
 
 type DataWriter interface {
@@ -41,52 +66,277 @@ type FileWriter struct {
 	File   *os.File
 }
 
+// statusInterval - как часто Start пишет прогресс в лог
+const statusInterval = time.Second
+
+const defaultUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+
+var errSiteSkipped = errors.New("site skipped")
+
+type page struct {
+	meta       PageMeta
+	fields     []Field
+	statusCode int
+	fetchedAt  time.Time
+	finalURL   string
+	remoteAddr string
+	latency    time.Duration
+	links      []string
+	// contentType - media type ответа, nonHTML - страница не разбиралась goquery
+	contentType string
+	nonHTML     bool
+	// categoryFields - поля по Options.Selectors, nil без них
+	categoryFields map[string][]Field
+}
+
 type parser struct {
-	client         *http.Client
-	requestBuilder func(url string) (*http.Request, error)
+	transport TransportPolicy
+	tlsConfig *tls.Config
+	// forceHTTP2 включает h2 на собранном вручную транспорте
+	forceHTTP2 bool
+	client     *http.Client
+	jar        http.CookieJar
+	// userAgent - под ним сверяемся с robots.txt, это первый из списка
+	userAgent      string
+	agents         *userAgentPicker
+	requestBuilder func(ctx context.Context, site *Site, url string) (*http.Request, error)
 	rateLimit      <-chan time.Time
+	// dns - кэш разрешения имен, nil если выключен
+	dns         *dnsCache
+	hostLimiter *HostRateLimiter
+	retry       RetryPolicy
+	status      StatusPolicy
+	// proxyClients - клиенты под прокси сайтов по адресу прокси
+	proxyMu      sync.Mutex
+	proxyClients map[string]*http.Client
 }
 
 type Crawler struct {
-	mu           sync.Mutex
-	parser       *parser
-	meg          multierror.Group
-	wg           sync.WaitGroup
-	checkCounter uint32
-	writerType   string
+	notifiers       []Notifier
+	reportPath      string
+	robots          *RobotsCache
+	checkpointPath  string
+	resumePath      string
+	skipNoindex     bool
+	skipNonHTML     bool
+	bandwidth       *BandwidthLimiter
+	ipLabel         func(ip string) string
+	maxDepth        int
+	maxPagesPerHost int
+	collectLinks    bool
+	links           DataWriter
+	recordMeta      bool
+	tsvHeader       bool
+	tsvStrip        bool
+	asyncBuffer     int
+	dryRun          bool
+	knownStates     []string
+	sitesBuffer     int
+	onMalformedSite func(source string, line int, err error)
+	writeAttempts   int
+	writeRetryDelay time.Duration
+	selectors       map[string][]FieldSelector
+	feedMode        FeedMode
+	maxBodyBytes    int64
+	fileTemplate    string
+	maxFileBytes    int64
+	maxCrawlDelay   time.Duration
+	filter          SiteFilter
+	csvHeader       []string
+	cookieJar       http.CookieJar
+	flushInterval   time.Duration
+	flushLines      int
+	failures        DataWriter
+	// userAgentStats - сколько запросов ушло с каждым User-Agent, под mu
+	userAgentStats map[string]uint32
+
+	mu                 sync.Mutex
+	parser             *parser
+	meg                multierror.Group
+	pendingWg          sync.WaitGroup
+	sitesChan          chan *Site
+	visited            map[string]struct{}
+	checkCounter       atomic.Int64
+	totalCounter       uint32
+	duplicateCounter   uint32
+	retriedCounter     uint32
+	skippedCounter     uint32
+	succeededCounter   uint32
+	failedCounter      uint32
+	fetchedCounter     uint64
+	latencyTotal       int64
+	categoryLines      map[string]int
+	report             RunReport
+	errorClasses       map[string]int
+	verdicts           map[string]int
+	notModifiedCounter uint32
+	malformedCounter   uint32
+	invalidCounter     uint32
+	nonHTMLCounter     uint32
+	filteredCounter    uint32
+	categoryRules      []CategoryRule
+	hostDelays         map[string]time.Duration
+	hostPages          map[string]int
+	slowHosts          map[string]time.Duration
+	inFlightCounter    atomic.Int32
+	requestCounter     atomic.Int64
+	// sitesLoaded - список сайтов разобран, totalCounter больше не растет от него
+	sitesLoaded      atomic.Bool
+	startedAt        int64
+	statusSrv        *http.Server
+	statusAddr       string
+	cache            *HTTPCache
+	writerType       string
+	outputs          *categoryFiles
+	workers          int
+	rules            []ExtractionRule
+	checkpointWriter *FileWriter
+	checkpointSynced time.Time
+	queued           []*Site
+	seen             map[string]struct{}
 }
 
-func NewCrawler(timeout time.Duration, rps uint64, insecure bool, writerType string) (*Crawler, error) {
+func NewCrawler(opts Options) (*Crawler, error) {
 
-	if rps <= 0 {
-		return nil, fmt.Errorf("rps cannot be %d", rps)
+	if opts.RPS <= 0 {
+		return nil, fmt.Errorf("rps cannot be %d", opts.RPS)
+	}
+	if opts.Workers <= 0 {
+		return nil, fmt.Errorf("workers cannot be %d", opts.Workers)
+	}
+	if opts.Transport == (TransportPolicy{}) {
+		opts.Transport.Timeout = defaultTimeout
+	}
+	if opts.Status.isZero() {
+		opts.Status = StatusPolicy{FollowRedirects: true, MaxRedirects: defaultMaxRedirects}
+	}
+	rules := opts.Rules
+	if len(rules) == 0 {
+		rules = DefaultExtractionRules
+	}
+	if err := validateRules(rules); err != nil {
+		return nil, err
 	}
 
-	return &Crawler{
-		writerType: writerType,
-		parser: &parser{
-			client: &http.Client{
-				Timeout: timeout,
-				Transport: &http.Transport{
-					TLSClientConfig: &tls.Config{
-						InsecureSkipVerify: insecure,
-					},
-				},
-			},
-			requestBuilder: func(url string) (*http.Request, error) {
-				req, err := http.NewRequest(http.MethodGet, url, nil)
-				if err != nil {
-					return nil, err
-				}
+	var proxy *url.URL
+	if opts.ProxyURL != "" {
+		var err error
+		if proxy, err = parseProxyURL(opts.ProxyURL); err != nil {
+			return nil, err
+		}
+	}
 
-				req.Close = true
-				req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
+	// с robots.txt лимит на хост нужен всегда, под Crawl-delay
+	var hostLimiter *HostRateLimiter
+	if opts.PerHostRPS > 0 || opts.RespectRobots {
+		hostLimiter = NewHostRateLimiter(opts.PerHostRPS)
+	}
 
-				return req, nil
+	agents := newUserAgentPicker(opts.UserAgents)
+	c := &Crawler{
+		writerType:      opts.WriterType,
+		outputs:         newCategoryFiles(opts.OutputDir),
+		workers:         opts.Workers,
+		rules:           rules,
+		notifiers:       opts.Notifiers,
+		reportPath:      opts.ReportPath,
+		checkpointPath:  opts.CheckpointPath,
+		resumePath:      opts.ResumeFrom,
+		skipNoindex:     opts.SkipNoindex,
+		skipNonHTML:     opts.SkipNonHTML,
+		ipLabel:         opts.IPLabel,
+		maxDepth:        opts.MaxDepth,
+		maxPagesPerHost: opts.MaxPagesPerHost,
+		collectLinks:    opts.CollectLinks,
+		links:           opts.Links,
+		recordMeta:      opts.RecordMeta,
+		tsvHeader:       opts.TSVHeader,
+		tsvStrip:        opts.TSVStrip,
+		asyncBuffer:     opts.AsyncBuffer,
+		dryRun:          opts.DryRun,
+		knownStates:     opts.KnownStates,
+		sitesBuffer:     opts.SitesBuffer,
+		onMalformedSite: opts.OnMalformedSite,
+		writeAttempts:   opts.WriteAttempts,
+		writeRetryDelay: opts.WriteRetryDelay,
+		selectors:       opts.Selectors,
+		feedMode:        opts.FeedMode,
+		maxBodyBytes:    opts.MaxBodyBytes,
+		fileTemplate:    opts.FileTemplate,
+		maxFileBytes:    opts.MaxFileBytes,
+		maxCrawlDelay:   opts.MaxCrawlDelay,
+		filter:          opts.Filter,
+		csvHeader:       opts.CSVHeader,
+		cookieJar:       opts.CookieJar,
+		flushInterval:   opts.FlushInterval,
+		flushLines:      opts.FlushLines,
+		failures:        opts.Errors,
+		parser: &parser{
+			transport: opts.Transport,
+			tlsConfig: &tls.Config{
+				InsecureSkipVerify: opts.Insecure,
 			},
-			rateLimit: time.Tick(time.Second / time.Duration(rps)),
+			forceHTTP2:  opts.ForceHTTP2,
+			agents:      agents,
+			userAgent:   agents.agents[0],
+			rateLimit:   time.Tick(time.Second / time.Duration(opts.RPS)),
+			hostLimiter: hostLimiter,
+			retry:       opts.Retry,
+			status:      opts.Status,
+			dns:         newDNSCache(opts.DNS, opts.Transport.DialTimeout),
 		},
-	}, nil
+	}
+	headers := make(http.Header, len(opts.Headers))
+	for name, value := range opts.Headers {
+		headers.Set(name, value)
+	}
+	c.parser.requestBuilder = func(ctx context.Context, site *Site, url string) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		agent := c.parser.agents.pick()
+		c.countUserAgent(agent)
+		req.Header.Set("User-Agent", agent)
+		for name, values := range headers {
+			req.Header[name] = append([]string(nil), values...)
+		}
+		if opts.HeaderHook != nil && site != nil {
+			opts.HeaderHook(site, req)
+		}
+
+		return req, nil
+	}
+	if err := c.setCategoryRules(opts.CategoryRules); err != nil {
+		return nil, err
+	}
+	if c.cookieJar == nil && !opts.NoCookies {
+		c.cookieJar, _ = cookiejar.New(nil)
+	}
+	c.parser.jar = c.cookieJar
+	c.parser.client = c.parser.newClient(proxy)
+	c.bandwidth = NewBandwidthLimiter(opts.BytesPerSec)
+	if opts.CachePath != "" {
+		var err error
+		if c.cache, err = loadHTTPCache(opts.CachePath); err != nil {
+			return nil, fmt.Errorf("load http cache %q: %w", opts.CachePath, err)
+		}
+	}
+	if c.maxBodyBytes <= 0 {
+		c.maxBodyBytes = defaultMaxBodyBytes
+	}
+	if c.flushInterval == 0 {
+		c.flushInterval = defaultFlushInterval
+	}
+	if c.flushLines == 0 {
+		c.flushLines = defaultFlushLines
+	}
+	if opts.RespectRobots {
+		c.robots = NewRobotsCache(c.parser, defaultRobotsTTL)
+	}
+
+	return c, nil
 }
 
 func NewFileWriter(filename string) (DataWriter, error) {
@@ -112,19 +362,53 @@ func (fw *FileWriter) Write(data string) error {
 	return err
 }
 
+// WriteCtx - запись в буфер не блокирует, но сброс на медленный диск может,
+// поэтому отмененный ctx проверяется до нее
+func (fw *FileWriter) WriteCtx(ctx context.Context, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return fw.Write(data)
+}
+
+// Empty - ни в файле, ни в буфере еще ничего нет
+func (fw *FileWriter) Empty() bool {
+	if fw.Writer.Buffered() > 0 {
+		return false
+	}
+	info, err := fw.File.Stat()
+	return err == nil && info.Size() == 0
+}
+
 func (fw *FileWriter) Flush() error {
 	return fw.Writer.Flush()
 }
 
+// Close сбрасывает буфер даже если Flush до этого не вызвали
 func (fw *FileWriter) Close() error {
+	if err := fw.Writer.Flush(); err != nil {
+		fw.File.Close()
+		return err
+	}
 	return fw.File.Close()
 }
 
+// Write дописывает перевод строки, если его нет, строки tsv и jsonl приходят уже с ним
 func (cw *ConsoleWriter) Write(data string) error {
-	_, err := cw.Writer.WriteString(fmt.Sprintf("%s\n", data))
+	if !strings.HasSuffix(data, "\n") {
+		data += "\n"
+	}
+	_, err := cw.Writer.WriteString(data)
 	return err
 }
 
+func (cw *ConsoleWriter) WriteCtx(ctx context.Context, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return cw.Write(data)
+}
+
 func (cw *ConsoleWriter) Flush() error {
 	return cw.Writer.Flush()
 }
@@ -133,142 +417,764 @@ func (cw *ConsoleWriter) Close() error {
 	return nil
 }
 
-func (c *Crawler) loadSitesFromFile(filepath string) (chan *Site, error) {
-	file, err := os.Open(filepath)
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	sitesChan := make(chan *Site)
-	decoder := json.NewDecoder(file)
-	for decoder.More() {
-		c.wg.Add(1)
-		var site *Site
-		err = decoder.Decode(&site)
+// loadSites читает сайты из jsonl и добавляет к ним поставленные
+// в очередь через LoadSitesFromSitemap, пустой source - только очередь
+func (c *Crawler) loadSites(ctx context.Context, source string) (chan *Site, error) {
+	var decoded []*Site
+	if source != "" {
+		r, err := c.openSource(ctx, source)
 		if err != nil {
 			return nil, err
 		}
-		go func(site *Site) {
-			defer c.wg.Done()
-			sitesChan <- site
-		}(site)
+		defer r.Close()
+		if decoded, err = c.decodeSites(source, r, c.reportMalformed(source)); err != nil {
+			return nil, err
+		}
+		decoded = c.dropInvalid(source, decoded)
 	}
+	c.mu.Lock()
+	decoded = append(decoded, c.queued...)
+	c.queued = nil
+	c.mu.Unlock()
+
+	var sites []*Site
+	unique := make(map[string]*Site)
+	for _, site := range decoded {
+		atomic.AddUint32(&c.totalCounter, 1)
+		key := urlKey(site.Url)
+		if first, ok := unique[key]; ok {
+			mergeCategories(first, site)
+			atomic.AddUint32(&c.duplicateCounter, 1)
+			continue
+		}
+		unique[key] = site
+		sites = append(sites, site)
+	}
+	c.sitesLoaded.Store(true)
+	// фильтруем после слияния дублей, чтобы категории дубля тоже прошли белый список
+	filtered := sites[:0]
+	for _, site := range sites {
+		if !c.filter.apply(site) {
+			atomic.AddUint32(&c.filteredCounter, 1)
+			continue
+		}
+		filtered = append(filtered, site)
+	}
+	sites = filtered
+	c.warnCookiesRequired(sites)
+
+	// дубли уже слиты, так что сайт из прогресса пропускается целиком со всеми
+	// своими категориями, ключ у обоих - нормализованный урл
+	c.sitesChan = make(chan *Site, c.sitesBuffer)
+	c.mu.Lock()
+	c.visited = make(map[string]struct{}, len(unique))
+	for key := range unique {
+		c.visited[key] = struct{}{}
+	}
+	c.mu.Unlock()
+	todo := sites[:0]
+	for _, site := range sites {
+		if !c.isSeen(site.Url) {
+			todo = append(todo, site)
+		}
+	}
+	c.enqueueAll(ctx, todo)
+	if done := len(sites) - len(todo); done > 0 {
+		log.Printf("Skipped %d sites already done in checkpoint", done)
+	}
+	// сайты, найденные по ссылкам, добавляются в pendingWg раньше, чем
+	// родитель из него выходит, так что ноль значит, что работы больше нет
+	sitesChan := c.sitesChan
 	go func() {
-		c.wg.Wait()
+		c.pendingWg.Wait()
 		close(sitesChan)
 	}()
 
 	return sitesChan, nil
 }
 
-func (c *Crawler) printStatus() {
-	ticker := time.NewTicker(1 * time.Second)
+// statusLine - прогресс для лога: проверено из известного числа уникальных
+// сайтов (пока список не дочитан - "?"), запросы в работе и итоги по сайтам
+func (c *Crawler) statusLine() string {
+	total := "?"
+	if c.sitesLoaded.Load() {
+		total = strconv.FormatUint(uint64(atomic.LoadUint32(&c.totalCounter)-atomic.LoadUint32(&c.duplicateCounter)), 10)
+	}
+	return fmt.Sprintf("checked %d/%s sites, %d in flight: %d succeeded, %d failed, %d skipped, retried %d requests",
+		c.checkCounter.Load(), total, c.inFlightCounter.Load(),
+		atomic.LoadUint32(&c.succeededCounter), atomic.LoadUint32(&c.failedCounter),
+		atomic.LoadUint32(&c.skippedCounter), atomic.LoadUint32(&c.retriedCounter))
+}
+
+// printStatus раз в statusInterval пишет statusLine и запросы в секунду за
+// последний тик, пока не закроют stop
+func (c *Crawler) printStatus(stop <-chan struct{}) {
+	ticker := time.NewTicker(statusInterval)
 	defer ticker.Stop()
+	lastRequests, lastTick := c.requestCounter.Load(), time.Now()
 	for {
 		select {
-		case <-ticker.C:
-			log.Printf("Checked %d sites", atomic.LoadUint32(&c.checkCounter))
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			requests := c.requestCounter.Load()
+			rps := float64(requests-lastRequests) / now.Sub(lastTick).Seconds()
+			lastRequests, lastTick = requests, now
+			log.Printf("Status: %s, %.1f req/s", c.statusLine(), rps)
 		}
 	}
 }
 
-func (c *Crawler) Start(filepath string) error {
-	sitesChan, err := c.loadSitesFromFile(filepath)
-	if err != nil {
-		return err
+func (c *Crawler) Start(ctx context.Context, source string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	if err := validateSelectors(c.selectors); err != nil {
+		return fmt.Errorf("start: %w", err)
 	}
-	c.checkSites(sitesChan)
 
-	return nil
-}
+	if c.dryRun {
+		issues, err := c.Validate(ctx, source)
+		if err != nil {
+			return err
+		}
+		writeValidationReport(os.Stdout, source, issues)
+		if len(issues) > 0 {
+			return &ValidationError{Issues: issues}
+		}
+		return nil
+	}
 
-func (c *Crawler) checkSites(sitesChan <-chan *Site) {
-	wMap := make(map[string]DataWriter)
-	for site := range sitesChan {
-		site := site
-		c.meg.Go(func() error {
-			<-c.parser.rateLimit
-			req, err := c.parser.requestBuilder(site.Url)
-			if err != nil {
-				return err
-			}
-			resp, err := c.parser.client.Do(req)
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
+	start := time.Now()
+	atomic.StoreInt64(&c.startedAt, start.UnixNano())
+	defer c.stopStatusServer()
+	stopStatus, statusDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(statusDone)
+		c.printStatus(stopStatus)
+	}()
+	err := c.crawl(ctx, source)
+	close(stopStatus)
+	<-statusDone
+	// итог печатается всегда, даже если прогон короче одного тика
+	elapsed := time.Since(start)
+	log.Printf("Done in %s: %s, %.1f req/s on average", elapsed.Round(time.Millisecond), c.statusLine(),
+		float64(c.requestCounter.Load())/elapsed.Seconds())
+	report := c.buildReport(elapsed, err)
+	c.mu.Lock()
+	c.report = report
+	c.mu.Unlock()
+	if c.reportPath != "" {
+		if wErr := writeReport(c.reportPath, report); wErr != nil {
+			log.Printf("write report: %v", wErr)
+		}
+	}
+	c.notify(report)
 
-			atomic.AddUint32(&c.checkCounter, 1)
+	return err
+}
 
-			if resp.StatusCode != http.StatusOK {
-				return err
+func (c *Crawler) crawl(ctx context.Context, source string) error {
+	if c.resumePath != "" {
+		if err := c.loadProgress(c.resumePath); err != nil {
+			return err
+		}
+	}
+	if c.checkpointPath != "" {
+		if err := c.openCheckpoint(); err != nil {
+			return err
+		}
+		defer func() {
+			if err := c.closeCheckpoint(); err != nil {
+				log.Printf("close checkpoint: %v", err)
 			}
+		}()
+	}
 
-			reader, err := charset.NewReader(resp.Body, resp.Header.Get("Content-Type"))
-			if err != nil {
-				return err
+	if c.collectLinks && c.links == nil {
+		links, err := NewFileWriter(defaultLinksPath)
+		if err != nil {
+			return err
+		}
+		c.links = links
+		defer func() {
+			if err := links.Close(); err != nil {
+				log.Printf("close links: %v", err)
 			}
-			doc, err := goquery.NewDocumentFromReader(reader)
-			if err != nil {
-				return err
+			c.links = nil
+		}()
+	}
+	if c.cache != nil {
+		defer func() {
+			if err := c.cache.save(); err != nil {
+				log.Printf("save http cache: %v", err)
 			}
+		}()
+	}
 
-			title := doc.Find("title").Text()
-			description := doc.Find("meta[name=description]").AttrOr("content", "")
-			if description == "" {
-				description = doc.Find("meta[property='og:description']").AttrOr("content", "")
-			}
+	sitesChan, err := c.loadSites(ctx, source)
+	if err != nil {
+		return err
+	}
 
-			c.mu.Lock()
-			defer c.mu.Unlock()
+	err = c.checkSites(ctx, sitesChan)
+	if duplicates := atomic.LoadUint32(&c.duplicateCounter); duplicates > 0 {
+		log.Printf("Dropped %d duplicate sites, their categories were merged", duplicates)
+	}
 
-			for _, category := range site.Categories {
-				if _, ok := wMap[category]; !ok {
-					wMap[category], err = c.createWriterForCategory(category)
-					if err != nil {
-						return err
+	return err
+}
+
+func (c *Crawler) checkSites(ctx context.Context, sitesChan <-chan *Site) error {
+	writers := NewWriterManager(c.createWriterForCategory, c.flushInterval, c.flushLines)
+	for i := 0; i < c.workers; i++ {
+		c.meg.Go(func() error {
+			var errs *multierror.Error
+			for ctx.Err() == nil {
+				var site *Site
+				var ok bool
+				select {
+				case site, ok = <-sitesChan:
+				case <-ctx.Done():
+				}
+				if !ok {
+					break
+				}
+				c.inFlightCounter.Add(1)
+				err := c.checkSite(ctx, site, writers)
+				c.inFlightCounter.Add(-1)
+				if site.pending {
+					c.pendingWg.Done()
+				}
+				if ctx.Err() == nil {
+					if cpErr := c.checkpoint(site.Url, err, writers); cpErr != nil {
+						log.Printf("checkpoint: %v", cpErr)
 					}
 				}
-				line := fmt.Sprintf("%s\t%s\t%s\n", site.Url, title, description)
-				if wErr := wMap[category].Write(line); wErr != nil {
-					return wErr
+				if errors.Is(err, errSiteSkipped) {
+					continue
+				}
+				c.recordResult(err)
+				if err != nil {
+					c.recordVerdict(siteVerdict(err, ""))
+					c.recordFailure(site, err)
 				}
+				errs = multierror.Append(errs, err)
 			}
-
-			return nil
+			return errs.ErrorOrNil()
 		})
 	}
 
 	mErr := c.meg.Wait()
-	for _, w := range wMap {
-		if err := w.Flush(); err != nil {
-			log.Printf(err.Error())
+	if ctx.Err() != nil {
+		c.releasePending(sitesChan)
+	}
+	for _, w := range []DataWriter{c.failures, c.links} {
+		if w == nil {
+			continue
 		}
-		if err := w.Close(); err != nil {
+		if err := w.Flush(); err != nil {
 			log.Printf(err.Error())
 		}
 	}
+	if err := writers.Close(); err != nil {
+		log.Printf(err.Error())
+	}
+	if err := c.outputs.Close(); err != nil {
+		log.Printf(err.Error())
+	}
 	if mErr != nil {
 		log.Printf(mErr.Error())
 	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("check sites: %w", err)
+	}
+
+	return nil
 }
 
-func (c *Crawler) createWriterForCategory(category string) (DataWriter, error) {
-	switch c.writerType {
-	case "file":
-		return NewFileWriter(fmt.Sprintf("%s.tsv", category))
-	default:
-		return NewConsoleWriter()
+func (c *Crawler) checkSite(ctx context.Context, site *Site, writers *WriterManager) error {
+	if c.robots != nil {
+		if !c.robots.Allowed(c.parser.userAgent, site.Url) {
+			return &RobotsDisallowedError{URL: site.Url}
+		}
+		if delay := c.robots.CrawlDelay(c.parser.userAgent, site.Url); delay > 0 {
+			ok, err := c.applyCrawlDelay(site.Url, delay)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				atomic.AddUint32(&c.skippedCounter, 1)
+				c.recordVerdict(VerdictSlowHost)
+				return errSiteSkipped
+			}
+		}
+	}
+
+	p, err := c.fetchPage(ctx, site)
+	if ctx.Err() == nil {
+		c.checkCounter.Add(1)
+	}
+	if err != nil {
+		var sErr *HTTPStatusError
+		if errors.As(err, &sErr) && !c.parser.status.isError(sErr.StatusCode) {
+			atomic.AddUint32(&c.skippedCounter, 1)
+			c.recordVerdict(siteVerdict(sErr, ""))
+			return errSiteSkipped
+		}
+		return err
+	}
+	if c.collectLinks {
+		c.writeLinks(site.Url, p.links)
+	}
+	if !strings.Contains(p.meta.Robots, "nofollow") {
+		c.followLinks(ctx, site, p.links)
+	}
+	if p.nonHTML {
+		atomic.AddUint32(&c.nonHTMLCounter, 1)
+		if c.skipNonHTML {
+			atomic.AddUint32(&c.skippedCounter, 1)
+			return errSiteSkipped
+		}
+	}
+	verdict := siteVerdict(nil, p.meta.Robots)
+	if c.skipNoindex && verdict == VerdictNoindex {
+		atomic.AddUint32(&c.skippedCounter, 1)
+		c.recordVerdict(verdict)
+		return errSiteSkipped
+	}
+	c.recordVerdict(verdict)
+
+	if c.recordMeta {
+		site.StatusCode, site.LatencyMs = p.statusCode, p.latency.Milliseconds()
+	}
+	base := Record{
+		URL:         site.Url,
+		FinalURL:    p.finalURL,
+		Title:       p.meta.Title,
+		Description: p.meta.Description,
+		OGTitle:     p.meta.OGTitle,
+		Canonical:   p.meta.Canonical,
+		Favicon:     p.meta.Favicon,
+		Language:    p.meta.Language,
+		Robots:      p.meta.Robots,
+		Fields:      p.fields,
+		FetchedAt:   p.fetchedAt.Unix(),
+		StatusCode:  p.statusCode,
+		RemoteAddr:  p.remoteAddr,
+		IPLabel:     c.labelIP(p.remoteAddr),
+		LatencyMs:   site.LatencyMs,
+		Verdict:     verdict,
+		Depth:       site.Depth,
+		ContentType: p.contentType,
+	}
+	// категории от правил идут только в выдачу, сам сайт и его дети их не получают
+	added, fired := c.matchCategories(base, site.Categories)
+	base.Rules = fired
+	categories := append(append([]string(nil), site.Categories...), added...)
+	for _, category := range categories {
+		rec := base
+		rec.Category = category
+		rec.Fields = p.fieldsFor(category)
+		if err := writers.WriteRecordCtx(ctx, rec); err != nil {
+			return err
+		}
+		c.mu.Lock()
+		if c.categoryLines == nil {
+			c.categoryLines = make(map[string]int)
+		}
+		c.categoryLines[category]++
+		c.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (p *parser) wait(ctx context.Context, url string) error {
+	if p.hostLimiter != nil {
+		if err := p.hostLimiter.Wait(ctx, url); err != nil {
+			return err
+		}
+	}
+	select {
+	case <-p.rateLimit:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Crawler) fetchAndParse(ctx context.Context, client *http.Client, site *Site, url string) (*page, error) {
+	req, err := c.parser.requestBuilder(ctx, site, url)
+	if err != nil {
+		return nil, err
+	}
+	// при редиректах остается адрес последнего соединения
+	var remoteAddr string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			remoteAddr = info.Conn.RemoteAddr().String()
+		},
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	req.Header.Set("Accept-Encoding", "gzip, deflate")
+	var cached *httpCacheEntry
+	if c.cache != nil {
+		if cached = c.cache.get(url); cached != nil {
+			cached.setConditional(req)
+		}
+	}
+	start := time.Now()
+	c.requestCounter.Add(1)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// на 304 тела нет, страница берется из кэша, ссылки с нее не собираются
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		io.Copy(io.Discard, resp.Body)
+		latency := time.Since(start)
+		atomic.AddUint64(&c.fetchedCounter, 1)
+		atomic.AddInt64(&c.latencyTotal, int64(latency))
+		atomic.AddUint32(&c.notModifiedCounter, 1)
+		return &page{
+			meta:           cached.Meta,
+			fields:         cached.Fields,
+			categoryFields: cached.CategoryFields,
+			statusCode:     resp.StatusCode,
+			fetchedAt:      time.Now(),
+			finalURL:       resp.Request.URL.String(),
+			remoteAddr:     remoteAddr,
+			latency:        latency,
+		}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		sErr := &HTTPStatusError{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+		if location, lErr := resp.Location(); lErr == nil {
+			sErr.Location = location.String()
+		}
+		return nil, sErr
+	}
+
+	body, err := decodeBody(resp, c.bandwidth.Reader(ctx, resp.Body))
+	if err != nil {
+		return nil, &ParseError{URL: url, Err: err}
+	}
+	limit := c.maxBodyBytes
+	if limit <= 0 {
+		limit = defaultMaxBodyBytes
+	}
+	limited := &bodyLimiter{r: body, n: limit}
+	buffered := bufio.NewReaderSize(limited, feedSniffBytes)
+	if c.isFeedResponse(resp, buffered) {
+		return c.parseFeedPage(resp, buffered, url, start, remoteAddr)
+	}
+	contentType := detectContentType(resp.Header.Get("Content-Type"), buffered)
+	if !isHTMLContentType(contentType) {
+		return c.nonHTMLPage(resp, buffered, contentType, start, remoteAddr)
+	}
+	reader, err := charset.NewReader(buffered, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, &ParseError{URL: url, Err: err}
+	}
+	doc, err := goquery.NewDocumentFromReader(reader)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, &ParseError{URL: url, Err: err}
+	}
+
+	meta, err := extractMetadata(doc, resp.Request.URL.String(), resp.Header)
+	if err != nil {
+		return nil, &ParseError{URL: url, Err: err}
+	}
+	// для метаданных хватает начала страницы, но без title обрезанная страница бесполезна
+	if limited.truncated && meta.Title == "" {
+		return nil, &ParseError{URL: url, Err: fmt.Errorf("no title in the first %d bytes of the body", limit)}
+	}
+
+	latency := time.Since(start)
+	atomic.AddUint64(&c.fetchedCounter, 1)
+	atomic.AddInt64(&c.latencyTotal, int64(latency))
+
+	var links []string
+	if c.maxDepth > 0 || c.collectLinks {
+		links = extractLinks(doc, resp.Request.URL)
+	}
+	fields := applyRules(doc, c.rules, resp.Proto)
+	categoryFields := c.applySelectors(doc, resp.Proto)
+	if c.cache != nil {
+		c.cache.put(url, resp.Header, meta, fields, categoryFields)
+	}
+
+	return &page{
+		contentType:    contentType,
+		categoryFields: categoryFields,
+		links:          links,
+		meta:           meta,
+		fields:         fields,
+		statusCode:     resp.StatusCode,
+		fetchedAt:      time.Now(),
+		finalURL:       resp.Request.URL.String(),
+		remoteAddr:     remoteAddr,
+		latency:        latency,
+	}, nil
+}
+
+func (c *Crawler) labelIP(remoteAddr string) string {
+	if c.ipLabel == nil || remoteAddr == "" {
+		return ""
+	}
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+	return c.ipLabel(ip)
+}
+
+// Bandwidth - лимит на тела ответов из Options.BytesPerSec, его можно менять на лету
+func (c *Crawler) Bandwidth() *BandwidthLimiter {
+	return c.bandwidth
+}
+
+// HostCounts отдает число запросов по хостам для отладки, nil без лимита на хост
+func (c *Crawler) HostCounts() map[string]uint64 {
+	if c.parser.hostLimiter == nil {
+		return nil
+	}
+	return c.parser.hostLimiter.HostCounts()
+}
+
+// createWriterForCategory понимает writerType вида "file", "console",
+// и те же с суффиксом "-json" для выдачи в jsonl вместо tsv
+func (c *Crawler) createWriterForCategory(category string) (RecordWriter, error) {
+	return c.createWriter(c.writerType, category)
+}
+
+func (c *Crawler) createWriter(writerType, category string) (RecordWriter, error) {
+	if isMultiWriterType(writerType) {
+		return c.createMultiWriter(strings.TrimPrefix(writerType, multiWriterPrefix), category)
+	}
+	kind, format := writerType, "tsv"
+	if strings.HasSuffix(kind, "-json") {
+		kind, format = strings.TrimSuffix(kind, "-json"), "jsonl"
+	}
+
+	var w DataWriter
+	var err error
+	factory, file := writerFactory(writerType, kind)
+	if kind == "file" && (c.fileTemplate != "" || c.maxFileBytes > 0) {
+		template := c.fileTemplate
+		if template == "" {
+			template = defaultFileTemplate + "." + format
+		}
+		var path string
+		if path, err = c.outputs.path(category); err == nil {
+			// шаблон считается от OutputDir, как и обычные файлы категорий
+			template = strings.ReplaceAll(template, "{category}", filepath.Base(path))
+			w, err = NewRotatingFileWriter(filepath.Join(c.outputs.dir, template), c.maxFileBytes)
+		}
+	} else if file {
+		var path string
+		if path, err = c.outputs.path(category); err == nil {
+			w, err = factory(path)
+		}
+	} else {
+		w, err = factory(category)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if cw, ok := w.(*CSVWriter); ok && len(c.csvHeader) > 0 {
+		cw.Header = c.csvHeader
+	}
+	// писатели вроде sqlite и csv сами раскладывают Record по полям
+	if rw, ok := w.(RecordWriter); ok {
+		return rw, nil
+	}
+	if c.writeAttempts > 1 {
+		w = NewRetryWriter(w, c.writeAttempts, c.writeRetryDelay)
+	}
+	if c.asyncBuffer > 0 {
+		w = NewAsyncWriter(w, c.asyncBuffer)
 	}
+	if format == "jsonl" {
+		return NewJSONWriter(w), nil
+	}
+	return &TSVWriter{DataWriter: w, RecordMeta: c.recordMeta, Header: c.tsvHeader, StripControl: c.tsvStrip}, nil
 }
 
 func main() {
-	crawler, err := NewCrawler(10*time.Second, 30, true, "")
+	resume := flag.Bool("resume", false, "skip sites already processed in the checkpoint")
+	checkpoint := flag.String("checkpoint", "", "progress file with the result for every processed site, with -resume defaults to "+defaultCheckpointPath)
+	errorsPath := flag.String("errors", "", "write failed sites to this tsv file, \"-\" for stderr")
+	depth := flag.Int("depth", 0, "follow same-host links up to this many hops from the input sites")
+	sitemap := flag.String("sitemap", "", "also crawl urls from this sitemap.xml")
+	respectRobots := flag.Bool("robots", false, "honor robots.txt and its Crawl-delay")
+	bandwidth := flag.Int64("bandwidth", 0, "limit for response bodies in bytes per second, 0 for no limit")
+	proxy := flag.String("proxy", "", "http, https or socks5 proxy url for all requests, sites may override it with their own \"proxy\"")
+	forceHTTP2 := flag.Bool("http2", false, "negotiate HTTP/2 over TLS where servers support it")
+	states := flag.String("states", "", "comma-separated site states to crawl, empty for all")
+	categories := flag.String("categories", "", "comma-separated categories to crawl and write, empty for all")
+	selectors := flag.String("selectors", "", "json file with extraction selectors by category, \"default\" for the rest")
+	categoryRules := flag.String("category-rules", "", "json file with rules adding categories by page content")
+	mainPageOnly := flag.Bool("main-page-only", false, "crawl only sites with for_main_page")
+	writerType := flag.String("writer", "", "output type: console, file, gzip, csv or sqlite, with -json for jsonl, or \"multi:file,console-json\"; empty writes to the console")
+	outputDir := flag.String("output-dir", "", "directory for category output files and categories.tsv mapping categories to file names")
+	sitesSource := flag.String("sites", "./500.jsonl", "jsonl with sites: a path, \"-\" for stdin or an http(s) url")
+	statusAddr := flag.String("status", "", "serve /status and /metrics on this address while crawling, e.g. :9100")
+	httpCache := flag.String("http-cache", "", "keep ETag/Last-Modified here and send conditional requests on the next run")
+	userAgentsPath := flag.String("user-agents", "", "file with User-Agent strings, one per line, picked at random for every request")
+	flushInterval := flag.Duration("flush-interval", defaultFlushInterval, "flush output files this often, 0 to flush only at exit")
+	flushLines := flag.Int("flush-lines", defaultFlushLines, "flush a category output after this many lines, 0 to disable")
+	tsvHeader := flag.Bool("tsv-header", false, "start every new category output with a header row")
+	tsvStrip := flag.Bool("tsv-strip", false, "replace tabs and line breaks inside fields with spaces instead of escaping them")
+	asyncBuffer := flag.Int("async-buffer", 0, "write output files from a background goroutine with a queue of this many lines, 0 to write inline")
+	maxCrawlDelay := flag.Duration("max-crawl-delay", defaultMaxCrawlDelay, "skip hosts whose robots.txt Crawl-delay is longer than this")
+	linksPath := flag.String("links", "", "write every link found on crawled pages to this tsv file")
+	maxPagesPerHost := flag.Int("max-pages-per-host", 0, "limit pages added per host by following links, 0 for no limit")
+	headers := make(map[string]string)
+	dryRun := flag.Bool("dry-run", false, "only validate the sites file and print its problems")
+	feedMode := flag.String("feed-mode", string(FeedAuto), "how to treat RSS/Atom responses: auto, html or feed")
+	dnsCache := flag.Bool("dns-cache", true, "cache DNS answers and fail fast on hosts that did not resolve")
+	dnsNegativeTTL := flag.Duration("dns-negative-ttl", DefaultDNSPolicy.NegativeTTL, "how long to remember a failed DNS lookup, 0 to always retry it")
+	skipNonHTML := flag.Bool("skip-non-html", false, "do not write rows for responses that are not text/html or application/xhtml+xml")
+	sitesBuffer := flag.Int("sites-buffer", 0, "how many loaded sites may wait for a free worker")
+	writeAttempts := flag.Int("write-attempts", 1, "retry failed output writes and flushes up to this many attempts")
+	writeRetryDelay := flag.Duration("write-retry-delay", 100*time.Millisecond, "pause between output write attempts")
+	flag.Func("header", "extra request header \"Name: value\", may be repeated", func(value string) error {
+		name, val, ok := strings.Cut(value, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return fmt.Errorf("header %q is not \"Name: value\"", value)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(val)
+		return nil
+	})
+	flag.Parse()
+
+	var userAgents []string
+	if *userAgentsPath != "" {
+		data, err := os.ReadFile(*userAgentsPath)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				userAgents = append(userAgents, line)
+			}
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	dns := DefaultDNSPolicy
+	dns.Enabled, dns.NegativeTTL = *dnsCache, *dnsNegativeTTL
+	opts := Options{
+		Transport:       DefaultTransportPolicy,
+		RPS:             30,
+		PerHostRPS:      2,
+		Workers:         50,
+		Insecure:        true,
+		ForceHTTP2:      *forceHTTP2,
+		RespectRobots:   *respectRobots,
+		WriterType:      *writerType,
+		ProxyURL:        *proxy,
+		BytesPerSec:     *bandwidth,
+		UserAgents:      userAgents,
+		CachePath:       *httpCache,
+		Retry:           DefaultRetryPolicy,
+		Status:          DefaultStatusPolicy,
+		Headers:         headers,
+		DNS:             dns,
+		OutputDir:       *outputDir,
+		Filter:          SiteFilter{States: splitList(*states), Categories: splitList(*categories), ForMainPageOnly: *mainPageOnly},
+		MaxDepth:        *depth,
+		MaxPagesPerHost: *maxPagesPerHost,
+		FlushInterval:   *flushInterval,
+		FlushLines:      *flushLines,
+		TSVHeader:       *tsvHeader,
+		TSVStrip:        *tsvStrip,
+		AsyncBuffer:     *asyncBuffer,
+		SitesBuffer:     *sitesBuffer,
+		FeedMode:        FeedMode(*feedMode),
+		SkipNonHTML:     *skipNonHTML,
+		DryRun:          *dryRun,
+		KnownStates:     KnownSiteStates,
+		WriteAttempts:   *writeAttempts,
+		WriteRetryDelay: *writeRetryDelay,
+		MaxCrawlDelay:   *maxCrawlDelay,
+	}
+	// у флагов 0 выключает сброс, а в Options это значение по умолчанию
+	if opts.FlushInterval == 0 {
+		opts.FlushInterval = -1
+	}
+	if opts.FlushLines == 0 {
+		opts.FlushLines = -1
+	}
+	if *resume && *checkpoint == "" {
+		*checkpoint = defaultCheckpointPath
+	}
+	opts.CheckpointPath = *checkpoint
+	if *resume {
+		opts.ResumeFrom = *checkpoint
+	}
+	var err error
+	if *selectors != "" {
+		if opts.Selectors, err = LoadFieldSelectors(*selectors); err != nil {
+			log.Fatalf(err.Error())
+		}
+	}
+	if *categoryRules != "" {
+		if opts.CategoryRules, err = LoadCategoryRules(*categoryRules); err != nil {
+			log.Fatalf(err.Error())
+		}
+	}
+	if *linksPath != "" {
+		linksWriter, err := NewFileWriter(*linksPath)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		defer linksWriter.Close()
+		opts.CollectLinks, opts.Links = true, linksWriter
+	}
+	switch *errorsPath {
+	case "":
+	case "-":
+		opts.Errors = &ConsoleWriter{Writer: bufio.NewWriter(os.Stderr)}
+	default:
+		errorsWriter, err := NewFileWriter(*errorsPath)
+		if err != nil {
+			log.Fatalf(err.Error())
+		}
+		defer errorsWriter.Close()
+		opts.Errors = errorsWriter
+	}
+
+	crawler, err := NewCrawler(opts)
 	if err != nil {
 		log.Fatalf(err.Error())
 	}
-	if err = crawler.Start("./500.jsonl"); err != nil {
+	if *statusAddr != "" {
+		if err := crawler.StatusServer(*statusAddr); err != nil {
+			log.Fatalf(err.Error())
+		}
+	}
+	if *sitemap != "" {
+		if err := crawler.LoadSitesFromSitemap(*sitemap); err != nil {
+			log.Printf("sitemap: %v", err)
+		}
+	}
+	err = crawler.Start(ctx, *sitesSource)
+	if summary, mErr := json.MarshalIndent(crawler.Report(), "", "  "); mErr == nil {
+		log.Printf("Summary:\n%s", summary)
+	}
+	if err != nil {
 		log.Fatalf(err.Error())
 	}
 }
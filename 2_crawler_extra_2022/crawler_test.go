@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeSites сохраняет сайты в jsonl так же, как выглядит выгрузка из хадупа
+func writeSites(t *testing.T, urls ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, u := range urls {
+		fmt.Fprintf(file, `{"url": %q, "state": "checked", "categories": ["good_site"], "for_main_page": false, "ctime": 1567713280}`+"\n", u)
+	}
+	return path
+}
+
+func newCountingServer(t *testing.T, hits *uint32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(hits, 1)
+		fmt.Fprint(w, "<html><head><title>ok</title></head></html>")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCancelledContext(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	path := writeSites(t, srv.URL, srv.URL+"/a", srv.URL+"/b")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	t.Run("Start", func(t *testing.T) {
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 100, Workers: 4, Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.Start(ctx, path)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if n := c.checkCounter.Load(); n != 0 {
+			t.Errorf("expected no checked sites, got %d", n)
+		}
+	})
+
+	t.Run("checkSites", func(t *testing.T) {
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 100, Workers: 4, Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sitesChan, err := c.loadSites(context.Background(), path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.checkSites(ctx, sitesChan)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+		if n := c.checkCounter.Load(); n != 0 {
+			t.Errorf("expected no checked sites, got %d", n)
+		}
+	})
+
+	if n := atomic.LoadUint32(&hits); n != 0 {
+		t.Errorf("expected no requests to the server, got %d", n)
+	}
+}
+
+func TestBoundedWorkers(t *testing.T) {
+	const workers, sites = 4, 2000
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000000, Workers: workers, WriterType: "file", Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	sitesChan := make(chan *Site)
+	go func() {
+		defer close(sitesChan)
+		for i := 0; i < sites; i++ {
+			sitesChan <- &Site{Url: fmt.Sprintf("%s/%d", srv.URL, i), Categories: []string{"good_site"}}
+		}
+	}()
+
+	baseline := runtime.NumGoroutine()
+	var maxGoroutines int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := c.checkSites(context.Background(), sitesChan); err != nil {
+			t.Error(err)
+		}
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		case <-time.After(time.Millisecond):
+			if n := runtime.NumGoroutine(); n > maxGoroutines {
+				maxGoroutines = n
+			}
+		}
+	}
+
+	if c.checkCounter.Load() != sites || c.succeededCounter != sites {
+		t.Errorf("expected %d checked sites, got checked=%d succeeded=%d", sites, c.checkCounter.Load(), c.succeededCounter)
+	}
+	if maxInFlight > workers {
+		t.Errorf("expected at most %d concurrent requests, got %d", workers, maxInFlight)
+	}
+	// воркеры, их http соединения и сервер - но никак не по горутине на сайт
+	if maxGoroutines-baseline > 10*workers {
+		t.Errorf("goroutines grew from %d to %d for %d workers", baseline, maxGoroutines, workers)
+	}
+}
+
+func TestZeroOptions(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{RPS: 1000, Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.parser.client.Timeout != defaultTimeout {
+		t.Errorf("expected the %v timeout of a zero Transport, got %v", defaultTimeout, c.parser.client.Timeout)
+	}
+	p, err := c.fetchPage(context.Background(), &Site{Url: srv.URL + "/old"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.finalURL != srv.URL+"/new" {
+		t.Errorf("expected a zero Status to follow redirects, ended at %q", p.finalURL)
+	}
+}
+
+func TestRemoteAddr(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+
+	var labeled []string
+	label := func(ip string) string {
+		labeled = append(labeled, ip)
+		return "loopback"
+	}
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy, IPLabel: label})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := &memWriter{}
+	writers := newJSONWriters(mw)
+	if err := c.checkSite(context.Background(), &Site{Url: srv.URL, Categories: []string{"good_site"}}, writers); err != nil {
+		t.Fatal(err)
+	}
+
+	var rec jsonRecord
+	if err := json.Unmarshal([]byte(mw.lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.RemoteAddr != srv.Listener.Addr().String() {
+		t.Errorf("expected remote addr %s, got %q", srv.Listener.Addr(), rec.RemoteAddr)
+	}
+	if rec.IPLabel != "loopback" || len(labeled) != 1 || labeled[0] != "127.0.0.1" {
+		t.Errorf("unexpected label %q for %v", rec.IPLabel, labeled)
+	}
+}
+
+func TestStatusLog(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	path := writeSites(t, srv.URL+"/a", srv.URL+"/b", srv.URL+"/a")
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line := c.statusLine(); !strings.HasPrefix(line, "checked 0/? sites, 0 in flight") {
+		t.Errorf("total must be unknown before the sites are loaded, got %q", line)
+	}
+	RegisterWriterFactory("test-status-log", func(string) (DataWriter, error) { return &memWriter{}, nil })
+	c.writerType = "test-status-log"
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	// прогон короче тика, но итоговая строка есть, и ровно одна
+	if n := strings.Count(buf.String(), "Done in "); n != 1 || !strings.Contains(buf.String(), "checked 2/2 sites, 0 in flight: 2 succeeded") {
+		t.Errorf("expected one final status line, got %q", buf.String())
+	}
+}
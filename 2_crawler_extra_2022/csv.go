@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var defaultCSVHeader = []string{"url", "title", "description"}
+
+var tsvUnescaper = strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r")
+
+// CSVWriter пишет заголовок перед первой строкой и сбрасывает файл после
+// каждой, чтобы после падения csv оставался валидным. Колонки Record
+// выбираются по именам из Header, см. recordColumn
+type CSVWriter struct {
+	Header []string
+
+	file        *os.File
+	writer      *csv.Writer
+	wroteHeader bool
+}
+
+func NewCSVWriter(filename string) (*CSVWriter, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	cw := &CSVWriter{Header: defaultCSVHeader, file: file, writer: csv.NewWriter(file)}
+	// в непустой файл заголовок уже писали
+	if info, err := file.Stat(); err == nil && info.Size() > 0 {
+		cw.wroteHeader = true
+	}
+	return cw, nil
+}
+
+func (cw *CSVWriter) writeRow(row []string) error {
+	if !cw.wroteHeader {
+		if err := cw.writer.Write(cw.Header); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+	if err := cw.writer.Write(row); err != nil {
+		return err
+	}
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+// Write принимает строку tsv, как от TSVWriter, и раскладывает ее по колонкам
+func (cw *CSVWriter) Write(data string) error {
+	row := strings.Split(strings.TrimSuffix(data, "\n"), "\t")
+	for i, col := range row {
+		row[i] = tsvUnescaper.Replace(col)
+	}
+	return cw.writeRow(row)
+}
+
+func (cw *CSVWriter) WriteRecord(rec Record) error {
+	row := make([]string, len(cw.Header))
+	for i, name := range cw.Header {
+		row[i] = recordColumn(rec, name)
+	}
+	return cw.writeRow(row)
+}
+
+func (cw *CSVWriter) Flush() error {
+	cw.writer.Flush()
+	return cw.writer.Error()
+}
+
+func (cw *CSVWriter) Close() error {
+	cw.writer.Flush()
+	if err := cw.writer.Error(); err != nil {
+		cw.file.Close()
+		return err
+	}
+	return cw.file.Close()
+}
+
+// recordColumn - значение колонки по имени: сначала поля ExtractionRule,
+// потом поля Record по их json именам, незнакомое имя - пустая колонка
+func recordColumn(rec Record, name string) string {
+	for _, f := range rec.Fields {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	switch name {
+	case "url":
+		return rec.URL
+	case "final_url":
+		return rec.FinalURL
+	case "title":
+		return rec.Title
+	case "description":
+		return rec.Description
+	case "og_title":
+		return rec.OGTitle
+	case "canonical":
+		return rec.Canonical
+	case "favicon":
+		return rec.Favicon
+	case "language":
+		return rec.Language
+	case "robots":
+		return rec.Robots
+	case "category":
+		return rec.Category
+	case "fetched_at":
+		return strconv.FormatInt(rec.FetchedAt, 10)
+	case "status_code":
+		return strconv.Itoa(rec.StatusCode)
+	case "latency_ms":
+		return strconv.FormatInt(rec.LatencyMs, 10)
+	case "remote_addr":
+		return rec.RemoteAddr
+	case "ip_label":
+		return rec.IPLabel
+	case "verdict":
+		return rec.Verdict
+	case "rules":
+		return strings.Join(rec.Rules, ",")
+	case "depth":
+		return strconv.Itoa(rec.Depth)
+	case "content_type":
+		return rec.ContentType
+	default:
+		return ""
+	}
+}
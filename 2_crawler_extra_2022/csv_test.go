@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rows
+}
+
+func TestCSVWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "news.csv")
+	cw, err := NewCSVWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.Write("http://a\tquoted \"title\", with comma\tmulti\\nline\\ttab\n"); err != nil {
+		t.Fatal(err)
+	}
+	// файл валиден сразу после Write, без Flush и Close
+	expected := [][]string{
+		{"url", "title", "description"},
+		{"http://a", `quoted "title", with comma`, "multi\nline\ttab"},
+	}
+	if rows := readCSV(t, path); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// дописываем в тот же файл без второго заголовка
+	if cw, err = NewCSVWriter(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := cw.WriteRecord(Record{URL: "http://b", Title: "b", Description: "desc"}); err != nil {
+		t.Fatal(err)
+	}
+	cw.Close()
+	expected = append(expected, []string{"http://b", "b", "desc"})
+	if rows := readCSV(t, path); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+}
+
+func TestCSVOutput(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><head><title>tab	title</title><meta name="description" content="a, b"></head></html>`))
+	}))
+	defer srv.Close()
+	path := writeSites(t, srv.URL)
+
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, WriterType: "csv", CSVHeader: []string{"url", "title", "description", "status_code", "verdict"}, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"url", "title", "description", "status_code", "verdict"},
+		{srv.URL, "tab\ttitle", "a, b", "200", "ok"},
+	}
+	if rows := readCSV(t, "good_site.csv"); !reflect.DeepEqual(rows, expected) {
+		t.Errorf("expected %q, got %q", expected, rows)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+)
+
+// ContextWriter - DataWriter, запись в который можно прервать через ctx,
+// например когда очередь AsyncWriter заполнена, а обход уже отменили
+type ContextWriter interface {
+	DataWriter
+	WriteCtx(ctx context.Context, data string) error
+}
+
+// WriteCtx пишет через WriteCtx, если w его умеет, иначе проверяет ctx и
+// вызывает обычный Write - так старые writer'ы работают без изменений
+func WriteCtx(ctx context.Context, w DataWriter, data string) error {
+	if cw, ok := w.(ContextWriter); ok {
+		return cw.WriteCtx(ctx, data)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.Write(data)
+}
+
+// contextRecordWriter - RecordWriter, который отдает ctx дальше в DataWriter
+type contextRecordWriter interface {
+	WriteRecordCtx(ctx context.Context, rec Record) error
+}
+
+func writeRecordCtx(ctx context.Context, w RecordWriter, rec Record) error {
+	if cw, ok := w.(contextRecordWriter); ok {
+		return cw.WriteRecordCtx(ctx, rec)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return w.WriteRecord(rec)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// NormalizeURL приводит url к виду для сравнения дублей: схема и хост в нижнем
+// регистре, без порта по умолчанию, слеша корня и фрагмента, не-ASCII
+// символы закодированы по RFC 3986. Query не трогается, http и https одного
+// хоста - разные сайты, /dir/ и /dir - разные страницы
+func NormalizeURL(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("%q: no host", raw)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+	if u.Path == "/" {
+		u.Path, u.RawPath = "", ""
+	}
+	u.RawQuery = escapeNonASCII(u.RawQuery)
+	u.Fragment, u.RawFragment = "", ""
+
+	return u.String(), nil
+}
+
+// urlKey - ключ для дедупликации и чекпоинта, битый url сравнивается как есть
+func urlKey(raw string) string {
+	if normalized, err := NormalizeURL(raw); err == nil {
+		return normalized
+	}
+	return raw
+}
+
+// escapeNonASCII кодирует байты вне ASCII, уже закодированное не трогает
+func escapeNonASCII(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c >= utf8.RuneSelf {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// mergeCategories дописывает в site категории дубля, которых у него еще нет
+func mergeCategories(site, dup *Site) {
+	for _, category := range dup.Categories {
+		found := false
+		for _, existing := range site.Categories {
+			if existing == category {
+				found = true
+				break
+			}
+		}
+		if !found {
+			site.Categories = append(site.Categories, category)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNormalizeURL(t *testing.T) {
+	cases := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"http://Example.COM/", "http://example.com", true},
+		{"http://example.com:80/a/", "http://example.com/a/", true},
+		{"http://example.com/a/", "http://example.com/a", false},
+		{"https://example.com:443/", "https://example.com", true},
+		{"http://example.com/a#top", "http://example.com/a", true},
+		{"HTTP://example.com", "http://example.com", true},
+		{"http://example.com:8080/", "http://example.com:8080", true},
+		{"http://example.com", "https://example.com", false},
+		{"http://example.com:8080", "http://example.com", false},
+		{"http://example.com/?q=1", "http://example.com/?q=2", false},
+		{"http://example.com/a?q=1", "http://example.com/a", false},
+		{"http://example.com/A", "http://example.com/a", false},
+	}
+	normalize := func(raw string) string {
+		t.Helper()
+		normalized, err := NormalizeURL(raw)
+		if err != nil {
+			t.Fatalf("%q: %v", raw, err)
+		}
+		return normalized
+	}
+	for _, tc := range cases {
+		a, b := normalize(tc.a), normalize(tc.b)
+		if (a == b) != tc.equal {
+			t.Errorf("%q vs %q: expected equal=%v, normalized to %q and %q", tc.a, tc.b, tc.equal, a, b)
+		}
+	}
+
+	exact := map[string]string{
+		"http://example.com/a?b=c":           "http://example.com/a?b=c",
+		"HTTPS://Пример.РФ/Путь/?q=значение": "https://%D0%BF%D1%80%D0%B8%D0%BC%D0%B5%D1%80.%D1%80%D1%84/%D0%9F%D1%83%D1%82%D1%8C/?q=%D0%B7%D0%BD%D0%B0%D1%87%D0%B5%D0%BD%D0%B8%D0%B5",
+		"http://example.com/a%20b?x=%41":     "http://example.com/a%20b?x=%41",
+	}
+	for raw, expected := range exact {
+		if got := normalize(raw); got != expected {
+			t.Errorf("%q: expected %q, got %q", raw, expected, got)
+		}
+	}
+
+	for _, raw := range []string{"example.com/path", "http://%zz", ""} {
+		if _, err := NormalizeURL(raw); err == nil {
+			t.Errorf("%q: expected error", raw)
+		}
+	}
+}
+
+func TestDedupSites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	lines := `{"url": "http://example.com/", "categories": ["news"]}
+{"url": "http://EXAMPLE.com:80", "categories": ["sport", "news"]}
+{"url": "https://example.com", "categories": ["news"]}
+{"url": "http://example.com/#about", "categories": ["blogs"]}
+{"url": "http://example.com/?page=2", "categories": ["news"]}
+`
+	if err := os.WriteFile(path, []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 100, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sitesChan, err := c.loadSites(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string][]string)
+	for site := range sitesChan {
+		categories := append([]string(nil), site.Categories...)
+		sort.Strings(categories)
+		got[site.Url] = categories
+	}
+
+	expected := map[string][]string{
+		"http://example.com/":        {"blogs", "news", "sport"},
+		"https://example.com":        {"news"},
+		"http://example.com/?page=2": {"news"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected sites after dedup:\n got %v\nwant %v", got, expected)
+	}
+	if c.totalCounter != 5 || c.duplicateCounter != 2 {
+		t.Errorf("expected 5 total and 2 deduplicated, got %d and %d", c.totalCounter, c.duplicateCounter)
+	}
+}
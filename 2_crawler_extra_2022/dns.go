@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	neturl "net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DNSPolicy - кэш DNS перед соединениями. Нулевое значение кэш выключает.
+// TTL - сколько помнить адреса хоста, NegativeTTL - сколько после неудачного
+// разрешения отвечать по хосту той же ошибкой, не спрашивая DNS, 0 - не помнить
+type DNSPolicy struct {
+	Enabled     bool
+	TTL         time.Duration
+	NegativeTTL time.Duration
+}
+
+var DefaultDNSPolicy = DNSPolicy{
+	Enabled:     true,
+	TTL:         5 * time.Minute,
+	NegativeTTL: 10 * time.Minute,
+}
+
+type dnsEntry struct {
+	// ready закрывается, когда разрешение закончено, до этого addrs и err не трогаем
+	ready   chan struct{}
+	addrs   []string
+	err     error
+	expires time.Time
+}
+
+// expired - под dnsCache.mu. Незаконченное разрешение не истекает
+func (e *dnsEntry) expired() bool {
+	select {
+	case <-e.ready:
+		return !time.Now().Before(e.expires)
+	default:
+		return false
+	}
+}
+
+// dnsCache разрешает каждый хост один раз на TTL, одновременные запросы к
+// одному хосту ждут общего ответа
+type dnsCache struct {
+	policy DNSPolicy
+	// timeout - на одно разрешение, как DialTimeout, 0 без ограничения
+	timeout time.Duration
+	lookup  func(ctx context.Context, host string) ([]string, error)
+
+	mu      sync.Mutex
+	entries map[string]*dnsEntry
+
+	hits   uint64
+	misses uint64
+}
+
+func newDNSCache(policy DNSPolicy, timeout time.Duration) *dnsCache {
+	if !policy.Enabled {
+		return nil
+	}
+	return &dnsCache{
+		policy:  policy,
+		timeout: timeout,
+		lookup:  net.DefaultResolver.LookupHost,
+		entries: make(map[string]*dnsEntry),
+	}
+}
+
+func (dc *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	dc.mu.Lock()
+	entry, ok := dc.entries[host]
+	if ok && entry.expired() {
+		ok = false
+	}
+	if ok {
+		atomic.AddUint64(&dc.hits, 1)
+	} else {
+		atomic.AddUint64(&dc.misses, 1)
+		entry = &dnsEntry{ready: make(chan struct{})}
+		dc.entries[host] = entry
+		// разрешение идет в своей горутине: отмена одного запроса не должна
+		// ломать ответ остальным, кто ждет этот же хост
+		go dc.fill(host, entry)
+	}
+	dc.mu.Unlock()
+
+	select {
+	case <-entry.ready:
+		return entry.addrs, entry.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (dc *dnsCache) fill(host string, entry *dnsEntry) {
+	ctx := context.Background()
+	if dc.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, dc.timeout)
+		defer cancel()
+	}
+	addrs, err := dc.lookup(ctx, host)
+	var dnsErr *net.DNSError
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	entry.addrs, entry.err = addrs, err
+	switch {
+	case err == nil:
+		entry.expires = time.Now().Add(dc.policy.TTL)
+	case errors.As(err, &dnsErr):
+		entry.expires = time.Now().Add(dc.policy.NegativeTTL)
+	default:
+		// прочие ошибки не запоминаем, следующий запрос спросит снова
+		entry.expires = time.Now()
+	}
+	close(entry.ready)
+}
+
+// failure - запомненная ошибка разрешения хоста url, nil если ее нет. Так
+// сайты на мертвых доменах отваливаются сразу, не тратя лимит запросов
+func (dc *dnsCache) failure(url string) error {
+	if dc == nil {
+		return nil
+	}
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil
+	}
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	entry, ok := dc.entries[u.Hostname()]
+	if !ok || entry.expired() {
+		return nil
+	}
+	select {
+	case <-entry.ready:
+	default:
+		return nil
+	}
+	if entry.err == nil {
+		return nil
+	}
+	atomic.AddUint64(&dc.hits, 1)
+	return entry.err
+}
+
+// dialContext - DialContext транспорта через кэш: адреса пробуются по очереди
+func (dc *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		addrs, err := dc.resolve(ctx, host)
+		if err != nil {
+			return nil, &net.OpError{Op: "dial", Net: network, Err: err}
+		}
+		var lastErr error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		if lastErr == nil {
+			lastErr = &net.OpError{Op: "dial", Net: network, Err: &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}}
+		}
+		return nil, lastErr
+	}
+}
+
+func (dc *dnsCache) counts() (hits, misses uint64) {
+	if dc == nil {
+		return 0, 0
+	}
+	return atomic.LoadUint64(&dc.hits), atomic.LoadUint64(&dc.misses)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDNSCache(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>alive</title></head></html>"))
+	}))
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	port := u.Port()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy, DNS: DefaultDNSPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lookups int32
+	c.parser.dns.lookup = func(ctx context.Context, host string) ([]string, error) {
+		atomic.AddInt32(&lookups, 1)
+		time.Sleep(10 * time.Millisecond)
+		if host == "alive.test" {
+			return []string{"127.0.0.1"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	// одновременные запросы к одному хосту разрешают его один раз
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p, err := c.fetchPage(context.Background(), &Site{Url: "http://alive.test:" + port + "/"})
+			if err != nil || p.meta.Title != "alive" {
+				t.Errorf("unexpected result %v %v", p, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Errorf("expected one lookup for a repeated host, got %d", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		_, err := c.fetchPage(context.Background(), &Site{Url: "http://dead.test:" + port + "/page"})
+		var dnsErr *net.DNSError
+		if !errors.As(err, &dnsErr) || classifyError(err) != "dns" {
+			t.Fatalf("attempt %d: expected a dns error, got %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&lookups); n != 2 {
+		t.Errorf("expected the failed host to be resolved once, got %d lookups", n)
+	}
+	if report := c.buildReport(time.Second, nil); report.DNSCacheMisses != 2 || report.DNSCacheHits < 2 {
+		t.Errorf("unexpected dns counters: hits %d, misses %d", report.DNSCacheHits, report.DNSCacheMisses)
+	}
+
+	// после NegativeTTL хост спрашивается снова
+	c.parser.dns.policy.NegativeTTL = 0
+	c.parser.dns.mu.Lock()
+	c.parser.dns.entries["dead.test"].expires = time.Now()
+	c.parser.dns.mu.Unlock()
+	c.fetchPage(context.Background(), &Site{Url: "http://dead.test:" + port + "/page"})
+	if n := atomic.LoadInt32(&lookups); n != 3 {
+		t.Errorf("expected an expired failure to be looked up again, got %d lookups", n)
+	}
+
+	off, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off.parser.dns != nil {
+		t.Errorf("a zero DNSPolicy must disable the cache")
+	}
+}
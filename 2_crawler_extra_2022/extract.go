@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+type PageMeta struct {
+	Title       string
+	OGTitle     string
+	Description string
+	Canonical   string
+	Favicon     string
+	Language    string
+	Robots      string
+}
+
+// robotsDirectiveOrder - директивы, которые мы выносим в выдачу, в порядке вывода
+var robotsDirectiveOrder = []string{"noindex", "nofollow", "noarchive"}
+
+// extractMetadata собирает метаданные страницы, относительные ссылки
+// резолвятся от baseURL - адреса, с которого страница реально отдалась
+func extractMetadata(doc *goquery.Document, baseURL string, header http.Header) (PageMeta, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return PageMeta{}, err
+	}
+
+	meta := PageMeta{
+		Title:       strings.TrimSpace(doc.Find("title").First().Text()),
+		OGTitle:     doc.Find("meta[property='og:title']").AttrOr("content", ""),
+		Description: doc.Find("meta[name=description]").AttrOr("content", ""),
+		Language:    doc.Find("html").AttrOr("lang", ""),
+	}
+	if meta.OGTitle == "" {
+		meta.OGTitle = meta.Title
+	}
+	if meta.Description == "" {
+		meta.Description = doc.Find("meta[property='og:description']").AttrOr("content", "")
+	}
+	if meta.Language == "" && header != nil {
+		meta.Language = strings.TrimSpace(strings.Split(header.Get("Content-Language"), ",")[0])
+	}
+
+	meta.Robots = robotsDirectives(header, doc)
+	meta.Canonical = resolveRef(base, doc.Find("link[rel=canonical]").AttrOr("href", ""))
+	doc.Find("link[rel]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		for _, rel := range strings.Fields(strings.ToLower(s.AttrOr("rel", ""))) {
+			if rel == "icon" {
+				meta.Favicon = resolveRef(base, s.AttrOr("href", ""))
+				return false
+			}
+		}
+		return true
+	})
+
+	return meta, nil
+}
+
+// robotsDirectives объединяет X-Robots-Tag и meta robots. Директивы только
+// запрещающие, так что при конфликте (index против noindex) побеждает запрет
+func robotsDirectives(header http.Header, doc *goquery.Document) string {
+	var values []string
+	if header != nil {
+		values = append(values, header.Values("X-Robots-Tag")...)
+	}
+	doc.Find("meta[name]").Each(func(_ int, s *goquery.Selection) {
+		if strings.EqualFold(s.AttrOr("name", ""), "robots") {
+			values = append(values, s.AttrOr("content", ""))
+		}
+	})
+
+	found := make(map[string]bool)
+	for _, value := range values {
+		// "googlebot: noindex" относится к чужому боту, а "unavailable_after: date" не директива запрета
+		if agent, rest, ok := strings.Cut(value, ":"); ok && !strings.Contains(agent, ",") {
+			agent = strings.ToLower(strings.TrimSpace(agent))
+			if agent != "robots" && agent != "*" {
+				continue
+			}
+			value = rest
+		}
+		for _, d := range strings.Split(value, ",") {
+			switch d = strings.ToLower(strings.TrimSpace(d)); d {
+			case "none":
+				found["noindex"], found["nofollow"] = true, true
+			default:
+				found[d] = true
+			}
+		}
+	}
+
+	var directives []string
+	for _, d := range robotsDirectiveOrder {
+		if found[d] {
+			directives = append(directives, d)
+		}
+	}
+	return strings.Join(directives, ",")
+}
+
+func resolveRef(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// extractLinks - абсолютные http(s) ссылки страницы без фрагментов и повторов
+func extractLinks(doc *goquery.Document, base *url.URL) []string {
+	var links []string
+	seen := make(map[string]struct{})
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		u, err := base.Parse(strings.TrimSpace(href))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		u.Fragment, u.RawFragment = "", ""
+		link := u.String()
+		if _, ok := seen[link]; ok {
+			return
+		}
+		seen[link] = struct{}{}
+		links = append(links, link)
+	})
+	return links
+}
+
+// ExtractionRule достает одно поле страницы. Пустой Attr - текст элемента.
+// Несколько правил подряд с одним Name - это запасные варианты для одной колонки:
+// берется первое непустое значение. RecordProtocol без Selector пишет в колонку
+// протокол ответа, например HTTP/2.0
+type ExtractionRule struct {
+	Name           string
+	Selector       string
+	Attr           string
+	RecordProtocol bool
+}
+
+var DefaultExtractionRules = []ExtractionRule{
+	{Name: "title", Selector: "title"},
+	{Name: "description", Selector: "meta[name=description]", Attr: "content"},
+	{Name: "description", Selector: "meta[property='og:description']", Attr: "content"},
+}
+
+type Field struct {
+	Name  string
+	Value string
+}
+
+func validateRules(rules []ExtractionRule) error {
+	for i, rule := range rules {
+		if rule.Name == "" || (rule.Selector == "") != rule.RecordProtocol {
+			return fmt.Errorf("extraction rule %d: name and either selector or record protocol are required", i)
+		}
+	}
+	return nil
+}
+
+// applyRules возвращает по одному полю на каждое имя в порядке правил,
+// proto - протокол ответа для правил с RecordProtocol
+func applyRules(doc *goquery.Document, rules []ExtractionRule, proto string) []Field {
+	var fields []Field
+	for _, rule := range rules {
+		if len(fields) == 0 || fields[len(fields)-1].Name != rule.Name {
+			fields = append(fields, Field{Name: rule.Name})
+		}
+		field := &fields[len(fields)-1]
+		if field.Value != "" {
+			continue
+		}
+		if rule.RecordProtocol {
+			field.Value = proto
+			continue
+		}
+		s := doc.Find(rule.Selector).First()
+		if rule.Attr == "" {
+			field.Value = strings.TrimSpace(s.Text())
+		} else {
+			field.Value = s.AttrOr(rule.Attr, "")
+		}
+	}
+	return fields
+}
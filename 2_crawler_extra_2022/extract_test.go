@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestExtractMetadata(t *testing.T) {
+	cases := []struct {
+		name    string
+		html    string
+		baseURL string
+		header  http.Header
+		meta    PageMeta
+	}{
+		{
+			name: "full head",
+			html: `<html lang="ru"><head>
+				<title> 6 продуктов </title>
+				<meta property="og:title" content="OG title">
+				<meta name="description" content="desc">
+				<link rel="canonical" href="/journal/6-produktov">
+				<link rel="shortcut icon" href="static/favicon.png">
+				</head></html>`,
+			baseURL: "https://ura-povara.ru/journal/old",
+			meta: PageMeta{
+				Title:       "6 продуктов",
+				OGTitle:     "OG title",
+				Description: "desc",
+				Canonical:   "https://ura-povara.ru/journal/6-produktov",
+				Favicon:     "https://ura-povara.ru/journal/static/favicon.png",
+				Language:    "ru",
+			},
+		},
+		{
+			name: "fallbacks",
+			html: `<html><head>
+				<title>Title</title>
+				<meta property="og:description" content="og desc">
+				<link rel="icon" href="//cdn.example.com/i.ico">
+				</head></html>`,
+			baseURL: "http://example.com/",
+			header:  http.Header{"Content-Language": {"en-US, de"}},
+			meta: PageMeta{
+				Title:       "Title",
+				OGTitle:     "Title",
+				Description: "og desc",
+				Favicon:     "http://cdn.example.com/i.ico",
+				Language:    "en-US",
+			},
+		},
+		{
+			name:    "empty page",
+			html:    `<html><body>nothing here</body></html>`,
+			baseURL: "http://example.com/",
+			meta:    PageMeta{},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tc.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta, err := extractMetadata(doc, tc.baseURL, tc.header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if meta != tc.meta {
+				t.Errorf("unexpected metadata\nGot: %+v\nExpected: %+v", meta, tc.meta)
+			}
+		})
+	}
+}
+
+func TestRobotsDirectives(t *testing.T) {
+	cases := []struct {
+		name   string
+		header http.Header
+		meta   string
+		robots string
+	}{
+		{"none", nil, "", ""},
+		{"header only", http.Header{"X-Robots-Tag": {"noindex, NoArchive"}}, "", "noindex,noarchive"},
+		{"meta only", nil, `<meta name="robots" content="nofollow">`, "nofollow"},
+		{"both agreeing", http.Header{"X-Robots-Tag": {"noindex"}}, `<meta name="ROBOTS" content="noindex">`, "noindex"},
+		{"conflicting", http.Header{"X-Robots-Tag": {"index, follow"}}, `<meta name="robots" content="noindex">`, "noindex"},
+		{"none expands", http.Header{"X-Robots-Tag": {"none"}}, `<meta name="robots" content="noarchive">`, "noindex,nofollow,noarchive"},
+		{"other bot", http.Header{"X-Robots-Tag": {"googlebot: noindex", "robots: nofollow"}}, "", "nofollow"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader("<html><head>" + tc.meta + "</head></html>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := robotsDirectives(tc.header, doc); got != tc.robots {
+				t.Errorf("expected %q, got %q", tc.robots, got)
+			}
+		})
+	}
+}
+
+func TestApplyRules(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<html><head>
+		<title>Title</title>
+		<meta property="og:description" content="og desc">
+		<meta property="og:price" content="100">
+		</head><body><h1> Header </h1><h1>Second</h1></body></html>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := applyRules(doc, DefaultExtractionRules, "HTTP/1.1")
+	expected := []Field{{"title", "Title"}, {"description", "og desc"}}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("default rules: expected %v, got %v", expected, fields)
+	}
+
+	fields = applyRules(doc, []ExtractionRule{
+		{Name: "h1", Selector: "h1"},
+		{Name: "price", Selector: "meta[property='og:price']", Attr: "content"},
+		{Name: "missing", Selector: "article"},
+		{Name: "protocol", RecordProtocol: true},
+	}, "HTTP/1.1")
+	expected = []Field{{"h1", "Header"}, {"price", "100"}, {"missing", ""}, {"protocol", "HTTP/1.1"}}
+	if !reflect.DeepEqual(fields, expected) {
+		t.Errorf("custom rules: expected %v, got %v", expected, fields)
+	}
+
+	if _, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1, Workers: 1, Status: DefaultStatusPolicy, Rules: []ExtractionRule{{Name: "h1"}}}); err == nil {
+		t.Error("expected rule without selector to be rejected")
+	}
+	if _, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1, Workers: 1, Status: DefaultStatusPolicy, Rules: []ExtractionRule{{Name: "h1", Selector: "h1", RecordProtocol: true}}}); err == nil {
+		t.Error("expected protocol rule with a selector to be rejected")
+	}
+}
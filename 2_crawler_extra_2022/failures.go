@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// HTTPStatusError - ответ не 200, URL конечный после всех редиректов.
+// Location - куда вел редирект, который не стали раскрывать
+type HTTPStatusError struct {
+	URL        string
+	StatusCode int
+	Location   string
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.Location != "" {
+		return fmt.Sprintf("%s: unexpected status %d, redirect to %s", e.URL, e.StatusCode, e.Location)
+	}
+	return fmt.Sprintf("%s: unexpected status %d", e.URL, e.StatusCode)
+}
+
+// ParseError - страницу скачали, но не смогли разобрать
+type ParseError struct {
+	URL string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: parse: %v", e.URL, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// recordFailure пишет неудавшийся сайт в Errors, если он задан: url, статус, вердикт, ошибка.
+// Для ошибок статуса берется конечный URL, для остальных статус 0
+func (c *Crawler) recordFailure(site *Site, err error) {
+	if c.failures == nil {
+		return
+	}
+	url, status := site.Url, 0
+	var sErr *HTTPStatusError
+	if errors.As(err, &sErr) {
+		url, status = sErr.URL, sErr.StatusCode
+	}
+	columns := []string{url, strconv.Itoa(status), siteVerdict(err, ""), err.Error()}
+	for i, col := range columns {
+		columns[i] = tsvEscaper.Replace(col)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if wErr := c.failures.Write(strings.Join(columns, "\t") + "\n"); wErr != nil {
+		log.Printf(wErr.Error())
+	}
+}
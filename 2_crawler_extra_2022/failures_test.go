@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFailuresRecorded(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.Handle("/moved", http.RedirectHandler("/broken", http.StatusFound))
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	status := DefaultStatusPolicy
+	status.SkipCodes = nil
+	status.ErrorCodes = []int{http.StatusNotFound, http.StatusInternalServerError}
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Status: status})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.fetchPage(context.Background(), &Site{Url: srv.URL + "/moved"})
+	var sErr *HTTPStatusError
+	if !errors.As(err, &sErr) {
+		t.Fatalf("expected HTTPStatusError, got %v", err)
+	}
+	if sErr.URL != srv.URL+"/broken" || sErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("unexpected status error %+v", sErr)
+	}
+
+	errs := &memWriter{}
+	c.failures = errs
+	if err := c.Start(context.Background(), writeSites(t, srv.URL+"/ok", srv.URL+"/missing", srv.URL+"/moved")); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs.lines) != 2 {
+		t.Fatalf("expected 2 failed sites, got %q", errs.lines)
+	}
+	sort.Strings(errs.lines)
+	expected := []string{srv.URL + "/broken\t500\t", srv.URL + "/missing\t404\t"}
+	for i, line := range errs.lines {
+		if !strings.HasPrefix(line, expected[i]) || !strings.Contains(line, "unexpected status") {
+			t.Errorf("unexpected errors line %q", line)
+		}
+	}
+	if errs.flushes == 0 {
+		t.Error("errors writer was not flushed")
+	}
+	if c.failedCounter != 2 || c.succeededCounter != 1 {
+		t.Errorf("unexpected counters: %d failed, %d succeeded", c.failedCounter, c.succeededCounter)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// FeedMode - как отличать RSS/Atom от html: по умолчанию FeedAuto смотрит на
+// Content-Type и начало тела, FeedHTML и FeedAlways отключают угадывание
+type FeedMode string
+
+const (
+	FeedAuto   FeedMode = "auto"
+	FeedHTML   FeedMode = "html"
+	FeedAlways FeedMode = "feed"
+)
+
+// feedSniffBytes - сколько байт начала тела смотреть в поисках корня ленты
+const feedSniffBytes = 1024
+
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+}
+
+// feedDoc покрывает RSS 2.0, RSS 1.0 (rdf, где item лежат рядом с channel) и Atom
+type feedDoc struct {
+	XMLName  xml.Name
+	Channel  *rssChannel `xml:"channel"`
+	Items    []feedItem  `xml:"item"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle"`
+	Entries  []feedItem  `xml:"entry"`
+}
+
+type rssChannel struct {
+	Title       string     `xml:"title"`
+	Description string     `xml:"description"`
+	Items       []feedItem `xml:"item"`
+}
+
+type feedItem struct {
+	Title     string `xml:"title"`
+	PubDate   string `xml:"pubDate"`
+	Date      string `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Updated   string `xml:"updated"`
+	Published string `xml:"published"`
+}
+
+func (fi feedItem) date() string {
+	for _, d := range []string{fi.PubDate, fi.Updated, fi.Published, fi.Date} {
+		if d = strings.TrimSpace(d); d != "" {
+			return d
+		}
+	}
+	return ""
+}
+
+// feedInfo - то, что идет в выдачу вместо разбора html
+type feedInfo struct {
+	Title       string
+	Description string
+	Items       int
+	LatestTitle string
+	// LatestDate - дата последней записи в RFC3339, или как в ленте, если не разобралась
+	LatestDate string
+}
+
+func (fi feedInfo) fields() []Field {
+	return []Field{
+		{"title", fi.Title},
+		{"description", fi.Description},
+		{"feed_items", strconv.Itoa(fi.Items)},
+		{"latest_title", fi.LatestTitle},
+		{"latest_date", fi.LatestDate},
+	}
+}
+
+// isFeed решает по Content-Type, а для общих xml и text/plain - по корню документа.
+// html-страница со ссылкой на ленту остается html: ее корень не rss и не feed
+func isFeed(contentType string, body *bufio.Reader) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "application/rss+xml", "application/atom+xml", "application/rdf+xml":
+		return true
+	case "text/html", "application/xhtml+xml":
+		return false
+	}
+	prefix, _ := body.Peek(feedSniffBytes)
+	return feedRoot(prefix)
+}
+
+// feedRoot пропускает пролог xml, комментарии и doctype и смотрит на первый элемент
+func feedRoot(prefix []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(prefix))
+	decoder.Strict = false
+	decoder.CharsetReader = charset.NewReaderLabel
+	for {
+		tok, err := decoder.RawToken()
+		if err != nil {
+			return false
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			return name == "rss" || name == "feed" || (name == "rdf" && strings.EqualFold(t.Name.Space, "rdf"))
+		case xml.CharData:
+			if len(bytes.TrimSpace(t)) > 0 {
+				return false
+			}
+		}
+	}
+}
+
+// parseFeed кодировку берет из пролога xml, поэтому тело сюда идет без перекодирования
+func parseFeed(r io.Reader) (feedInfo, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	var doc feedDoc
+	if err := decoder.Decode(&doc); err != nil {
+		return feedInfo{}, fmt.Errorf("feed: %w", err)
+	}
+
+	var info feedInfo
+	var items []feedItem
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		if doc.Channel == nil {
+			return feedInfo{}, fmt.Errorf("feed: no channel in <%s>", doc.XMLName.Local)
+		}
+		info.Title, info.Description = doc.Channel.Title, doc.Channel.Description
+		items = append(doc.Channel.Items, doc.Items...)
+	case "feed":
+		info.Title, info.Description = doc.Title, doc.Subtitle
+		items = doc.Entries
+	default:
+		return feedInfo{}, fmt.Errorf("feed: unexpected root <%s>", doc.XMLName.Local)
+	}
+	info.Title = collapseSpaces(info.Title)
+	info.Description = collapseSpaces(info.Description)
+	info.Items = len(items)
+
+	// ленты обычно идут от новых к старым, но не все, поэтому ищем по дате;
+	// без разборчивых дат последней считается первая запись
+	var latest time.Time
+	for i, item := range items {
+		date, ok := parseFeedDate(item.date())
+		if i == 0 || (ok && date.After(latest)) {
+			info.LatestTitle = collapseSpaces(item.Title)
+			info.LatestDate = item.date()
+			if ok {
+				latest = date
+				info.LatestDate = date.UTC().Format(time.RFC3339)
+			}
+		}
+	}
+	return info, nil
+}
+
+func parseFeedDate(value string) (time.Time, bool) {
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (c *Crawler) isFeedResponse(resp *http.Response, body *bufio.Reader) bool {
+	switch c.feedMode {
+	case FeedHTML:
+		return false
+	case FeedAlways:
+		return true
+	default:
+		return isFeed(resp.Header.Get("Content-Type"), body)
+	}
+}
+
+// parseFeedPage - ветка fetchAndParse для лент: html-извлечение, правила и
+// ссылки пропускаются, в выдачу идут поля ленты
+func (c *Crawler) parseFeedPage(resp *http.Response, body io.Reader, url string, start time.Time, remoteAddr string) (*page, error) {
+	info, err := parseFeed(body)
+	if err != nil {
+		return nil, &ParseError{URL: url, Err: err}
+	}
+
+	latency := time.Since(start)
+	atomic.AddUint64(&c.fetchedCounter, 1)
+	atomic.AddInt64(&c.latencyTotal, int64(latency))
+
+	meta := PageMeta{Title: info.Title, Description: info.Description}
+	fields := info.fields()
+	if c.cache != nil {
+		c.cache.put(url, resp.Header, meta, fields, nil)
+	}
+	return &page{
+		meta:       meta,
+		fields:     fields,
+		statusCode: resp.StatusCode,
+		fetchedAt:  time.Now(),
+		finalURL:   resp.Request.URL.String(),
+		remoteAddr: remoteAddr,
+		latency:    latency,
+	}, nil
+}
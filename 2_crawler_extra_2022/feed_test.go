@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var feedFixtures = map[string]struct {
+	contentType string
+	body        string
+}{
+	"/rss": {"application/rss+xml", `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+  <channel>
+    <title>  Example   blog </title>
+    <description>Notes about Go</description>
+    <item><title>Older post</title><pubDate>Mon, 01 Jan 2024 10:00:00 +0000</pubDate></item>
+    <item><title>Newest post</title><pubDate>Wed, 3 Jan 2024 12:30:00 +0300</pubDate></item>
+    <item><title>Middle post</title><pubDate>Tue, 02 Jan 2024 10:00:00 +0000</pubDate></item>
+  </channel>
+</rss>`},
+	// text/xml без явного типа ленты узнается по корню
+	"/atom": {"text/xml; charset=utf-8", `<?xml version="1.0" encoding="utf-8"?>
+<!-- generated -->
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title>Atom blog</title>
+  <subtitle>Release notes</subtitle>
+  <entry><title>v2</title><updated>2024-02-01T08:00:00Z</updated></entry>
+  <entry><title>v1</title><updated>2024-01-01T08:00:00Z</updated></entry>
+</feed>`},
+	"/broken": {"application/rss+xml", `<rss><channel><title>Broken</title><item></channel>`},
+	"/html": {"text/html", `<!DOCTYPE html><html><head><title>Blog home</title>
+<link rel="alternate" type="application/rss+xml" href="/rss"></head><body><a href="/rss">RSS</a></body></html>`},
+}
+
+func TestFeeds(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fixture, ok := feedFixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", fixture.contentType)
+		w.Write([]byte(fixture.body))
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetch := func(path string) (*page, error) {
+		return c.fetchPage(context.Background(), &Site{Url: srv.URL + path})
+	}
+	fieldMap := func(p *page) map[string]string {
+		m := make(map[string]string)
+		for _, f := range p.fields {
+			m[f.Name] = f.Value
+		}
+		return m
+	}
+
+	cases := []struct {
+		path   string
+		fields map[string]string
+	}{
+		{"/rss", map[string]string{"title": "Example blog", "description": "Notes about Go", "feed_items": "3", "latest_title": "Newest post", "latest_date": "2024-01-03T09:30:00Z"}},
+		{"/atom", map[string]string{"title": "Atom blog", "description": "Release notes", "feed_items": "2", "latest_title": "v2", "latest_date": "2024-02-01T08:00:00Z"}},
+	}
+	for _, tc := range cases {
+		p, err := fetch(tc.path)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		got := fieldMap(p)
+		for name, want := range tc.fields {
+			if got[name] != want {
+				t.Errorf("%s: %s = %q, want %q", tc.path, name, got[name], want)
+			}
+		}
+		if p.meta.Title != tc.fields["title"] {
+			t.Errorf("%s: unexpected meta title %q", tc.path, p.meta.Title)
+		}
+	}
+
+	_, err = fetch("/broken")
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || classifyError(err) != "parse" {
+		t.Errorf("expected a parse failure for malformed xml, got %v", err)
+	}
+
+	p, err := fetch("/html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fieldMap(p)["feed_items"]; ok || p.meta.Title != "Blog home" {
+		t.Errorf("a page linking to a feed must stay html, got %+v %+v", p.meta, p.fields)
+	}
+
+	c.feedMode = FeedHTML
+	if p, err = fetch("/rss"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fieldMap(p)["feed_items"]; ok {
+		t.Errorf("FeedHTML must skip the feed parser, got %+v", p.fields)
+	}
+}
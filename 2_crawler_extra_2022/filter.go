@@ -0,0 +1,56 @@
+package main
+
+import "strings"
+
+// SiteFilter отбирает сайты из входа до постановки в очередь, так что
+// отфильтрованные не тратят лимиты. Пустые поля ничего не отсекают
+type SiteFilter struct {
+	// States - допустимые значения Site.State
+	States []string
+	// ForMainPageOnly - только сайты с for_main_page
+	ForMainPageOnly bool
+	// Categories - белый список: сайт без подходящих категорий пропускается,
+	// у остальных остаются только подходящие
+	Categories []string
+}
+
+// splitList разбирает список через запятую из флага, пустая строка - nil
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// apply решает, обходить ли сайт, и урезает его категории до белого списка
+func (f SiteFilter) apply(site *Site) bool {
+	if len(f.States) > 0 && !contains(f.States, site.State) {
+		return false
+	}
+	if f.ForMainPageOnly && !site.ForMainPage {
+		return false
+	}
+	if len(f.Categories) == 0 {
+		return true
+	}
+	var categories []string
+	for _, category := range site.Categories {
+		if contains(f.Categories, category) {
+			categories = append(categories, category)
+		}
+	}
+	site.Categories = categories
+	return len(categories) > 0
+}
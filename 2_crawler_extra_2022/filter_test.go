@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSiteFilter(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	sites := []string{
+		`{"url": "%s/approved", "state": "approved", "categories": ["news", "spam"], "for_main_page": true}`,
+		`{"url": "%s/disabled", "state": "disabled", "categories": ["news"], "for_main_page": true}`,
+		`{"url": "%s/not-main", "state": "approved", "categories": ["news"], "for_main_page": false}`,
+		`{"url": "%s/other", "state": "approved", "categories": ["spam"], "for_main_page": true}`,
+		`{"url": "%s/pending", "state": "pending", "categories": ["blogs"], "for_main_page": true}`,
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, site := range sites {
+		fmt.Fprintf(file, site+"\n", srv.URL)
+	}
+	file.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Filter: SiteFilter{States: []string{"approved", "pending"}, ForMainPageOnly: true, Categories: []string{"news", "blogs"}}, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := &memWriter{}
+	RegisterWriterFactory("test-filter", func(string) (DataWriter, error) { return mw, nil })
+	c.writerType = "test-filter"
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	report := c.Report()
+	if report.Total != 5 || report.Filtered != 3 || report.Succeeded != 2 || report.Failed != 0 || hits != 2 {
+		t.Errorf("unexpected report %+v with %d requests", report, hits)
+	}
+	// spam у первого сайта отрезан белым списком
+	expected := map[string]int{"news": 1, "blogs": 1}
+	if !reflect.DeepEqual(report.Categories, expected) {
+		t.Errorf("expected category lines %v, got %v", expected, report.Categories)
+	}
+	var urls []string
+	for _, line := range mw.lines {
+		urls = append(urls, strings.SplitN(line, "\t", 2)[0])
+	}
+	sort.Strings(urls)
+	if !reflect.DeepEqual(urls, []string{srv.URL + "/approved", srv.URL + "/pending"}) {
+		t.Errorf("unexpected output %q", mw.lines)
+	}
+}
@@ -4,12 +4,13 @@ go 1.20
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.1
+	github.com/andybalholm/cascadia v1.3.2
 	github.com/hashicorp/go-multierror v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.22
 	golang.org/x/net v0.19.0
 )
 
 require (
-	github.com/andybalholm/cascadia v1.3.2 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
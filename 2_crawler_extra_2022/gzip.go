@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"os"
+)
+
+// GzipFileWriter - FileWriter со сжатием, каждый запуск дописывает в файл
+// отдельный gzip member, gzip -d и zcat читают такие файлы целиком
+type GzipFileWriter struct {
+	*gzip.Writer
+	buf  *bufio.Writer
+	file *os.File
+}
+
+func NewGzipFileWriter(filename string) (DataWriter, error) {
+	file, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(file)
+	return &GzipFileWriter{Writer: gzip.NewWriter(buf), buf: buf, file: file}, nil
+}
+
+func (gw *GzipFileWriter) Write(data string) error {
+	_, err := gw.Writer.Write([]byte(data))
+	return err
+}
+
+func (gw *GzipFileWriter) WriteCtx(ctx context.Context, data string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return gw.Write(data)
+}
+
+// Empty - файл новый и в него еще не писали, даже заголовок gzip
+func (gw *GzipFileWriter) Empty() bool {
+	if gw.buf.Buffered() > 0 {
+		return false
+	}
+	info, err := gw.file.Stat()
+	return err == nil && info.Size() == 0
+}
+
+// Flush сбрасывает сжатый блок до самого файла
+func (gw *GzipFileWriter) Flush() error {
+	if err := gw.Writer.Flush(); err != nil {
+		return err
+	}
+	return gw.buf.Flush()
+}
+
+// Close сначала закрывает gzip, он дописывает футер с crc, и только потом файл
+func (gw *GzipFileWriter) Close() error {
+	if err := gw.Writer.Close(); err != nil {
+		gw.file.Close()
+		return err
+	}
+	if err := gw.buf.Flush(); err != nil {
+		gw.file.Close()
+		return err
+	}
+	return gw.file.Close()
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGzipFileWriter(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	path := writeSites(t, srv.URL+"/a", srv.URL+"/b")
+
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	// второй запуск дописывает новый gzip member в тот же файл
+	for i := 0; i < 2; i++ {
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, WriterType: "gzip", Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Start(context.Background(), path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := os.Open("good_site.tsv.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// без футера ReadAll вернул бы io.ErrUnexpectedEOF
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], srv.URL) || !strings.Contains(lines[0], "\tok\t") {
+		t.Errorf("unexpected content %q", data)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// httpCacheEntry - валидаторы ответа и то, что мы из него достали,
+// на 304 страница собирается отсюда без разбора
+type httpCacheEntry struct {
+	URL          string   `json:"url"`
+	ETag         string   `json:"etag,omitempty"`
+	LastModified string   `json:"last_modified,omitempty"`
+	Meta         PageMeta `json:"meta"`
+	Fields       []Field  `json:"fields,omitempty"`
+	// CategoryFields - поля по Options.Selectors, ключ - категория из Selectors
+	CategoryFields map[string][]Field `json:"category_fields,omitempty"`
+}
+
+// HTTPCache хранит ETag и Last-Modified по нормализованному URL между запусками.
+// Файл - jsonl, читается один раз в NewCrawler и целиком переписывается в конце Start
+type HTTPCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]*httpCacheEntry
+}
+
+func loadHTTPCache(path string) (*HTTPCache, error) {
+	hc := &HTTPCache{path: path, entries: make(map[string]*httpCacheEntry)}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return hc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var entry httpCacheEntry
+		if err := decoder.Decode(&entry); err != nil {
+			return nil, err
+		}
+		hc.entries[urlKey(entry.URL)] = &entry
+	}
+	return hc, nil
+}
+
+func (hc *HTTPCache) get(url string) *httpCacheEntry {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	return hc.entries[urlKey(url)]
+}
+
+// put запоминает ответ, если серверу есть чем его валидировать
+func (hc *HTTPCache) put(url string, header http.Header, meta PageMeta, fields []Field, categoryFields map[string][]Field) {
+	entry := &httpCacheEntry{
+		URL:            url,
+		ETag:           header.Get("ETag"),
+		LastModified:   header.Get("Last-Modified"),
+		Meta:           meta,
+		Fields:         fields,
+		CategoryFields: categoryFields,
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if entry.ETag == "" && entry.LastModified == "" {
+		delete(hc.entries, urlKey(url))
+		return
+	}
+	hc.entries[urlKey(url)] = entry
+}
+
+func (entry *httpCacheEntry) setConditional(req *http.Request) {
+	if entry.ETag != "" {
+		req.Header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.LastModified)
+	}
+}
+
+// save пишет кэш во временный файл рядом и переименовывает, чтобы
+// упавший на середине запуск не оставил обрезанный кэш
+func (hc *HTTPCache) save() error {
+	tmp, err := os.CreateTemp(filepath.Dir(hc.path), filepath.Base(hc.path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hc.mu.Lock()
+	encoder := json.NewEncoder(tmp)
+	for _, entry := range hc.entries {
+		if err = encoder.Encode(entry); err != nil {
+			break
+		}
+	}
+	hc.mu.Unlock()
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), hc.path)
+}
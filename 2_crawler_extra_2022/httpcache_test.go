@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHTTPCache(t *testing.T) {
+	var full, conditional uint32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/etag", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddUint32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddUint32(&full, 1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte(`<html><head><title>etag</title><meta name="description" content="cached"></head></html>`))
+	})
+	mux.HandleFunc("/modified", func(w http.ResponseWriter, r *http.Request) {
+		const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			atomic.AddUint32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddUint32(&full, 1)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte("<html><head><title>modified</title></head></html>"))
+	})
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(&full, 1)
+		w.Write([]byte("<html><head><title>plain</title></head></html>"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cachePath := filepath.Join(t.TempDir(), "http_cache.jsonl")
+	path := writeSites(t, srv.URL+"/etag", srv.URL+"/modified", srv.URL+"/plain")
+	run := func() (RunReport, map[string]jsonRecord) {
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, CachePath: cachePath, Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mw := &memWriter{}
+		RegisterWriterFactory("test-http-cache", func(string) (DataWriter, error) { return mw, nil })
+		c.writerType = "test-http-cache-json"
+		if err := c.Start(context.Background(), path); err != nil {
+			t.Fatal(err)
+		}
+		records := map[string]jsonRecord{}
+		for _, line := range mw.lines {
+			var rec jsonRecord
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatal(err)
+			}
+			records[rec.URL] = rec
+		}
+		return c.Report(), records
+	}
+
+	report, _ := run()
+	if report.Succeeded != 3 || report.NotModified != 0 || full != 3 {
+		t.Fatalf("unexpected first run: %+v, %d full responses", report, full)
+	}
+	if _, err := os.Stat(cachePath); err != nil {
+		t.Fatal(err)
+	}
+
+	report, records := run()
+	if report.Succeeded != 3 || report.NotModified != 2 || conditional != 2 || full != 4 {
+		t.Errorf("unexpected second run: %+v, %d full and %d conditional responses", report, full, conditional)
+	}
+	if rec := records[srv.URL+"/etag"]; rec.Title != "etag" || rec.Description != "cached" || rec.StatusCode != http.StatusNotModified {
+		t.Errorf("expected cached metadata for a 304, got %+v", rec.Record)
+	}
+	if rec := records[srv.URL+"/modified"]; rec.Title != "modified" {
+		t.Errorf("expected cached title, got %+v", rec.Record)
+	}
+}
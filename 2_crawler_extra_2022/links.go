@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+const defaultLinksPath = "links.tsv"
+
+// enqueue отдает сайт воркерам, не блокируя вызывающего. Сайт считается
+// в pendingWg до передачи воркеру, а при переходе по ссылкам - пока воркер
+// его не обработает, чтобы канал не закрылся раньше, чем придут дочерние
+func (c *Crawler) enqueue(ctx context.Context, site *Site) {
+	site.pending = c.maxDepth > 0
+	c.pendingWg.Add(1)
+	go func() {
+		select {
+		case c.sitesChan <- site:
+			if !site.pending {
+				c.pendingWg.Done()
+			}
+		case <-ctx.Done():
+			c.pendingWg.Done()
+		}
+	}()
+}
+
+// enqueueAll отдает исходные сайты из одной горутины по порядку, вместо
+// горутины на каждый, как у enqueue. Все сайты считаются в pendingWg сразу,
+// а после отмены ctx неотданные снимаются разом
+func (c *Crawler) enqueueAll(ctx context.Context, sites []*Site) {
+	for _, site := range sites {
+		site.pending = c.maxDepth > 0
+	}
+	c.pendingWg.Add(len(sites))
+	go func() {
+		for i, site := range sites {
+			select {
+			case c.sitesChan <- site:
+				if !site.pending {
+					c.pendingWg.Done()
+				}
+			case <-ctx.Done():
+				c.pendingWg.Add(-(len(sites) - i))
+				return
+			}
+		}
+	}()
+}
+
+// releasePending после отмены дочитывает sitesChan до закрытия: сайты с pending,
+// оставшиеся в буфере, держат pendingWg, и горутина loadSites, которая закрывает
+// канал, без этого не выйдет
+func (c *Crawler) releasePending(sitesChan <-chan *Site) {
+	for site := range sitesChan {
+		if site.pending {
+			c.pendingWg.Done()
+		}
+	}
+}
+
+// followLinks ставит в очередь еще не виденные ссылки на хост сайта,
+// они наследуют его категории и на шаг дальше от исходного сайта
+func (c *Crawler) followLinks(ctx context.Context, parent *Site, links []string) {
+	if parent.Depth >= c.maxDepth || len(links) == 0 {
+		return
+	}
+	parentURL, err := url.Parse(parent.Url)
+	if err != nil {
+		return
+	}
+	host := strings.ToLower(parentURL.Hostname())
+
+	var children []*Site
+	c.mu.Lock()
+	for _, link := range links {
+		u, err := url.Parse(link)
+		if err != nil || strings.ToLower(u.Hostname()) != host {
+			continue
+		}
+		key := urlKey(link)
+		if _, ok := c.visited[key]; ok || c.isSeen(link) {
+			continue
+		}
+		if c.maxPagesPerHost > 0 && c.hostPages[host] >= c.maxPagesPerHost {
+			break
+		}
+		c.visited[key] = struct{}{}
+		if c.hostPages == nil {
+			c.hostPages = make(map[string]int)
+		}
+		c.hostPages[host]++
+		children = append(children, &Site{
+			Url:        link,
+			State:      parent.State,
+			Categories: append([]string(nil), parent.Categories...),
+			Proxy:      parent.Proxy,
+			Depth:      parent.Depth + 1,
+		})
+	}
+	c.mu.Unlock()
+
+	for _, child := range children {
+		atomic.AddUint32(&c.totalCounter, 1)
+		c.enqueue(ctx, child)
+	}
+}
+
+// writeLinks пишет ссылки страницы в Links, по одной на строку после ее url
+func (c *Crawler) writeLinks(pageURL string, links []string) {
+	if c.links == nil || len(links) == 0 {
+		return
+	}
+	var b strings.Builder
+	for _, link := range links {
+		b.WriteString(tsvEscaper.Replace(pageURL) + "\t" + tsvEscaper.Replace(link) + "\n")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.links.Write(b.String()); err != nil {
+		log.Printf("links: %v", err)
+	}
+}
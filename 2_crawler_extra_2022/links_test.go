@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFollowLinks(t *testing.T) {
+	pages := map[string]string{
+		"/":         `<a href="/a">a</a> <a href="b">b</a> <a href="/a#top">a again</a> <a href="http://other.example/x">other</a> <a href="mailto:x@example.com">mail</a>`,
+		"/a":        `<a href="/c">c</a> <a href="/">home</a>`,
+		"/b":        `<meta name="robots" content="nofollow"><a href="/hidden">hidden</a>`,
+		"/c":        `<a href="/d">d</a>`,
+		"/d":        ``,
+		"/hidden":   ``,
+		"/unlinked": ``,
+	}
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>%s</body></html>", r.URL.Path, pages[r.URL.Path])
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, MaxDepth: 2, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), writeSites(t, srv.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]int{"/": 1, "/a": 1, "/b": 1, "/c": 1, "/d": 0, "/hidden": 0, "/unlinked": 0}
+	for path, n := range expected {
+		if hits[path] != n {
+			t.Errorf("expected %s to be fetched %d times, got %d", path, n, hits[path])
+		}
+	}
+	if c.succeededCounter != 4 {
+		t.Errorf("expected 4 sites to succeed, got %d", c.succeededCounter)
+	}
+}
+
+func TestFollowLinksInheritsSite(t *testing.T) {
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, MaxDepth: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.sitesChan = make(chan *Site)
+	c.visited = make(map[string]struct{})
+	proxy := "http://proxy.example:3128"
+	parent := &Site{Url: "http://Example.com/", State: "checked", Categories: []string{"news", "sport"}, Proxy: &proxy}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.followLinks(ctx, parent, []string{"http://example.com/a", "http://example.com/a", "https://example.com/b", "http://example.org/c"})
+	child := <-c.sitesChan
+	second := <-c.sitesChan
+	if child.Url > second.Url {
+		child, second = second, child
+	}
+	if child.Url != "http://example.com/a" || second.Url != "https://example.com/b" {
+		t.Errorf("unexpected children %s and %s", child.Url, second.Url)
+	}
+	if child.Depth != 1 || child.State != "checked" || child.Proxy != &proxy || len(child.Categories) != 2 {
+		t.Errorf("child did not inherit parent: %+v", child)
+	}
+	child.Categories[0] = "changed"
+	if parent.Categories[0] != "news" {
+		t.Error("child shares categories slice with parent")
+	}
+
+	c.followLinks(ctx, child, []string{"http://example.com/deeper"})
+	select {
+	case site := <-c.sitesChan:
+		t.Errorf("link beyond MaxDepth was enqueued: %s", site.Url)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestCancelReleasesPending(t *testing.T) {
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, MaxDepth: 1, SitesBuffer: 3, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sitesChan, err := c.loadSites(ctx, writeSites(t, "http://a.example/", "http://b.example/", "http://c.example/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ждем, пока все сайты лягут в буфер, и отменяем до того, как их разберут воркеры
+	for deadline := time.Now().Add(time.Second); len(sitesChan) < 3 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := c.checkSites(ctx, sitesChan); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	select {
+	case site, ok := <-sitesChan:
+		if ok {
+			t.Errorf("site %s left in the channel after cancel", site.Url)
+		}
+	case <-time.After(time.Second):
+		t.Error("sites channel is not closed after cancel, pending sites were not released")
+	}
+}
+
+func TestCollectLinks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := ""
+		if r.URL.Path == "/" {
+			body = `<a href="/a">a</a> <a href="/a#again">a</a> <a href="http://other.example/x">x</a> <a href="/b">b</a> <a href="/c">c</a>`
+		}
+		fmt.Fprintf(w, "<html><head><title>%s</title></head><body>%s</body></html>", r.URL.Path, body)
+	}))
+	defer srv.Close()
+
+	records := &memWriter{}
+	RegisterWriterFactory("test-links-json", func(string) (DataWriter, error) { return records, nil })
+	links := &memWriter{}
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, WriterType: "test-links-json", Status: DefaultStatusPolicy,
+		CollectLinks: true, Links: links, MaxDepth: 1, MaxPagesPerHost: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), writeSites(t, srv.URL+"/")); err != nil {
+		t.Fatal(err)
+	}
+
+	// повтор /a без фрагмента схлопывается, чужие хосты тоже пишутся
+	expectedLinks := fmt.Sprintf("%[1]s/\t%[1]s/a\n%[1]s/\thttp://other.example/x\n%[1]s/\t%[1]s/b\n%[1]s/\t%[1]s/c\n", srv.URL)
+	if len(links.lines) != 1 || links.lines[0] != expectedLinks || links.flushes == 0 {
+		t.Errorf("unexpected links %q, expected %q", links.lines, expectedLinks)
+	}
+
+	// MaxPagesPerHost 2 - из трех ссылок на хост обходятся /a и /b
+	depths := map[string]int{}
+	for _, line := range records.lines {
+		var rec jsonRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		depths[strings.TrimPrefix(rec.URL, srv.URL)] = rec.Depth
+	}
+	if expected := map[string]int{"/": 0, "/a": 1, "/b": 1}; !reflect.DeepEqual(depths, expected) {
+		t.Errorf("expected pages with depths %v, got %v", expected, depths)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// CrawlStatus - ответ /status
+type CrawlStatus struct {
+	Checked        uint32  `json:"checked"`
+	Succeeded      uint32  `json:"succeeded"`
+	Failed         uint32  `json:"failed"`
+	InFlight       int32   `json:"in_flight"`
+	RPSActual      float64 `json:"rps_actual"`
+	ElapsedSeconds float64 `json:"elapsed_seconds"`
+}
+
+func (c *Crawler) status() CrawlStatus {
+	st := CrawlStatus{
+		Checked:   uint32(c.checkCounter.Load()),
+		Succeeded: atomic.LoadUint32(&c.succeededCounter),
+		Failed:    atomic.LoadUint32(&c.failedCounter),
+		InFlight:  c.inFlightCounter.Load(),
+	}
+	if started := atomic.LoadInt64(&c.startedAt); started > 0 {
+		elapsed := time.Since(time.Unix(0, started))
+		st.ElapsedSeconds = elapsed.Seconds()
+		st.RPSActual = float64(st.Checked) / elapsed.Seconds()
+	}
+	return st
+}
+
+func (c *Crawler) statusHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.status())
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		st := c.status()
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprintf(w, "# HELP crawler_sites_checked_total Sites fetched, whatever the outcome.\n# TYPE crawler_sites_checked_total counter\ncrawler_sites_checked_total %d\n", st.Checked)
+		fmt.Fprintf(w, "# HELP crawler_sites_succeeded_total Sites written to the output.\n# TYPE crawler_sites_succeeded_total counter\ncrawler_sites_succeeded_total %d\n", st.Succeeded)
+		fmt.Fprintf(w, "# HELP crawler_sites_failed_total Sites that ended with an error.\n# TYPE crawler_sites_failed_total counter\ncrawler_sites_failed_total %d\n", st.Failed)
+		fmt.Fprintf(w, "# HELP crawler_sites_in_flight Sites being checked right now.\n# TYPE crawler_sites_in_flight gauge\ncrawler_sites_in_flight %d\n", st.InFlight)
+		fmt.Fprintf(w, "# HELP crawler_elapsed_seconds Time since Start.\n# TYPE crawler_elapsed_seconds gauge\ncrawler_elapsed_seconds %g\n", st.ElapsedSeconds)
+	})
+	return mux
+}
+
+// StatusServer отдает /status в json и /metrics для Prometheus на addr.
+// Слушать начинает сразу, останавливается в конце Start
+func (c *Crawler) StatusServer(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: c.statusHandler(), ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Printf("status server: %v", err)
+		}
+	}()
+
+	c.mu.Lock()
+	c.statusSrv, c.statusAddr = srv, ln.Addr().String()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *Crawler) stopStatusServer() {
+	c.mu.Lock()
+	srv := c.statusSrv
+	c.statusSrv = nil
+	c.mu.Unlock()
+	if srv == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("status server: %v", err)
+	}
+}
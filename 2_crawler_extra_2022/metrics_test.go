@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusServer(t *testing.T) {
+	release := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write([]byte("<html><head><title>slow</title></head></html>"))
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: 5 * time.Second}, RPS: 1000, Workers: 3, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StatusServer("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	base := "http://" + c.statusAddr
+
+	done := make(chan error)
+	go func() {
+		done <- c.Start(context.Background(), writeSites(t, srv.URL+"/ok", srv.URL+"/slow", srv.URL+"/down"))
+	}()
+
+	var st CrawlStatus
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := http.Get(base + "/status")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&st)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Checked == 2 && st.Succeeded == 1 && st.Failed == 1 && st.InFlight == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected status %+v", st)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st.ElapsedSeconds <= 0 || st.RPSActual <= 0 {
+		t.Errorf("unexpected status %+v", st)
+	}
+
+	resp, err := http.Get(base + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	for _, line := range []string{"crawler_sites_checked_total 2", "crawler_sites_succeeded_total 1", "crawler_sites_failed_total 1", "crawler_sites_in_flight 1", "# TYPE crawler_sites_in_flight gauge"} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Errorf("metrics have no %q:\n%s", line, body)
+		}
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(base + "/status"); err == nil {
+		t.Errorf("expected the status server to be stopped after Start")
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// multiWriterPrefix - writerType вида "multi:file,console-json" пишет в каждый
+// из перечисленных типов, формат у каждого свой
+const multiWriterPrefix = "multi:"
+
+// MultiWriter повторяет каждый вызов на всех writers, ошибка одного не мешает остальным
+type MultiWriter struct {
+	writers []DataWriter
+}
+
+func NewMultiWriter(writers ...DataWriter) DataWriter {
+	return &MultiWriter{writers: writers}
+}
+
+func (mw *MultiWriter) Write(data string) error {
+	return mw.each(func(w DataWriter) error {
+		return w.Write(data)
+	})
+}
+
+// WriteRecord отдает Record тем, кто умеет его сериализовать, остальным - строку tsv
+func (mw *MultiWriter) WriteRecord(rec Record) error {
+	return mw.WriteRecordCtx(context.Background(), rec)
+}
+
+func (mw *MultiWriter) WriteRecordCtx(ctx context.Context, rec Record) error {
+	return mw.each(func(w DataWriter) error {
+		if rw, ok := w.(RecordWriter); ok {
+			return writeRecordCtx(ctx, rw, rec)
+		}
+		return writeRecordCtx(ctx, NewTSVWriter(w), rec)
+	})
+}
+
+func (mw *MultiWriter) Flush() error {
+	return mw.each(DataWriter.Flush)
+}
+
+func (mw *MultiWriter) Close() error {
+	return mw.each(DataWriter.Close)
+}
+
+func (mw *MultiWriter) each(call func(w DataWriter) error) error {
+	var errs *multierror.Error
+	for _, w := range mw.writers {
+		if err := call(w); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
+
+var errEmptyMultiWriter = errors.New("multi writer needs at least one writer type")
+
+// createMultiWriter собирает writer'ы категории для каждого типа из списка
+func (c *Crawler) createMultiWriter(types, category string) (RecordWriter, error) {
+	list := splitList(types)
+	if len(list) == 0 {
+		return nil, errEmptyMultiWriter
+	}
+	writers := make([]DataWriter, 0, len(list))
+	for _, writerType := range list {
+		w, err := c.createWriter(writerType, category)
+		if err != nil {
+			for _, created := range writers {
+				created.Close()
+			}
+			return nil, fmt.Errorf("multi writer %q: %w", writerType, err)
+		}
+		writers = append(writers, w)
+	}
+	return &MultiWriter{writers: writers}, nil
+}
+
+func isMultiWriterType(writerType string) bool {
+	return strings.HasPrefix(writerType, multiWriterPrefix)
+}
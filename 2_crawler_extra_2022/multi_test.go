@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// brokenWriter отказывает на каждом вызове
+type brokenWriter struct {
+	memWriter
+}
+
+func (bw *brokenWriter) Write(string) error { return errors.New("write failed") }
+func (bw *brokenWriter) Flush() error       { return errors.New("flush failed") }
+
+func TestMultiWriter(t *testing.T) {
+	first, second, broken := &memWriter{}, &memWriter{}, &brokenWriter{}
+	w := NewMultiWriter(first, broken, second)
+
+	err := w.Write("line\n")
+	if err == nil || !strings.Contains(err.Error(), "write failed") {
+		t.Errorf("expected the write error, got %v", err)
+	}
+	if err := w.Flush(); err == nil || !strings.Contains(err.Error(), "flush failed") {
+		t.Errorf("expected the flush error, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for i, mw := range []*memWriter{first, second} {
+		if len(mw.lines) != 1 || mw.lines[0] != "line\n" || mw.flushes != 1 || !mw.closed {
+			t.Errorf("writer %d: unexpected state %+v", i, mw)
+		}
+	}
+	if !broken.closed {
+		t.Errorf("a failing writer must still be closed")
+	}
+}
+
+func TestMultiWriterType(t *testing.T) {
+	tsv, jsonl := &memWriter{}, &memWriter{}
+	RegisterWriterFactory("test-multi-tsv", func(string) (DataWriter, error) { return tsv, nil })
+	RegisterWriterFactory("test-multi-json", func(string) (DataWriter, error) { return jsonl, nil })
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, WriterType: "multi:test-multi-tsv, test-multi-json", Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.createWriterForCategory("good_site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord(Record{URL: "http://example.com", Title: "ok", Category: "good_site", Fields: []Field{{"title", "ok"}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tsv.lines) != 1 || !strings.HasPrefix(tsv.lines[0], "http://example.com\tok\t") || !tsv.closed {
+		t.Errorf("unexpected tsv output %q", tsv.lines)
+	}
+	var rec jsonRecord
+	if len(jsonl.lines) != 1 || json.Unmarshal([]byte(jsonl.lines[0]), &rec) != nil || rec.Title != "ok" || !jsonl.closed {
+		t.Errorf("unexpected jsonl output %q", jsonl.lines)
+	}
+
+	c.writerType = "multi:"
+	if _, err := c.createWriterForCategory("good_site"); !errors.Is(err, errEmptyMultiWriter) {
+		t.Errorf("expected errEmptyMultiWriter, got %v", err)
+	}
+}
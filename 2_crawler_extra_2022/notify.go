@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const notifyTimeout = 30 * time.Second
+
+// Notifier получает отчет по завершении Start
+type Notifier interface {
+	Notify(ctx context.Context, report RunReport) error
+}
+
+type WebhookNotifier struct {
+	URL         string
+	AuthHeader  string
+	MaxAttempts int
+	RetryDelay  time.Duration
+	Client      *http.Client
+}
+
+func NewWebhookNotifier(url, authHeader string) *WebhookNotifier {
+	return &WebhookNotifier{
+		URL:         url,
+		AuthHeader:  authHeader,
+		MaxAttempts: 3,
+		RetryDelay:  time.Second,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (wn *WebhookNotifier) Notify(ctx context.Context, report RunReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	attempts := wn.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		err = wn.post(ctx, body)
+		if err == nil || attempt >= attempts {
+			break
+		}
+		select {
+		case <-time.After(wn.RetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("webhook %s: %d attempts: %w", wn.URL, attempts, err)
+	}
+
+	return nil
+}
+
+func (wn *WebhookNotifier) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wn.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if wn.AuthHeader != "" {
+		req.Header.Set("Authorization", wn.AuthHeader)
+	}
+
+	resp, err := wn.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+type SMTPNotifier struct {
+	Addr       string
+	Username   string
+	Password   string
+	From       string
+	Recipients []string
+}
+
+func (sn *SMTPNotifier) Notify(ctx context.Context, report RunReport) error {
+	var auth smtp.Auth
+	if sn.Username != "" {
+		host, _, err := net.SplitHostPort(sn.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", sn.Username, sn.Password, host)
+	}
+
+	status := "finished"
+	if report.Error != "" || report.Failed > 0 {
+		status = "finished with errors"
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", sn.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(sn.Recipients, ", "))
+	fmt.Fprintf(&msg, "Subject: Crawl %s: %d succeeded, %d failed\r\n\r\n", status, report.Succeeded, report.Failed)
+	fmt.Fprintf(&msg, "Succeeded: %d\r\nFailed: %d\r\nDuration: %.1fs\r\n", report.Succeeded, report.Failed, report.DurationSeconds)
+	for _, e := range report.TopErrors {
+		fmt.Fprintf(&msg, "Errors %s: %d\r\n", e.Class, e.Count)
+	}
+	if report.ReportPath != "" {
+		fmt.Fprintf(&msg, "Report: %s\r\n", report.ReportPath)
+	}
+	if report.Error != "" {
+		fmt.Fprintf(&msg, "Error: %s\r\n", report.Error)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(sn.Addr, auth, sn.From, sn.Recipients, []byte(msg.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Crawler) notify(report RunReport) {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	for _, n := range c.notifiers {
+		if err := n.Notify(ctx, report); err != nil {
+			log.Printf("notify: %v", err)
+		}
+	}
+}
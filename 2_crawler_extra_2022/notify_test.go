@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookReceiver struct {
+	mu      sync.Mutex
+	reports []RunReport
+	auth    []string
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var report RunReport
+	if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.reports = append(wr.reports, report)
+	wr.auth = append(wr.auth, r.Header.Get("Authorization"))
+}
+
+// fakeSMTP - минимальный smtp сервер, которого хватает для smtp.SendMail
+type fakeSMTP struct {
+	addr     string
+	mu       sync.Mutex
+	messages []string
+	rcpts    []string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	fs := &fakeSMTP{addr: ln.Addr().String()}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go fs.serve(conn)
+		}
+	}()
+	return fs
+}
+
+func (fs *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			reply("250-fake")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(cmd, "AUTH"):
+			reply("235 ok")
+		case strings.HasPrefix(cmd, "RCPT"):
+			fs.mu.Lock()
+			fs.rcpts = append(fs.rcpts, strings.TrimSpace(line))
+			fs.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var msg strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				msg.WriteString(l)
+			}
+			fs.mu.Lock()
+			fs.messages = append(fs.messages, msg.String())
+			fs.mu.Unlock()
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	okSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer okSrv.Close()
+	deadSrv := httptest.NewServer(http.NotFoundHandler())
+	deadURL := deadSrv.URL
+	deadSrv.Close()
+
+	cases := []struct {
+		name      string
+		urls      []string
+		succeeded uint32
+		failed    uint32
+		subject   string
+	}{
+		{"success", []string{okSrv.URL, okSrv.URL + "/a"}, 2, 0, "Subject: Crawl finished: 2 succeeded, 0 failed"},
+		{"failure", []string{okSrv.URL, deadURL}, 1, 1, "Subject: Crawl finished with errors: 1 succeeded, 1 failed"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			receiver := &webhookReceiver{}
+			hook := httptest.NewServer(receiver)
+			defer hook.Close()
+			mail := newFakeSMTP(t)
+
+			webhook := NewWebhookNotifier(hook.URL, "Bearer secret")
+			webhook.RetryDelay = 10 * time.Millisecond
+			notifiers := []Notifier{
+				webhook,
+				&SMTPNotifier{
+					Addr:       mail.addr,
+					Username:   "crawler",
+					Password:   "secret",
+					From:       "crawler@example.com",
+					Recipients: []string{"team@example.com"},
+				},
+			}
+			c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 100, Workers: 4, Status: DefaultStatusPolicy, Notifiers: notifiers})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Start(context.Background(), writeSites(t, tc.urls...)); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(receiver.reports) != 1 {
+				t.Fatalf("expected 1 webhook call, got %d", len(receiver.reports))
+			}
+			report := receiver.reports[0]
+			if report.Succeeded != tc.succeeded || report.Failed != tc.failed {
+				t.Errorf("unexpected counts in webhook payload: %+v", report)
+			}
+			if tc.failed > 0 && (len(report.TopErrors) == 0 || report.TopErrors[0].Class != "other") {
+				t.Errorf("expected error classes in webhook payload, got %+v", report.TopErrors)
+			}
+			if receiver.auth[0] != "Bearer secret" {
+				t.Errorf("unexpected auth header %q", receiver.auth[0])
+			}
+
+			mail.mu.Lock()
+			defer mail.mu.Unlock()
+			if len(mail.messages) != 1 {
+				t.Fatalf("expected 1 email, got %d", len(mail.messages))
+			}
+			if !strings.Contains(mail.messages[0], tc.subject) {
+				t.Errorf("unexpected email:\n%s", mail.messages[0])
+			}
+			if len(mail.rcpts) != 1 || !strings.Contains(mail.rcpts[0], "team@example.com") {
+				t.Errorf("unexpected recipients %v", mail.rcpts)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifierRetry(t *testing.T) {
+	var calls int
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer hook.Close()
+
+	webhook := NewWebhookNotifier(hook.URL, "")
+	webhook.RetryDelay = time.Millisecond
+	if err := webhook.Notify(context.Background(), RunReport{}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+
+	webhook.MaxAttempts = 1
+	calls = 0
+	if err := webhook.Notify(context.Background(), RunReport{}); err == nil {
+		t.Error("expected error after exhausting attempts")
+	}
+}
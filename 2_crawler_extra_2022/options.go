@@ -0,0 +1,130 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// defaultTimeout - общий таймаут запроса при нулевом Options.Transport
+const defaultTimeout = 10 * time.Second
+
+// Options - все настройки NewCrawler, после него они не меняются.
+// Нулевой Transport - это только общий таймаут defaultTimeout, нулевой
+// Status раскрывает редиректы, как http.Client, а ретраи нужно задавать явно,
+// например DefaultRetryPolicy
+type Options struct {
+	Transport TransportPolicy
+	// RPS - общий лимит запросов в секунду, PerHostRPS - на каждый хост, 0 без лимита
+	RPS        uint64
+	PerHostRPS uint64
+	Workers    int
+	// Insecure не проверяет TLS сертификаты
+	Insecure bool
+	// ForceHTTP2 возвращает h2: транспорт со своим TLSClientConfig сам на него не переходит
+	ForceHTTP2    bool
+	RespectRobots bool
+	WriterType    string
+	// OutputDir - куда класть файлы категорий, создается при первой записи.
+	// Имена файлов и categories.tsv с их категориями см. в categoryFiles
+	OutputDir string
+	// ProxyURL - прокси для всех запросов, схемы http, https и socks5,
+	// сайт может задать свой в поле proxy
+	ProxyURL string
+	// BytesPerSec - лимит на тела ответов, 0 без лимита. Менять его на лету
+	// можно через Crawler.Bandwidth
+	BytesPerSec int64
+	// UserAgents выбираются случайно на каждый запрос, без них defaultUserAgent
+	UserAgents []string
+	CachePath  string
+	Retry      RetryPolicy
+	// Status - что делать с ответами не 200. Чтобы не раскрывать редиректы
+	// без других правил, задайте FollowRedirects с MaxRedirects 0
+	Status StatusPolicy
+	// Headers ставятся на каждый запрос после User-Agent, так что могут его заменить
+	Headers map[string]string
+	// HeaderHook вызывается последним для запросов к сайтам, например чтобы
+	// категории ходили с разными заголовками. Для robots.txt, sitemap и
+	// списка сайтов site == nil
+	HeaderHook func(site *Site, req *http.Request)
+	// DNS - кэш разрешения имен, в том числе неудачного, нулевое значение его выключает
+	DNS DNSPolicy
+	// Rules - что извлекать со страницы, по умолчанию DefaultExtractionRules
+	Rules []ExtractionRule
+
+	// Notifiers получают отчет по окончании обхода
+	Notifiers  []Notifier
+	ReportPath string
+	// CheckpointPath - jsonl с итогом по каждому обработанному сайту.
+	// ResumeFrom - файл прогресса прошлого запуска: сайты из него, кроме
+	// упавших, при старте пропускаются. Если это тот же файл, что CheckpointPath,
+	// прогресс дописывается в него, иначе CheckpointPath начинается заново
+	CheckpointPath string
+	ResumeFrom     string
+	// SkipNoindex не пишет в категории страницы с noindex в X-Robots-Tag или meta robots
+	SkipNoindex bool
+	// SkipNonHTML не пишет строки для ответов, которые не text/html и не xhtml
+	SkipNonHTML bool
+	// IPLabel, если задан, подписывает IP, с которого пришла страница, например ASN или страной,
+	// вызывается из воркеров параллельно
+	IPLabel func(ip string) string
+	// MaxDepth > 0 включает переход по ссылкам на тот же хост на столько шагов от исходных сайтов
+	MaxDepth int
+	// MaxPagesPerHost > 0 ограничивает, сколько страниц одного хоста добавят переходы по ссылкам
+	MaxPagesPerHost int
+	// CollectLinks пишет все ссылки со страниц в Links строками url, ссылка через таб,
+	// без Links - в links.tsv
+	CollectLinks bool
+	Links        DataWriter
+	// RecordMeta добавляет в выдачу статус ответа и время запроса в мс
+	RecordMeta bool
+	// TSVHeader начинает новый файл категории строкой с именами колонок,
+	// TSVStrip заменяет табы и переводы строк в полях пробелами вместо экранирования
+	TSVHeader bool
+	TSVStrip  bool
+	// AsyncBuffer > 0 пишет в файлы из фоновой горутины через очередь такого размера
+	AsyncBuffer int
+	// DryRun только проверяет входной файл и печатает проблемы, ничего не скачивая,
+	// Start тогда возвращает *ValidationError со списком
+	DryRun bool
+	// KnownStates - допустимые Site.State, сайты с другими считаются невалидными.
+	// Пустой - состояние не проверяется
+	KnownStates []string
+	// SitesBuffer - сколько сайтов может ждать свободного воркера в канале
+	SitesBuffer int
+	// OnMalformedSite получает строки списка сайтов, которые не разобрались,
+	// по умолчанию они пишутся в лог
+	OnMalformedSite func(source string, line int, err error)
+	// WriteAttempts > 1 повторяет неудачную запись в файлы с паузой WriteRetryDelay
+	WriteAttempts   int
+	WriteRetryDelay time.Duration
+	// Selectors - свои поля для категорий, см. FieldSelector. Проверяются в Start
+	Selectors map[string][]FieldSelector
+	// CategoryRules добавляют категории по содержимому страницы, см. CategoryRule
+	CategoryRules []CategoryRule
+	// FeedMode - разбирать ли ответ как RSS/Atom, по умолчанию FeedAuto
+	FeedMode FeedMode
+	// MaxBodyBytes - сколько байт тела после распаковки разбирать, по умолчанию 5 MiB
+	MaxBodyBytes int64
+	// FileTemplate и MaxFileBytes включают ротацию для WriterType file:
+	// шаблон вида "{category}-{date}-{seq}.tsv", новый seq после MaxFileBytes
+	FileTemplate string
+	MaxFileBytes int64
+	// MaxCrawlDelay - самый долгий Crawl-delay, который соблюдаем, хосты
+	// с большим пропускаются, по умолчанию минута
+	MaxCrawlDelay time.Duration
+	// Filter - какие сайты из входа вообще обходить
+	Filter SiteFilter
+	// CSVHeader - колонки для WriterType csv, по умолчанию url, title, description
+	CSVHeader []string
+	// CookieJar общий для всех запросов, по умолчанию пустой cookiejar,
+	// NoCookies отключает куки совсем
+	CookieJar http.CookieJar
+	NoCookies bool
+	// FlushInterval и FlushLines - как часто сбрасывать буферы выдачи: по времени
+	// и по числу строк в категории. Нулевые значения - 5 с и 1000 строк,
+	// отрицательные отключают свой вид сброса
+	FlushInterval time.Duration
+	FlushLines    int
+	// Errors - куда писать неудавшиеся сайты строками url, статус, вердикт, ошибка через таб
+	Errors DataWriter
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Record - одна строка выдачи по сайту и категории
+type Record struct {
+	URL         string `json:"url"`
+	FinalURL    string `json:"final_url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	OGTitle     string `json:"og_title"`
+	Canonical   string `json:"canonical"`
+	Favicon     string `json:"favicon"`
+	Language    string `json:"language"`
+	Robots      string `json:"robots"`
+	Category    string `json:"category"`
+	FetchedAt   int64  `json:"fetched_at"`
+	StatusCode  int    `json:"status_code"`
+	LatencyMs   int64  `json:"latency_ms,omitempty"`
+	RemoteAddr  string `json:"remote_addr"`
+	IPLabel     string `json:"ip_label,omitempty"`
+	Verdict     string `json:"verdict"`
+	// Rules - сработавшие CategoryRule
+	Rules []string `json:"rules,omitempty"`
+	// Depth - 0 у исходных сайтов, больше у найденных по ссылкам
+	Depth int `json:"depth"`
+	// ContentType - media type ответа, у не-html страниц title и description пустые
+	ContentType string `json:"content_type"`
+	// Fields - значения ExtractionRule, в tsv это колонки после url
+	Fields []Field `json:"-"`
+}
+
+// RecordWriter сериализует Record и пишет результат в обернутый DataWriter
+type RecordWriter interface {
+	DataWriter
+	WriteRecord(rec Record) error
+}
+
+// TSVWriter с RecordMeta дописывает в конец строки статус и время ответа в мс
+type TSVWriter struct {
+	DataWriter
+	RecordMeta bool
+	// StripControl заменяет табы и переводы строк внутри полей пробелом,
+	// по умолчанию они экранируются как \t, \n и \r
+	StripControl bool
+	// Header пишет строку с именами колонок перед первой записью, но только в пустой файл
+	Header bool
+
+	wroteHeader bool
+}
+
+// emptyWriter - DataWriter, который знает, пуст ли его файл. Остальные,
+// например консоль, считаются новыми
+type emptyWriter interface {
+	Empty() bool
+}
+
+type JSONWriter struct {
+	DataWriter
+}
+
+func NewTSVWriter(w DataWriter) RecordWriter {
+	return &TSVWriter{DataWriter: w}
+}
+
+func NewJSONWriter(w DataWriter) RecordWriter {
+	return &JSONWriter{DataWriter: w}
+}
+
+var (
+	tsvEscaper  = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	tsvStripper = strings.NewReplacer("\r\n", " ", "\t", " ", "\n", " ", "\r", " ")
+)
+
+// collapseSpaces убирает пробелы по краям и схлопывает их внутри, как браузер в <title>
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (tw *TSVWriter) WriteRecord(rec Record) error {
+	return tw.WriteRecordCtx(context.Background(), rec)
+}
+
+func (tw *TSVWriter) WriteRecordCtx(ctx context.Context, rec Record) error {
+	columns := []string{rec.URL}
+	for _, f := range rec.Fields {
+		if f.Name == "title" {
+			f.Value = collapseSpaces(f.Value)
+		}
+		columns = append(columns, f.Value)
+	}
+	columns = append(columns, collapseSpaces(rec.OGTitle), rec.Canonical, rec.Favicon, rec.Language, rec.Robots, rec.RemoteAddr, rec.IPLabel, rec.FinalURL, rec.Verdict, strings.Join(rec.Rules, ","), strconv.Itoa(rec.Depth), rec.ContentType)
+	if tw.RecordMeta {
+		columns = append(columns, strconv.Itoa(rec.StatusCode), strconv.FormatInt(rec.LatencyMs, 10))
+	}
+	if err := tw.writeHeader(ctx, rec); err != nil {
+		return err
+	}
+	return WriteCtx(ctx, tw.DataWriter, tw.row(columns))
+}
+
+// writeHeader - те же колонки, что в WriteRecord, по именам полей json
+func (tw *TSVWriter) writeHeader(ctx context.Context, rec Record) error {
+	if !tw.Header || tw.wroteHeader {
+		return nil
+	}
+	tw.wroteHeader = true
+	if ew, ok := tw.DataWriter.(emptyWriter); ok && !ew.Empty() {
+		return nil
+	}
+	names := []string{"url"}
+	for _, f := range rec.Fields {
+		names = append(names, f.Name)
+	}
+	names = append(names, "og_title", "canonical", "favicon", "language", "robots", "remote_addr", "ip_label", "final_url", "verdict", "rules", "depth", "content_type")
+	if tw.RecordMeta {
+		names = append(names, "status_code", "latency_ms")
+	}
+	return WriteCtx(ctx, tw.DataWriter, tw.row(names))
+}
+
+func (tw *TSVWriter) row(columns []string) string {
+	replacer := tsvEscaper
+	if tw.StripControl {
+		replacer = tsvStripper
+	}
+	for i, col := range columns {
+		columns[i] = replacer.Replace(col)
+	}
+	return strings.Join(columns, "\t") + "\n"
+}
+
+type jsonRecord struct {
+	Record
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func (jw *JSONWriter) WriteRecord(rec Record) error {
+	return jw.WriteRecordCtx(context.Background(), rec)
+}
+
+func (jw *JSONWriter) WriteRecordCtx(ctx context.Context, rec Record) error {
+	jr := jsonRecord{Record: rec}
+	if len(rec.Fields) > 0 {
+		jr.Fields = make(map[string]string, len(rec.Fields))
+		for _, f := range rec.Fields {
+			jr.Fields[f.Name] = f.Value
+		}
+	}
+	data, err := json.Marshal(jr)
+	if err != nil {
+		return err
+	}
+	return WriteCtx(ctx, jw.DataWriter, string(data)+"\n")
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// memWriter - DataWriter в память для проверки выдачи
+type memWriter struct {
+	lines   []string
+	flushes int
+	closed  bool
+}
+
+func (mw *memWriter) Write(data string) error {
+	mw.lines = append(mw.lines, data)
+	return nil
+}
+
+func (mw *memWriter) Flush() error {
+	mw.flushes++
+	return nil
+}
+
+func (mw *memWriter) Close() error {
+	mw.closed = true
+	return nil
+}
+
+func TestRecordWriters(t *testing.T) {
+	rec := Record{
+		URL:         "http://example.com",
+		FinalURL:    "https://www.example.com/",
+		Title:       "multi\tline\ntitle",
+		Description: "with \\ backslash\r\n",
+		Category:    "good_site",
+		FetchedAt:   1567713280,
+		StatusCode:  200,
+		RemoteAddr:  "93.184.216.34:80",
+		IPLabel:     "AS15133",
+		Verdict:     VerdictOK,
+		Rules:       []string{"casino", "article"},
+		Depth:       1,
+		ContentType: "text/html",
+	}
+	rec.Fields = []Field{{"title", rec.Title}, {"description", rec.Description}}
+
+	mw := &memWriter{}
+	if err := NewTSVWriter(mw).WriteRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	expectedTSV := "http://example.com\tmulti line title\twith \\\\ backslash\\r\\n\t\t\t\t\t\t93.184.216.34:80\tAS15133\thttps://www.example.com/\tok\tcasino,article\t1\ttext/html\n"
+	if mw.lines[0] != expectedTSV {
+		t.Errorf("unexpected tsv line %q", mw.lines[0])
+	}
+	if n := len(strings.Split(strings.TrimSuffix(mw.lines[0], "\n"), "\t")); n != 15 {
+		t.Errorf("expected 15 tsv columns, got %d", n)
+	}
+
+	mw = &memWriter{}
+	if err := NewJSONWriter(mw).WriteRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(mw.lines[0], "\n") != 1 {
+		t.Errorf("json record must take exactly one line: %q", mw.lines[0])
+	}
+	var decoded jsonRecord
+	if err := json.Unmarshal([]byte(mw.lines[0]), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	expectedFields := map[string]string{"title": rec.Title, "description": rec.Description}
+	rec.Fields = nil
+	if !reflect.DeepEqual(decoded.Record, rec) || !reflect.DeepEqual(decoded.Fields, expectedFields) {
+		t.Errorf("json round trip mismatch\nGot: %+v\nExpected: %+v", decoded, rec)
+	}
+}
+
+func TestRecordMeta(t *testing.T) {
+	rec := Record{URL: "http://example.com", StatusCode: 200, LatencyMs: 42}
+
+	mw := &memWriter{}
+	if err := (&TSVWriter{DataWriter: mw, RecordMeta: true}).WriteRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	columns := strings.Split(strings.TrimSuffix(mw.lines[0], "\n"), "\t")
+	if n := len(columns); n != 15 || columns[n-2] != "200" || columns[n-1] != "42" {
+		t.Errorf("expected status and latency as the last two columns, got %q", columns)
+	}
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, RecordMeta: true, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.createWriterForCategory("good_site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tw, ok := w.(*TSVWriter); !ok || !tw.RecordMeta {
+		t.Errorf("expected tsv writer with RecordMeta, got %#v", w)
+	}
+
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	jw := &memWriter{}
+	site := &Site{Url: srv.URL, Categories: []string{"good_site"}}
+	if err := c.checkSite(context.Background(), site, newJSONWriters(jw)); err != nil {
+		t.Fatal(err)
+	}
+	var decoded jsonRecord
+	if err := json.Unmarshal([]byte(jw.lines[0]), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if site.StatusCode != 200 || decoded.StatusCode != 200 || decoded.LatencyMs != site.LatencyMs {
+		t.Errorf("unexpected meta: site %+v, record %+v", site, decoded.Record)
+	}
+}
+
+func TestTSVEncoding(t *testing.T) {
+	nasty := []Record{
+		{URL: "http://a.example", Fields: []Field{{"title", "\n\t  Multi\r\n   line\ttitle  \n"}, {"description", "first\tcolumn\r\nsecond\\line"}}},
+		{URL: "http://b.example", Fields: []Field{{"title", "\r"}, {"description", "\t\t\n"}}},
+		{URL: "http://c.example", Fields: []Field{{"title", "plain"}, {"description", ""}}},
+	}
+	columnsOf := func(line string) []string {
+		return strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+	}
+
+	for _, strip := range []bool{false, true} {
+		mw := &memWriter{}
+		tw := &TSVWriter{DataWriter: mw, StripControl: strip, Header: true}
+		for _, rec := range nasty {
+			if err := tw.WriteRecord(rec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(mw.lines) != len(nasty)+1 {
+			t.Fatalf("strip=%v: expected a header and %d rows, got %q", strip, len(nasty), mw.lines)
+		}
+		header := columnsOf(mw.lines[0])
+		if header[0] != "url" || header[1] != "title" || header[2] != "description" {
+			t.Errorf("strip=%v: unexpected header %q", strip, header)
+		}
+		for _, line := range mw.lines {
+			if strings.Count(line, "\n") != 1 || strings.Contains(line, "\r") {
+				t.Errorf("strip=%v: row spans several lines: %q", strip, line)
+			}
+			if n := len(columnsOf(line)); n != len(header) {
+				t.Errorf("strip=%v: expected %d columns, got %d in %q", strip, len(header), n, line)
+			}
+		}
+		if title := columnsOf(mw.lines[1])[1]; title != "Multi line title" {
+			t.Errorf("strip=%v: expected a collapsed title, got %q", strip, title)
+		}
+		description := columnsOf(mw.lines[1])[2]
+		if expected := `first\tcolumn\r\nsecond\\line`; !strip && description != expected {
+			t.Errorf("expected escaped description %q, got %q", expected, description)
+		}
+		if expected := `first column second\line`; strip && description != expected {
+			t.Errorf("expected stripped description %q, got %q", expected, description)
+		}
+	}
+
+	// заголовок пишется только в новый файл
+	path := filepath.Join(t.TempDir(), "good_site.tsv")
+	for run := 0; run < 2; run++ {
+		fw, err := NewFileWriter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tw := &TSVWriter{DataWriter: fw, Header: true}
+		if err := tw.WriteRecord(nasty[2]); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "url\ttitle\tdescription\t") || !strings.HasPrefix(lines[2], "http://c.example\tplain\t") {
+		t.Errorf("expected one header and two rows, got %q", lines)
+	}
+}
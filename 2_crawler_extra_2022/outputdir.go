@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	categoriesFile = "categories.tsv"
+	// maxCategoryFileLen - предел имени файла категории в байтах без расширения,
+	// с запасом под суффикс -N, расширение и {date}-{seq} шаблона ротации
+	maxCategoryFileLen = 100
+)
+
+// categoryFiles раздает категориям имена файлов выдачи. Категория приходит
+// из входного списка как есть, так что в ней бывают "/", ".." и пробелы:
+// имя чистится через safeCategoryName, а две категории с одинаковым чистым
+// именем получают суффиксы -2, -3 и дальше. Соответствие пишется в
+// categories.tsv в dir (категория, имя файла через таб) и читается оттуда при
+// следующем запуске, чтобы категория попадала в тот же файл
+type categoryFiles struct {
+	dir string
+
+	mu     sync.Mutex
+	loaded bool
+	names  map[string]string
+	// taken - занятые имена в нижнем регистре, на случай нечувствительной к регистру фс
+	taken   map[string]string
+	mapping DataWriter
+}
+
+func newCategoryFiles(dir string) *categoryFiles {
+	// категория "categories" не должна писать поверх categories.tsv
+	taken := map[string]string{strings.TrimSuffix(categoriesFile, ".tsv"): ""}
+	return &categoryFiles{dir: dir, names: map[string]string{}, taken: taken}
+}
+
+// path отдает путь к файлу категории без расширения
+func (cf *categoryFiles) path(category string) (string, error) {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if err := cf.load(); err != nil {
+		return "", err
+	}
+	if name, ok := cf.names[category]; ok {
+		return filepath.Join(cf.dir, name), nil
+	}
+
+	base := safeCategoryName(category)
+	name := base
+	for n := 2; ; n++ {
+		if _, ok := cf.taken[strings.ToLower(name)]; !ok {
+			break
+		}
+		name = fmt.Sprintf("%s-%d", base, n)
+	}
+	if err := cf.write(category, name); err != nil {
+		return "", err
+	}
+	cf.names[category] = name
+	cf.taken[strings.ToLower(name)] = category
+	return filepath.Join(cf.dir, name), nil
+}
+
+// load создает dir и читает соответствие прошлых запусков
+func (cf *categoryFiles) load() error {
+	if cf.loaded {
+		return nil
+	}
+	if cf.dir != "" {
+		if err := os.MkdirAll(cf.dir, 0755); err != nil {
+			return err
+		}
+	}
+	file, err := os.Open(cf.mappingPath())
+	if errors.Is(err, fs.ErrNotExist) {
+		cf.loaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 2 {
+			return fmt.Errorf("%s:%d: expected category and file name", cf.mappingPath(), line)
+		}
+		category := tsvUnescaper.Replace(fields[0])
+		cf.names[category] = fields[1]
+		cf.taken[strings.ToLower(fields[1])] = category
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	cf.loaded = true
+	return nil
+}
+
+func (cf *categoryFiles) write(category, name string) error {
+	if cf.mapping == nil {
+		mapping, err := NewFileWriter(cf.mappingPath())
+		if err != nil {
+			return err
+		}
+		cf.mapping = mapping
+	}
+	if err := cf.mapping.Write(tsvEscaper.Replace(category) + "\t" + name + "\n"); err != nil {
+		return err
+	}
+	// файлы категорий могут пережить падение, соответствие должно тоже
+	return cf.mapping.Flush()
+}
+
+func (cf *categoryFiles) mappingPath() string {
+	return filepath.Join(cf.dir, categoriesFile)
+}
+
+func (cf *categoryFiles) Close() error {
+	cf.mu.Lock()
+	defer cf.mu.Unlock()
+	if cf.mapping == nil {
+		return nil
+	}
+	err := cf.mapping.Close()
+	cf.mapping = nil
+	return err
+}
+
+// safeCategoryName превращает категорию в имя файла: разделители путей и
+// управляющие символы становятся "_", пробелы подряд - одним "_", точки в
+// начале убираются, чтобы не было ".." и скрытых файлов, длина режется до
+// maxCategoryFileLen по границе символа
+func safeCategoryName(category string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.TrimSpace(category) {
+		switch {
+		case unicode.IsSpace(r):
+			if !space {
+				b.WriteByte('_')
+			}
+			space = true
+			continue
+		case r == '/' || r == '\\' || r == utf8.RuneError || unicode.IsControl(r):
+			b.WriteByte('_')
+		default:
+			b.WriteRune(r)
+		}
+		space = false
+	}
+	name := strings.TrimLeft(b.String(), ".")
+	for len(name) > maxCategoryFileLen {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		name = "_"
+	}
+	return name
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSafeCategoryName(t *testing.T) {
+	cases := map[string]string{
+		"good_site":          "good_site",
+		"../../etc/passwd":   "_.._etc_passwd",
+		"..":                 "_",
+		".hidden":            "hidden",
+		"news/sport":         "news_sport",
+		`a\b`:                "a_b",
+		"  two   words\t ":   "two_words",
+		"bell\x07and\x00nul": "bell_and_nul",
+		"":                   "_",
+		"категория":          "категория",
+	}
+	for category, expected := range cases {
+		if got := safeCategoryName(category); got != expected {
+			t.Errorf("%q: expected %q, got %q", category, expected, got)
+		}
+	}
+
+	long := safeCategoryName(strings.Repeat("я", maxCategoryFileLen))
+	if len(long) > maxCategoryFileLen || !strings.HasPrefix(strings.Repeat("я", maxCategoryFileLen), long) {
+		t.Errorf("expected a prefix of at most %d bytes cut on a rune boundary, got %d bytes", maxCategoryFileLen, len(long))
+	}
+}
+
+func TestCategoryFiles(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "out", "nested")
+	cf := newCategoryFiles(dir)
+	paths := map[string]string{}
+	for _, category := range []string{"news/sport", "news sport", "News_Sport", "news/sport", "categories"} {
+		path, err := cf.path(category)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prev, ok := paths[category]; ok && prev != path {
+			t.Errorf("%q moved from %s to %s", category, prev, path)
+		}
+		paths[category] = path
+	}
+	expected := map[string]string{
+		"news/sport": "news_sport",
+		"news sport": "news_sport-2",
+		"News_Sport": "News_Sport-3",
+		"categories": "categories-2",
+	}
+	for category, name := range expected {
+		if paths[category] != filepath.Join(dir, name) {
+			t.Errorf("%q: expected %s, got %s", category, name, paths[category])
+		}
+	}
+	if err := cf.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// следующий запуск продолжает со старым соответствием
+	cf = newCategoryFiles(dir)
+	defer cf.Close()
+	for _, category := range []string{"news sport", "news_sport"} {
+		if _, err := cf.path(category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, categoriesFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "news/sport\tnews_sport\nnews sport\tnews_sport-2\nNews_Sport\tNews_Sport-3\ncategories\tcategories-2\nnews_sport\tnews_sport-4\n"; string(data) != want {
+		t.Errorf("unexpected mapping:\n%s", data)
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	sites := `{"url": "` + srv.URL + `/a", "state": "checked", "categories": ["../escape", "a b"]}` + "\n" +
+		`{"url": "` + srv.URL + `/b", "state": "checked", "categories": ["a/b"]}` + "\n"
+	if err := os.WriteFile(path, []byte(sites), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	wd, _ := os.Getwd()
+	work := t.TempDir()
+	os.Chdir(work)
+	defer os.Chdir(wd)
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, WriterType: "file", OutputDir: "out", Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	files := listFiles(t, filepath.Join(work, "out"))
+	for _, name := range []string{"_escape.tsv", "a_b.tsv", "a_b-2.tsv", categoriesFile} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the output dir, got %v", name, files)
+		}
+	}
+	for _, name := range []string{"a_b.tsv", "a_b-2.tsv"} {
+		data, _ := os.ReadFile(filepath.Join(work, "out", name))
+		if strings.Count(string(data), "\n") != 1 {
+			t.Errorf("expected one line in %s, got %q", name, data)
+		}
+	}
+	if entries, _ := os.ReadDir(work); len(entries) != 1 {
+		t.Errorf("expected nothing outside the output dir, got %v", entries)
+	}
+}
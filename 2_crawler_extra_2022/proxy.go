@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"golang.org/x/net/http2"
+)
+
+// parseProxyURL принимает прокси http, https и socks5, socks5 транспорт
+// поддерживает сам через тот же Proxy
+func parseProxyURL(raw string) (*url.URL, error) {
+	proxy, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", raw, err)
+	}
+	switch proxy.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %q: unsupported scheme %q", raw, proxy.Scheme)
+	}
+	if proxy.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %q: no host", raw)
+	}
+	return proxy, nil
+}
+
+// newClient собирает клиента с таймаутами из TransportPolicy и общими настройками TLS,
+// proxy == nil значит ходить напрямую
+func (p *parser) newClient(proxy *url.URL) *http.Client {
+	transport := p.transport.newTransport(p.dns)
+	transport.TLSClientConfig = p.tlsConfig
+	if p.forceHTTP2 {
+		p.enableHTTP2(transport)
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	return &http.Client{
+		Timeout:       p.transport.Timeout,
+		Jar:           p.jar,
+		Transport:     transport,
+		CheckRedirect: p.status.checkRedirect,
+	}
+}
+
+// enableHTTP2 - ConfigureTransport дописывает h2 в NextProtos, поэтому
+// транспорт получает свою копию общего TLS конфига
+func (p *parser) enableHTTP2(transport *http.Transport) {
+	transport.TLSClientConfig = p.tlsConfig.Clone()
+	if err := http2.ConfigureTransport(transport); err != nil {
+		log.Printf("http2 is not enabled: %v", err)
+	}
+}
+
+// clientFor - если у сайта свой прокси, под него берется клиент из proxyClients,
+// чтобы сайты за одним прокси делили его соединения, иначе используется общий
+func (p *parser) clientFor(site *Site) (*http.Client, error) {
+	if site.Proxy == nil || *site.Proxy == "" {
+		return p.client, nil
+	}
+	proxy, err := parseProxyURL(*site.Proxy)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", site.Url, err)
+	}
+	key := proxy.String()
+	p.proxyMu.Lock()
+	defer p.proxyMu.Unlock()
+	client, ok := p.proxyClients[key]
+	if !ok {
+		if p.proxyClients == nil {
+			p.proxyClients = make(map[string]*http.Client)
+		}
+		client = p.newClient(proxy)
+		p.proxyClients[key] = client
+	}
+	return client, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const hostLimiterIdleTTL = time.Minute
+
+type hostSlot struct {
+	next     time.Time
+	lastUsed time.Time
+	requests uint64
+}
+
+// HostRateLimiter раздает каждому хосту слоты не чаще rps в секунду, чтобы
+// выгрузка, где почти все урлы с одного домена, не долбила его пачками.
+// Хосты без запросов дольше минуты выкидываются из карты
+type HostRateLimiter struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	hosts     map[string]*hostSlot
+	overrides map[string]time.Duration
+	lastSweep time.Time
+}
+
+// NewHostRateLimiter - rps 0 значит без общего лимита на хост, действуют
+// только интервалы, заданные через SetInterval
+func NewHostRateLimiter(rps uint64) *HostRateLimiter {
+	hl := &HostRateLimiter{
+		hosts:     make(map[string]*hostSlot),
+		overrides: make(map[string]time.Duration),
+		lastSweep: time.Now(),
+	}
+	if rps > 0 {
+		hl.interval = time.Second / time.Duration(rps)
+	}
+	return hl
+}
+
+// SetInterval задает хосту урла свой интервал между запросами вместо общего,
+// например Crawl-delay из robots.txt
+func (hl *HostRateLimiter) SetInterval(rawURL string, interval time.Duration) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	hl.overrides[u.Hostname()] = interval
+	return nil
+}
+
+// reserve занимает ближайший свободный слот хоста и возвращает, сколько до него ждать
+func (hl *HostRateLimiter) reserve(host string) time.Duration {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(hl.lastSweep) > hostLimiterIdleTTL {
+		for h, slot := range hl.hosts {
+			if now.Sub(slot.lastUsed) > hostLimiterIdleTTL {
+				delete(hl.hosts, h)
+			}
+		}
+		hl.lastSweep = now
+	}
+
+	slot, ok := hl.hosts[host]
+	if !ok {
+		slot = &hostSlot{next: now}
+		hl.hosts[host] = slot
+	}
+	if slot.next.Before(now) {
+		slot.next = now
+	}
+	interval := hl.interval
+	if override, ok := hl.overrides[host]; ok {
+		interval = override
+	}
+	wait := slot.next.Sub(now)
+	slot.next = slot.next.Add(interval)
+	slot.lastUsed = slot.next
+	slot.requests++
+
+	return wait
+}
+
+func (hl *HostRateLimiter) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	wait := hl.reserve(u.Hostname())
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HostCounts - сколько запросов выдано каждому хосту, который сейчас в карте
+func (hl *HostRateLimiter) HostCounts() map[string]uint64 {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	counts := make(map[string]uint64, len(hl.hosts))
+	for host, slot := range hl.hosts {
+		counts[host] = slot.requests
+	}
+	return counts
+}
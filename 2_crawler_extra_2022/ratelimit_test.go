@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestHostRateLimiter(t *testing.T) {
+	hl := NewHostRateLimiter(20)
+	ctx := context.Background()
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := hl.Wait(ctx, "http://a.example.com/page"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("3 requests to one host at 20 rps took only %s", elapsed)
+	}
+
+	start = time.Now()
+	if err := hl.Wait(ctx, "https://b.example.com:8443/"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 20*time.Millisecond {
+		t.Errorf("other host must not wait for a.example.com, waited %s", elapsed)
+	}
+
+	counts := hl.HostCounts()
+	if counts["a.example.com"] != 3 || counts["b.example.com"] != 1 {
+		t.Errorf("unexpected host counts %v", counts)
+	}
+
+	hl.mu.Lock()
+	hl.lastSweep = time.Now().Add(-2 * hostLimiterIdleTTL)
+	hl.hosts["a.example.com"].lastUsed = time.Now().Add(-2 * hostLimiterIdleTTL)
+	hl.mu.Unlock()
+	if err := hl.Wait(ctx, "http://b.example.com/"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := hl.HostCounts()["a.example.com"]; ok {
+		t.Error("idle host limiter was not evicted")
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := hl.Wait(cancelled, "http://c.example.com/"); i > 0 && err == nil {
+			t.Error("expected cancelled wait to fail")
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const topErrorClasses = 5
+
+type ErrorClassCount struct {
+	Class string `json:"class"`
+	Count int    `json:"count"`
+}
+
+// RunReport - итог одного запуска краулера, его же получают нотификаторы.
+// HostDelays - итоговый интервал в секундах у хостов с Crawl-delay, SlowHosts -
+// пропущенные хосты с Crawl-delay больше MaxCrawlDelay
+type RunReport struct {
+	Total           uint32             `json:"total"`
+	Succeeded       uint32             `json:"succeeded"`
+	Failed          uint32             `json:"failed"`
+	Skipped         uint32             `json:"skipped"`
+	NotModified     uint32             `json:"not_modified"`
+	Malformed       uint32             `json:"malformed,omitempty"`
+	Invalid         uint32             `json:"invalid,omitempty"`
+	NonHTML         uint32             `json:"non_html,omitempty"`
+	DNSCacheHits    uint64             `json:"dns_cache_hits,omitempty"`
+	DNSCacheMisses  uint64             `json:"dns_cache_misses,omitempty"`
+	Filtered        uint32             `json:"filtered"`
+	ErrorClasses    map[string]int     `json:"error_classes,omitempty"`
+	Categories      map[string]int     `json:"categories,omitempty"`
+	Verdicts        map[string]int     `json:"verdicts,omitempty"`
+	HostDelays      map[string]float64 `json:"host_delays,omitempty"`
+	SlowHosts       map[string]float64 `json:"slow_hosts,omitempty"`
+	DurationSeconds float64            `json:"duration_seconds"`
+	AvgLatencyMs    float64            `json:"avg_latency_ms"`
+	BytesRead       uint64             `json:"bytes_read"`
+	BytesPerSec     float64            `json:"bytes_per_sec"`
+	TopErrors       []ErrorClassCount  `json:"top_errors"`
+	ReportPath      string             `json:"report_path,omitempty"`
+	Error           string             `json:"error,omitempty"`
+}
+
+func classifyError(err error) string {
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var recordErr tls.RecordHeaderError
+	var robotsErr *RobotsDisallowedError
+	var statusErr *HTTPStatusError
+	var parseErr *ParseError
+	var redirectErr *RedirectError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case timeoutPhase(err) != "":
+		return "timeout_" + timeoutPhase(err)
+	case errors.As(err, &robotsErr):
+		return "robots"
+	case errors.As(err, &statusErr):
+		return fmt.Sprintf("http_%dxx", statusErr.StatusCode/100)
+	case errors.As(err, &parseErr):
+		return "parse"
+	case errors.As(err, &redirectErr):
+		return "redirect"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &certErr), errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), errors.As(err, &recordErr):
+		return "tls"
+	default:
+		return "other"
+	}
+}
+
+func (c *Crawler) recordResult(err error) {
+	if err == nil {
+		atomic.AddUint32(&c.succeededCounter, 1)
+		return
+	}
+	atomic.AddUint32(&c.failedCounter, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.errorClasses == nil {
+		c.errorClasses = make(map[string]int)
+	}
+	c.errorClasses[classifyError(err)]++
+}
+
+func (c *Crawler) buildReport(elapsed time.Duration, runErr error) RunReport {
+	report := RunReport{
+		Total:           atomic.LoadUint32(&c.totalCounter),
+		Succeeded:       atomic.LoadUint32(&c.succeededCounter),
+		Failed:          atomic.LoadUint32(&c.failedCounter),
+		Skipped:         atomic.LoadUint32(&c.skippedCounter),
+		NotModified:     atomic.LoadUint32(&c.notModifiedCounter),
+		Malformed:       atomic.LoadUint32(&c.malformedCounter),
+		Invalid:         atomic.LoadUint32(&c.invalidCounter),
+		NonHTML:         atomic.LoadUint32(&c.nonHTMLCounter),
+		Filtered:        atomic.LoadUint32(&c.filteredCounter),
+		DurationSeconds: elapsed.Seconds(),
+		ReportPath:      c.reportPath,
+		BytesRead:       c.bandwidth.Bytes(),
+	}
+	report.DNSCacheHits, report.DNSCacheMisses = c.parser.dns.counts()
+	if elapsed > 0 {
+		report.BytesPerSec = float64(report.BytesRead) / elapsed.Seconds()
+	}
+	if fetched := atomic.LoadUint64(&c.fetchedCounter); fetched > 0 {
+		avg := time.Duration(atomic.LoadInt64(&c.latencyTotal) / int64(fetched))
+		report.AvgLatencyMs = float64(avg) / float64(time.Millisecond)
+	}
+	if runErr != nil {
+		report.Error = runErr.Error()
+	}
+
+	c.mu.Lock()
+	for class, count := range c.errorClasses {
+		report.TopErrors = append(report.TopErrors, ErrorClassCount{Class: class, Count: count})
+		if report.ErrorClasses == nil {
+			report.ErrorClasses = make(map[string]int)
+		}
+		report.ErrorClasses[class] = count
+	}
+	for category, lines := range c.categoryLines {
+		if report.Categories == nil {
+			report.Categories = make(map[string]int)
+		}
+		report.Categories[category] = lines
+	}
+	for host, delay := range c.hostDelays {
+		if report.HostDelays == nil {
+			report.HostDelays = make(map[string]float64)
+		}
+		report.HostDelays[host] = delay.Seconds()
+	}
+	for host, delay := range c.slowHosts {
+		if report.SlowHosts == nil {
+			report.SlowHosts = make(map[string]float64)
+		}
+		report.SlowHosts[host] = delay.Seconds()
+	}
+	for verdict, count := range c.verdicts {
+		if report.Verdicts == nil {
+			report.Verdicts = make(map[string]int)
+		}
+		report.Verdicts[verdict] = count
+	}
+	c.mu.Unlock()
+	sort.Slice(report.TopErrors, func(i, j int) bool {
+		if report.TopErrors[i].Count != report.TopErrors[j].Count {
+			return report.TopErrors[i].Count > report.TopErrors[j].Count
+		}
+		return report.TopErrors[i].Class < report.TopErrors[j].Class
+	})
+	if len(report.TopErrors) > topErrorClasses {
+		report.TopErrors = report.TopErrors[:topErrorClasses]
+	}
+
+	return report
+}
+
+func writeReport(path string, report RunReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Report - итог последнего Start
+func (c *Crawler) Report() RunReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.report
+}
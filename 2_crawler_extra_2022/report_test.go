@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := []struct {
+		err   error
+		class string
+	}{
+		{context.Canceled, "canceled"},
+		{&net.DNSError{Err: "no such host", Name: "nope.invalid"}, "dns"},
+		{context.DeadlineExceeded, "timeout"},
+		{&HTTPStatusError{URL: "http://a", StatusCode: 404}, "http_4xx"},
+		{&HTTPStatusError{URL: "http://a", StatusCode: 503}, "http_5xx"},
+		{&ParseError{URL: "http://a", Err: errors.New("bad")}, "parse"},
+		{&RobotsDisallowedError{URL: "http://a"}, "robots"},
+		{errors.New("boom"), "other"},
+	}
+	for _, tc := range cases {
+		if got := classifyError(tc.err); got != tc.class {
+			t.Errorf("%v: expected class %q, got %q", tc.err, tc.class, got)
+		}
+	}
+}
+
+func TestRunReport(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	})
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/garbled", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write([]byte("not really brotli"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeSites(t, srv.URL+"/ok", srv.URL+"/ok?page=2", srv.URL+"/error", srv.URL+"/missing", srv.URL+"/garbled")
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	report := c.Report()
+	if report.Total != 5 || report.Succeeded != 2 || report.Failed != 2 || report.Skipped != 1 {
+		t.Errorf("unexpected counts %+v", report)
+	}
+	if expected := map[string]int{"http_5xx": 1, "parse": 1}; !reflect.DeepEqual(report.ErrorClasses, expected) {
+		t.Errorf("expected error classes %v, got %v", expected, report.ErrorClasses)
+	}
+	if expected := map[string]int{"good_site": 2}; !reflect.DeepEqual(report.Categories, expected) {
+		t.Errorf("expected category lines %v, got %v", expected, report.Categories)
+	}
+	if expected := map[string]int{"ok": 2, "error_http_4xx": 1, "error_http_5xx": 1, "error_parse": 1}; !reflect.DeepEqual(report.Verdicts, expected) {
+		t.Errorf("expected verdicts %v, got %v", expected, report.Verdicts)
+	}
+	if report.AvgLatencyMs < 5 || report.AvgLatencyMs > 1000 {
+		t.Errorf("unexpected average latency %.2fms", report.AvgLatencyMs)
+	}
+	if report.DurationSeconds <= 0 {
+		t.Errorf("unexpected duration %v", report.DurationSeconds)
+	}
+}
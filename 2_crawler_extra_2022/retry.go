@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	RetryOn      []int
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  3,
+	InitialDelay: 500 * time.Millisecond,
+	Multiplier:   2,
+	MaxDelay:     5 * time.Second,
+	RetryOn: []int{
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// retryable - повторяем только ответы из RetryOn и временные ошибки сети:
+// таймауты, сброшенное или отвергнутое соединение и временный сбой DNS.
+// Ошибки сертификатов, неподдерживаемая схема и ненайденный хост не пройдут и со второго раза
+func (rp RetryPolicy) retryable(err error) bool {
+	var rErr *RedirectError
+	if errors.Is(err, context.Canceled) || errors.As(err, &rErr) {
+		return false
+	}
+	var sErr *HTTPStatusError
+	if errors.As(err, &sErr) {
+		for _, code := range rp.RetryOn {
+			if code == sErr.StatusCode {
+				return true
+			}
+		}
+		return false
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// backoff - экспоненциальная задержка перед повтором с джиттером в пределах [d/2, d]
+func (rp RetryPolicy) backoff(retry int) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier < 1 {
+		multiplier = 2
+	}
+	delay := float64(rp.InitialDelay)
+	for i := 1; i < retry; i++ {
+		delay *= multiplier
+		if rp.MaxDelay > 0 && delay > float64(rp.MaxDelay) {
+			break
+		}
+	}
+	if rp.MaxDelay > 0 && delay > float64(rp.MaxDelay) {
+		delay = float64(rp.MaxDelay)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := int64(delay / 2)
+	return time.Duration(half + rand.Int63n(int64(delay)-half+1))
+}
+
+func (c *Crawler) fetchPage(ctx context.Context, site *Site) (*page, error) {
+	client, err := c.parser.clientFor(site)
+	if err != nil {
+		return nil, err
+	}
+
+	url := site.Url
+	rp := c.parser.retry
+	attempts := rp.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			atomic.AddUint32(&c.retriedCounter, 1)
+			select {
+			case <-time.After(rp.backoff(attempt - 1)):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		// хост, который уже не разрешился, отваливается сразу и не тратит лимит.
+		// Через свой прокси сайт ходит с его DNS, кэш там ни при чем
+		if site.Proxy == nil {
+			if err := c.parser.dns.failure(url); err != nil {
+				return nil, err
+			}
+		}
+		if err := c.parser.wait(ctx, url); err != nil {
+			return nil, err
+		}
+		p, err := c.fetchAndParse(ctx, client, site, url)
+		if err == nil {
+			return p, nil
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		lastErr = err
+		if !rp.retryable(err) {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("%w (after %d attempts)", lastErr, attempts)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// newFlakyServer отвечает status первые failures запросов, потом 200
+func newFlakyServer(t *testing.T, failures uint32, status int, hits *uint32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddUint32(hits, 1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchPageRetry(t *testing.T) {
+	retry := DefaultRetryPolicy
+	retry.MaxAttempts = 4
+	retry.InitialDelay = time.Millisecond
+	retry.MaxDelay = 5 * time.Millisecond
+
+	cases := []struct {
+		name     string
+		failures uint32
+		status   int
+		hits     uint32
+		retried  uint32
+		errPart  string
+	}{
+		{"succeeds after retries", 3, http.StatusServiceUnavailable, 4, 3, ""},
+		{"gives up after max attempts", 10, http.StatusTooManyRequests, 4, 3, "after 4 attempts"},
+		{"server error", 2, http.StatusInternalServerError, 3, 2, ""},
+		{"not found is final", 10, http.StatusNotFound, 1, 0, "unexpected status 404"},
+		{"forbidden is final", 10, http.StatusForbidden, 1, 0, "unexpected status 403"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var hits uint32
+			srv := newFlakyServer(t, tc.failures, tc.status, &hits)
+			c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 4, Retry: retry, Status: DefaultStatusPolicy})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p, err := c.fetchPage(context.Background(), &Site{Url: srv.URL})
+			if tc.errPart == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if p.meta.Title != "ok" {
+					t.Errorf("unexpected title %q", p.meta.Title)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.errPart) {
+				t.Errorf("expected error containing %q, got %v", tc.errPart, err)
+			}
+			if hits != tc.hits {
+				t.Errorf("expected %d requests, got %d", tc.hits, hits)
+			}
+			if c.retriedCounter != tc.retried {
+				t.Errorf("expected %d retries, got %d", tc.retried, c.retriedCounter)
+			}
+		})
+	}
+}
+
+func TestRetryableErrors(t *testing.T) {
+	dial := func(err error) error {
+		return &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+	cases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"timeout", dial(dialTimeout{}), true},
+		{"client timeout", &url.Error{Op: "Get", URL: "https://example.com/", Err: context.DeadlineExceeded}, true},
+		{"connection refused", dial(os.NewSyscallError("connect", syscall.ECONNREFUSED)), true},
+		{"connection reset", &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}}, true},
+		{"temporary dns", dial(&net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}), true},
+		{"host not found", dial(&net.DNSError{Err: "no such host", Name: "example.com", IsNotFound: true}), false},
+		{"unknown authority", &url.Error{Op: "Get", URL: "https://example.com/", Err: x509.UnknownAuthorityError{}}, false},
+		{"certificate", &url.Error{Op: "Get", URL: "https://example.com/", Err: &tls.CertificateVerificationError{Err: x509.HostnameError{Host: "example.com"}}}, false},
+		{"unsupported scheme", &url.Error{Op: "Get", URL: "ftp://example.com/", Err: errors.New(`unsupported protocol scheme "ftp"`)}, false},
+		{"canceled", &url.Error{Op: "Get", URL: "https://example.com/", Err: context.Canceled}, false},
+	}
+	for _, tc := range cases {
+		if got := DefaultRetryPolicy.retryable(tc.err); got != tc.retryable {
+			t.Errorf("%s: expected retryable %v, got %v", tc.name, tc.retryable, got)
+		}
+	}
+
+	// живой запрос с неподдерживаемой схемой уходит с первой попытки
+	retry := DefaultRetryPolicy
+	retry.InitialDelay = time.Millisecond
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Retry: retry, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.fetchPage(context.Background(), &Site{Url: "ftp://example.com/"}); err == nil {
+		t.Fatal("expected an error for ftp")
+	}
+	if c.retriedCounter != 0 {
+		t.Errorf("unsupported scheme must not be retried, got %d retries", c.retriedCounter)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// RetryWriter повторяет Write и Flush inner до MaxAttempts раз с паузой Delay,
+// для сетевых дисков, которые изредка отказывают на записи. Close не повторяется
+type RetryWriter struct {
+	inner       DataWriter
+	MaxAttempts int
+	Delay       time.Duration
+}
+
+func NewRetryWriter(inner DataWriter, maxAttempts int, delay time.Duration) DataWriter {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &RetryWriter{inner: inner, MaxAttempts: maxAttempts, Delay: delay}
+}
+
+// retry с отмененным ctx больше не пытается и возвращает последнюю ошибку записи
+func (rw *RetryWriter) retry(ctx context.Context, call func() error) error {
+	var err error
+	for attempt := 1; attempt <= rw.MaxAttempts; attempt++ {
+		if attempt > 1 {
+			select {
+			case <-time.After(rw.Delay):
+			case <-ctx.Done():
+				return err
+			}
+		}
+		if err = call(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (rw *RetryWriter) Write(data string) error {
+	return rw.WriteCtx(context.Background(), data)
+}
+
+func (rw *RetryWriter) WriteCtx(ctx context.Context, data string) error {
+	return rw.retry(ctx, func() error { return WriteCtx(ctx, rw.inner, data) })
+}
+
+func (rw *RetryWriter) Flush() error {
+	return rw.retry(context.Background(), rw.inner.Flush)
+}
+
+func (rw *RetryWriter) Close() error {
+	return rw.inner.Close()
+}
+
+func (rw *RetryWriter) Empty() bool {
+	if ew, ok := rw.inner.(emptyWriter); ok {
+		return ew.Empty()
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// flakyWriter - memWriter, у которого первые fails вызовов Write, Flush и Close отказывают
+type flakyWriter struct {
+	memWriter
+	fails                   int
+	writes, flushes, closes int
+}
+
+func (fw *flakyWriter) Write(data string) error {
+	if fw.writes++; fw.writes <= fw.fails {
+		return fmt.Errorf("stale file handle %d", fw.writes)
+	}
+	return fw.memWriter.Write(data)
+}
+
+func (fw *flakyWriter) Flush() error {
+	if fw.flushes++; fw.flushes <= fw.fails {
+		return errors.New("flush failed")
+	}
+	return fw.memWriter.Flush()
+}
+
+func (fw *flakyWriter) Close() error {
+	if fw.closes++; fw.closes <= fw.fails {
+		return errors.New("close failed")
+	}
+	return fw.memWriter.Close()
+}
+
+func TestRetryWriter(t *testing.T) {
+	inner := &flakyWriter{fails: 2}
+	w := NewRetryWriter(inner, 3, time.Millisecond)
+	if err := w.Write("line\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if inner.writes != 3 || inner.flushes != 3 || len(inner.lines) != 1 || inner.memWriter.flushes != 1 {
+		t.Errorf("expected two retries each, got %+v", inner)
+	}
+	if err := w.Close(); err == nil || inner.closes != 1 {
+		t.Errorf("close must not be retried, got %v after %d calls", err, inner.closes)
+	}
+
+	inner = &flakyWriter{fails: 5}
+	w = NewRetryWriter(inner, 3, time.Millisecond)
+	if err := w.Write("line\n"); err == nil || err.Error() != "stale file handle 3" || inner.writes != 3 {
+		t.Errorf("expected the last error after 3 attempts, got %v after %d", err, inner.writes)
+	}
+
+	// ретраи внутри фоновой горутины AsyncWriter
+	inner = &flakyWriter{fails: 1}
+	aw := NewAsyncWriter(NewRetryWriter(inner, 2, time.Millisecond), 10)
+	if err := aw.Write("async\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := aw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(inner.lines) != 1 || inner.lines[0] != "async\n" {
+		t.Errorf("unexpected lines %q", inner.lines)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRobotsTTL         = time.Hour
+	defaultRobotsNegativeTTL = 5 * time.Minute
+	robotsFetchTimeout       = 5 * time.Second
+	maxRobotsSize            = 512 << 10
+)
+
+// RobotsDisallowedError - robots.txt запрещает нашему user-agent этот урл
+type RobotsDisallowedError struct {
+	URL string
+}
+
+func (e *RobotsDisallowedError) Error() string {
+	return fmt.Sprintf("%s: disallowed by robots.txt", e.URL)
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+type robotsGroup struct {
+	agents     []string
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRules struct {
+	groups []*robotsGroup
+}
+
+// parseRobots разбирает robots.txt на группы user-agent с их правилами
+func parseRobots(r io.Reader) *robotsRules {
+	rules := &robotsRules{}
+	var group *robotsGroup
+	inAgents := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				group = &robotsGroup{}
+				rules.groups = append(rules.groups, group)
+				inAgents = true
+			}
+			group.agents = append(group.agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if key == "disallow" && value == "" {
+				continue
+			}
+			group.rules = append(group.rules, robotsRule{allow: key == "allow", pattern: value})
+		case "crawl-delay":
+			inAgents = false
+			if group == nil {
+				continue
+			}
+			if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+				group.crawlDelay = time.Duration(seconds * float64(time.Second))
+			}
+		default:
+			inAgents = false
+		}
+	}
+
+	return rules
+}
+
+// group выбирает группу с самым длинным совпавшим user-agent, иначе группу "*"
+func (rr *robotsRules) group(userAgent string) *robotsGroup {
+	userAgent = strings.ToLower(userAgent)
+	var best, wildcard *robotsGroup
+	bestLen := 0
+	for _, g := range rr.groups {
+		for _, agent := range g.agents {
+			if agent == "*" {
+				if wildcard == nil {
+					wildcard = g
+				}
+				continue
+			}
+			if strings.Contains(userAgent, agent) && len(agent) > bestLen {
+				best, bestLen = g, len(agent)
+			}
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return wildcard
+}
+
+// allowed - побеждает самое длинное совпавшее правило, при равенстве Allow
+func (rr *robotsRules) allowed(userAgent, path string) bool {
+	g := rr.group(userAgent)
+	if g == nil {
+		return true
+	}
+	allow, matchLen := true, -1
+	for _, rule := range g.rules {
+		if !robotsMatch(rule.pattern, path) {
+			continue
+		}
+		if len(rule.pattern) > matchLen || (len(rule.pattern) == matchLen && rule.allow) {
+			allow, matchLen = rule.allow, len(rule.pattern)
+		}
+	}
+	return allow
+}
+
+func (rr *robotsRules) crawlDelay(userAgent string) time.Duration {
+	if g := rr.group(userAgent); g != nil {
+		return g.crawlDelay
+	}
+	return 0
+}
+
+// robotsMatch понимает * как любую последовательность и $ как конец пути
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, part := range parts[1:] {
+		if anchored && i == len(parts)-2 {
+			return strings.HasSuffix(path[pos:], part)
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return false
+		}
+		pos += idx + len(part)
+	}
+	return !anchored || pos == len(path)
+}
+
+type robotsEntry struct {
+	once    sync.Once
+	rules   *robotsRules
+	fetched time.Time
+	failed  bool
+}
+
+// RobotsCache лениво скачивает robots.txt для каждого хоста и держит его TTL.
+// Если robots.txt не удалось получить, разрешено все, но только на NegativeTTL
+type RobotsCache struct {
+	TTL         time.Duration
+	NegativeTTL time.Duration
+	client      *http.Client
+	build       func(ctx context.Context, url string) (*http.Request, error)
+	entries     sync.Map
+}
+
+func NewRobotsCache(p *parser, ttl time.Duration) *RobotsCache {
+	return &RobotsCache{
+		TTL:         ttl,
+		NegativeTTL: defaultRobotsNegativeTTL,
+		client:      p.client,
+		build: func(ctx context.Context, url string) (*http.Request, error) {
+			return p.requestBuilder(ctx, nil, url)
+		},
+	}
+}
+
+func (rc *RobotsCache) Allowed(userAgent, rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return true
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return rc.rules(u).allowed(userAgent, path)
+}
+
+// CrawlDelay - Crawl-delay из robots.txt для нашего user-agent, 0 если не задан
+func (rc *RobotsCache) CrawlDelay(userAgent, rawURL string) time.Duration {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return 0
+	}
+	return rc.rules(u).crawlDelay(userAgent)
+}
+
+func (rc *RobotsCache) rules(u *url.URL) *robotsRules {
+	key := u.Scheme + "://" + u.Host
+
+	value, _ := rc.entries.LoadOrStore(key, &robotsEntry{})
+	entry := value.(*robotsEntry)
+	entry.once.Do(func() {
+		rules, ok := rc.fetch(key + "/robots.txt")
+		entry.rules, entry.fetched, entry.failed = rules, time.Now(), !ok
+	})
+	ttl := rc.TTL
+	if entry.failed {
+		ttl = rc.NegativeTTL
+	}
+	if ttl > 0 && time.Since(entry.fetched) > ttl {
+		rc.entries.CompareAndSwap(key, entry, &robotsEntry{})
+	}
+
+	return entry.rules
+}
+
+// fetch - если robots.txt нет, считаем что можно все. Если он не отдается из-за
+// ошибки сети или сервера, тоже можно все, но ok == false и кешируется ненадолго
+func (rc *RobotsCache) fetch(robotsURL string) (*robotsRules, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), robotsFetchTimeout)
+	defer cancel()
+
+	req, err := rc.build(ctx, robotsURL)
+	if err != nil {
+		return &robotsRules{}, false
+	}
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return &robotsRules{}, false
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return &robotsRules{}, false
+	case resp.StatusCode != http.StatusOK:
+		return &robotsRules{}, true
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsSize)), true
+}
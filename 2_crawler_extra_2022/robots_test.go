@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const robotsFixture = `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/open
+Disallow: /*.pdf$
+
+User-agent: BadBot
+User-agent: EvilBot
+Disallow: /
+
+User-agent: SlowBot
+Crawl-delay: 2.5
+`
+
+func TestRobotsRules(t *testing.T) {
+	rules := parseRobots(strings.NewReader(robotsFixture))
+	cases := []struct {
+		agent   string
+		path    string
+		allowed bool
+	}{
+		{defaultUserAgent, "/", true},
+		{defaultUserAgent, "/private", false},
+		{defaultUserAgent, "/private/secret", false},
+		{defaultUserAgent, "/private/open/page", true},
+		{defaultUserAgent, "/docs/file.pdf", false},
+		{defaultUserAgent, "/docs/file.pdf?x=1", true},
+		{"Mozilla/5.0 (compatible; EvilBot/1.0)", "/anything", false},
+		{"BadBot", "/", false},
+	}
+	for _, tc := range cases {
+		if got := rules.allowed(tc.agent, tc.path); got != tc.allowed {
+			t.Errorf("allowed(%q, %q) = %v, expected %v", tc.agent, tc.path, got, tc.allowed)
+		}
+	}
+	if d := rules.crawlDelay("SlowBot/1.0"); d != 2500*time.Millisecond {
+		t.Errorf("expected crawl-delay 2.5s for SlowBot, got %s", d)
+	}
+	if d := rules.crawlDelay(defaultUserAgent); d != 0 {
+		t.Errorf("expected no crawl-delay for %s, got %s", defaultUserAgent, d)
+	}
+}
+
+func TestRobotsCache(t *testing.T) {
+	var robotsHits, pageHits uint32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddUint32(&robotsHits, 1)
+			fmt.Fprint(w, robotsFixture)
+			return
+		}
+		atomic.AddUint32(&pageHits, 1)
+		fmt.Fprint(w, "<html><head><title>ok</title></head></html>")
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 4, RespectRobots: true, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeSites(t, srv.URL+"/", srv.URL+"/a", srv.URL+"/private/a", srv.URL+"/private/b")
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	if robotsHits != 1 {
+		t.Errorf("expected robots.txt to be fetched once, got %d", robotsHits)
+	}
+	if pageHits != 2 || c.failedCounter != 2 || c.checkCounter.Load() != 2 {
+		t.Errorf("expected 2 pages fetched and 2 disallowed, got pages=%d failed=%d checked=%d",
+			pageHits, c.failedCounter, c.checkCounter.Load())
+	}
+	if report := c.buildReport(0, nil); len(report.TopErrors) != 1 || report.TopErrors[0] != (ErrorClassCount{"robots", 2}) {
+		t.Errorf("expected disallowed sites in the error summary, got %+v", report.TopErrors)
+	}
+
+	c.robots.TTL = time.Nanosecond
+	c.robots.Allowed(defaultUserAgent, srv.URL+"/")
+	time.Sleep(time.Millisecond)
+	c.robots.Allowed(defaultUserAgent, srv.URL+"/")
+	if robotsHits != 2 {
+		t.Errorf("expected robots.txt to be refetched after TTL, got %d fetches", robotsHits)
+	}
+}
+
+func TestRobotsCrawlDelayAndNegativeCache(t *testing.T) {
+	var robotsHits uint32
+	var broken atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			atomic.AddUint32(&robotsHits, 1)
+			if broken.Load() {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, "User-agent: *\nCrawl-delay: 0.1\nDisallow: /private\n")
+			return
+		}
+		fmt.Fprint(w, "<html><head><title>ok</title></head></html>")
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, RespectRobots: true, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writers := NewWriterManager(c.createWriterForCategory, 0, 0)
+	err = c.checkSite(context.Background(), &Site{Url: srv.URL + "/private/a"}, writers)
+	var robotsErr *RobotsDisallowedError
+	if !errors.As(err, &robotsErr) || robotsErr.URL != srv.URL+"/private/a" {
+		t.Errorf("expected RobotsDisallowedError, got %v", err)
+	}
+
+	// Crawl-delay 0.1s заменяет отсутствующий лимит на хост
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := c.checkSite(context.Background(), &Site{Url: srv.URL + "/"}, writers); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("3 requests with crawl-delay 0.1s took only %s", elapsed)
+	}
+
+	// robots.txt с 503 разрешает все, но перезапрашивается через NegativeTTL, а не TTL
+	broken.Store(true)
+	rc := NewRobotsCache(c.parser, time.Hour)
+	rc.NegativeTTL = 50 * time.Millisecond
+	atomic.StoreUint32(&robotsHits, 0)
+	if !rc.Allowed(defaultUserAgent, srv.URL+"/private/a") {
+		t.Error("expected everything allowed when robots.txt fails")
+	}
+	rc.Allowed(defaultUserAgent, srv.URL+"/")
+	time.Sleep(60 * time.Millisecond)
+	rc.Allowed(defaultUserAgent, srv.URL+"/")
+	rc.Allowed(defaultUserAgent, srv.URL+"/")
+	if robotsHits != 2 {
+		t.Errorf("expected failed robots.txt to be refetched after NegativeTTL, got %d fetches", robotsHits)
+	}
+
+	c, err = NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.robots != nil {
+		t.Error("robots.txt must be opt-in")
+	}
+}
+
+func TestCrawlDelayPolicy(t *testing.T) {
+	newServer := func(robots string) *httptest.Server {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				fmt.Fprint(w, robots)
+				return
+			}
+			fmt.Fprint(w, "<html><head><title>ok</title></head></html>")
+		}))
+		t.Cleanup(srv.Close)
+		return srv
+	}
+
+	cases := []struct {
+		name       string
+		robots     string
+		perHostRPS uint64
+		delay      float64
+		slow       bool
+	}{
+		{"no crawl-delay", "User-agent: *\nDisallow: /private\n", 0, 0, false},
+		{"robots is stricter", "User-agent: *\nCrawl-delay: 0.05\n", 100, 0.05, false},
+		{"configured is stricter", "User-agent: *\nCrawl-delay: 0.01\n", 20, 0.05, false},
+		{"over the cap", "User-agent: *\nCrawl-delay: 86400\n", 0, 0, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newServer(tc.robots)
+			c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, PerHostRPS: tc.perHostRPS, Workers: 1, RespectRobots: true, MaxCrawlDelay: time.Hour, Status: DefaultStatusPolicy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Start(context.Background(), writeSites(t, srv.URL+"/a", srv.URL+"/b")); err != nil {
+				t.Fatal(err)
+			}
+			report := c.Report()
+			if got := report.HostDelays["127.0.0.1"]; got != tc.delay {
+				t.Errorf("expected effective delay %v, got %v in %v", tc.delay, got, report.HostDelays)
+			}
+			if tc.slow {
+				if report.SlowHosts["127.0.0.1"] != 86400 || report.Skipped != 2 || report.Verdicts[VerdictSlowHost] != 2 || report.Succeeded != 0 {
+					t.Errorf("expected the host to be flagged and skipped, got %+v", report)
+				}
+			} else if len(report.SlowHosts) != 0 || report.Succeeded != 2 {
+				t.Errorf("expected both sites crawled, got %+v", report)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultFileTemplate = "{category}-{date}-{seq}"
+
+var errNoSeqInTemplate = errors.New("file template needs {seq} or %d to rotate")
+
+// RotatingFileWriter пишет в файлы по шаблону с {date} и {seq} (или %d, как в
+// news_%d.tsv) и переходит на следующий seq, когда очередная строка не влезает
+// в maxBytes. Строка всегда целиком попадает в один файл, даже если она сама
+// больше лимита. Как и FileWriter, рассчитан на то, что Write зовут под
+// мьютексом WriterManager
+type RotatingFileWriter struct {
+	template string
+	maxBytes int64
+	seq      int
+	size     int64
+	file     *os.File
+	writer   *bufio.Writer
+}
+
+// NewRotatingFileWriter продолжает с последнего файла прошлых запусков
+// за ту же дату: недописанный дописывается, полный пропускается
+func NewRotatingFileWriter(template string, maxBytes int64) (*RotatingFileWriter, error) {
+	if maxBytes > 0 && !strings.Contains(template, "{seq}") && !strings.Contains(template, "%d") {
+		return nil, errNoSeqInTemplate
+	}
+	rw := &RotatingFileWriter{template: template, maxBytes: maxBytes}
+	for maxBytes > 0 {
+		rw.seq++
+		if _, err := os.Stat(rw.filename()); err != nil {
+			rw.seq--
+			break
+		}
+	}
+	if err := rw.open(); err != nil {
+		return nil, err
+	}
+	return rw, nil
+}
+
+func (rw *RotatingFileWriter) filename() string {
+	seq := strconv.Itoa(rw.seq)
+	return strings.NewReplacer(
+		"{date}", time.Now().Format("2006-01-02"),
+		"{seq}", seq,
+		"%d", seq,
+	).Replace(rw.template)
+}
+
+func (rw *RotatingFileWriter) open() error {
+	for {
+		file, err := os.OpenFile(rw.filename(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		if rw.maxBytes > 0 && info.Size() >= rw.maxBytes {
+			// полный файл прошлого запуска
+			file.Close()
+			rw.seq++
+			continue
+		}
+		rw.file, rw.writer = file, bufio.NewWriter(file)
+		rw.size = info.Size()
+		return nil
+	}
+}
+
+func (rw *RotatingFileWriter) rotate() error {
+	if err := rw.writer.Flush(); err != nil {
+		return err
+	}
+	if err := rw.file.Close(); err != nil {
+		return err
+	}
+	rw.seq++
+	return rw.open()
+}
+
+func (rw *RotatingFileWriter) Write(data string) error {
+	if rw.maxBytes > 0 && rw.size > 0 && rw.size+int64(len(data)) > rw.maxBytes {
+		if err := rw.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := rw.writer.WriteString(data)
+	rw.size += int64(n)
+	return err
+}
+
+// Empty относится к текущему файлу
+func (rw *RotatingFileWriter) Empty() bool {
+	return rw.size == 0
+}
+
+func (rw *RotatingFileWriter) Flush() error {
+	return rw.writer.Flush()
+}
+
+// Close удаляет последний файл, если в него так ничего и не записали
+func (rw *RotatingFileWriter) Close() error {
+	if err := rw.writer.Flush(); err != nil {
+		rw.file.Close()
+		return err
+	}
+	if err := rw.file.Close(); err != nil {
+		return err
+	}
+	if rw.size == 0 {
+		return os.Remove(rw.file.Name())
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func listFiles(t *testing.T, dir string) map[string]int64 {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]int64{}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = info.Size()
+	}
+	return files
+}
+
+func TestRotatingFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	date := time.Now().Format("2006-01-02")
+	line := strings.Repeat("x", 9) + "\n"
+
+	rw, err := NewRotatingFileWriter(filepath.Join(dir, "news-{date}-{seq}.tsv"), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := rw.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// строка больше лимита уходит в свой файл целиком
+	if err := rw.Write(strings.Repeat("y", 39) + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]int64{
+		"news-" + date + "-0.tsv": 20,
+		"news-" + date + "-1.tsv": 20,
+		"news-" + date + "-2.tsv": 10,
+		"news-" + date + "-3.tsv": 40,
+	}
+	if files := listFiles(t, dir); !equalSizes(files, expected) {
+		t.Errorf("expected %v, got %v", expected, files)
+	}
+
+	// следующий запуск за ту же дату продолжает после последнего файла, тот полный
+	rw, err = NewRotatingFileWriter(filepath.Join(dir, "news-{date}-{seq}.tsv"), 25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rw.seq != 4 {
+		t.Errorf("expected to continue with seq 4, got %d", rw.seq)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := listFiles(t, dir); !equalSizes(files, expected) {
+		t.Errorf("expected the empty file to be removed, got %v", files)
+	}
+
+	// а неполный последний файл дописывается
+	partial := filepath.Join(dir, "partial-{seq}.tsv")
+	os.WriteFile(filepath.Join(dir, "partial-0.tsv"), []byte(line+line+line), 0644)
+	os.WriteFile(filepath.Join(dir, "partial-1.tsv"), []byte(line), 0644)
+	if rw, err = NewRotatingFileWriter(partial, 25); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Write(line); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := listFiles(t, dir); files["partial-0.tsv"] != 30 || files["partial-1.tsv"] != 20 || len(files) != 6 {
+		t.Errorf("expected partial-1.tsv to be appended to, got %v", files)
+	}
+
+	// пустой последний файл удаляется
+	empty := filepath.Join(dir, "empty-{seq}.tsv")
+	if rw, err = NewRotatingFileWriter(empty, 25); err != nil {
+		t.Fatal(err)
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "empty-0.tsv")); !os.IsNotExist(err) {
+		t.Errorf("expected an empty file to be removed, got %v", err)
+	}
+
+	if _, err := NewRotatingFileWriter(filepath.Join(dir, "news.tsv"), 25); err != errNoSeqInTemplate {
+		t.Errorf("expected errNoSeqInTemplate, got %v", err)
+	}
+}
+
+func equalSizes(got, expected map[string]int64) bool {
+	if len(got) != len(expected) {
+		return false
+	}
+	for name, size := range expected {
+		if got[name] != size {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCrawlerRotation(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	var urls []string
+	for _, path := range []string{"/a", "/b", "/c", "/d"} {
+		urls = append(urls, srv.URL+path)
+	}
+	path := writeSites(t, urls...)
+
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, WriterType: "file", FileTemplate: "{category}_{seq}.tsv", MaxFileBytes: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	files := listFiles(t, ".")
+	var names []string
+	for name := range files {
+		if name != categoriesFile {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if expected := []string{"good_site_0.tsv", "good_site_1.tsv", "good_site_2.tsv", "good_site_3.tsv"}; strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected one file per line %v, got %v", expected, names)
+	}
+}
+
+func TestRotatingFileWriterPrintfPattern(t *testing.T) {
+	dir := t.TempDir()
+	line := strings.Repeat("x", 99) + "\n"
+
+	// 10 строк по 100 байт при лимите 250 - по две в файл
+	rw, err := NewRotatingFileWriter(filepath.Join(dir, "news_%d.tsv"), 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := rw.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := listFiles(t, dir)
+	if len(files) != 5 {
+		t.Fatalf("expected 5 files, got %v", files)
+	}
+	for i := 0; i < 5; i++ {
+		if size := files["news_"+strconv.Itoa(i)+".tsv"]; size != 200 {
+			t.Errorf("expected news_%d.tsv with 200 bytes, got %d", i, size)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// DefaultSelectorsKey - ключ Selectors для категорий, у которых своих селекторов нет
+const DefaultSelectorsKey = "default"
+
+// FieldSelector - поле для Options.Selectors, устроено как ExtractionRule:
+// пустой Attr - текст элемента, повтор Name - запасной селектор той же колонки,
+// {"Name": "protocol", "RecordProtocol": true} - протокол ответа
+type FieldSelector = ExtractionRule
+
+// LoadFieldSelectors читает json объект категория -> список селекторов.
+// Сами селекторы проверяются в Start
+func LoadFieldSelectors(path string) (map[string][]FieldSelector, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var selectors map[string][]FieldSelector
+	if err := json.Unmarshal(data, &selectors); err != nil {
+		return nil, fmt.Errorf("selectors %s: %w", path, err)
+	}
+	return selectors, nil
+}
+
+// validateSelectors компилирует каждый селектор: goquery на битом селекторе
+// молча ничего не находит, и ошибка иначе всплыла бы пустыми колонками
+func validateSelectors(selectors map[string][]FieldSelector) error {
+	categories := make([]string, 0, len(selectors))
+	for category := range selectors {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	for _, category := range categories {
+		for i, fs := range selectors[category] {
+			if fs.Name == "" || (fs.Selector == "") != fs.RecordProtocol {
+				return fmt.Errorf("selectors for %s: field %d: name and either selector or record protocol are required", category, i)
+			}
+			if fs.RecordProtocol {
+				continue
+			}
+			if _, err := cascadia.Compile(fs.Selector); err != nil {
+				return fmt.Errorf("selectors for %s: field %s: %w", category, fs.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// applySelectors достает поля для всех категорий из Selectors сразу: категории,
+// добавленные CategoryRule, известны только после разбора страницы
+func (c *Crawler) applySelectors(doc *goquery.Document, proto string) map[string][]Field {
+	if len(c.selectors) == 0 {
+		return nil
+	}
+	fields := make(map[string][]Field, len(c.selectors))
+	for category, selectors := range c.selectors {
+		fields[category] = applyRules(doc, selectors, proto)
+	}
+	return fields
+}
+
+// fieldsFor - поля для строки категории: ее селекторы, затем "default",
+// затем общие ExtractionRule
+func (p *page) fieldsFor(category string) []Field {
+	if fields, ok := p.categoryFields[category]; ok {
+		return fields
+	}
+	if fields, ok := p.categoryFields[DefaultSelectorsKey]; ok {
+		return fields
+	}
+	return p.fields
+}
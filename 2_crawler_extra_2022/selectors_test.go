@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSelectorsByCategory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Store news</title>
+<meta property="article:published_time" content="2024-03-01T10:00:00Z">
+<meta property="og:price:amount" content="19.99"></head>
+<body><h1> Sale starts </h1><h1>Second</h1></body></html>`))
+	}))
+	defer srv.Close()
+
+	selectors := map[string][]FieldSelector{
+		"news": {
+			{Name: "headline", Selector: "h1"},
+			{Name: "published", Selector: "meta[property='article:published_time']", Attr: "content"},
+		},
+		"shops": {
+			{Name: "price", Selector: "meta[property='og:price:amount']", Attr: "content"},
+			{Name: "sku", Selector: "[itemprop=sku]"},
+		},
+		DefaultSelectorsKey: {{Name: "title", Selector: "title"}},
+	}
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy, Selectors: selectors})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mw := &memWriter{}
+	writers := newJSONWriters(mw)
+	site := &Site{Url: srv.URL, Categories: []string{"news", "shops", "blogs"}}
+	if err := c.checkSite(context.Background(), site, writers); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]map[string]string{
+		"news":  {"headline": "Sale starts", "published": "2024-03-01T10:00:00Z"},
+		"shops": {"price": "19.99", "sku": ""},
+		"blogs": {"title": "Store news"},
+	}
+	got := make(map[string]map[string]string)
+	for _, line := range mw.lines {
+		var rec jsonRecord
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatal(err)
+		}
+		got[rec.Category] = rec.Fields
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected fields by category\nGot: %v\nExpected: %v", got, expected)
+	}
+
+	c.selectors["shops"] = append(c.selectors["shops"], FieldSelector{Name: "broken", Selector: "div[class="})
+	err = c.Start(context.Background(), writeSites(t, srv.URL))
+	if err == nil || !strings.Contains(err.Error(), "selectors for shops: field broken") {
+		t.Errorf("expected Start to reject the invalid selector, got %v", err)
+	}
+}
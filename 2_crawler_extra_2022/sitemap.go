@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	maxSitemapSize  = 50 << 20
+	sitemapCategory = "default"
+)
+
+type sitemapLoc struct {
+	Loc string `xml:"loc"`
+}
+
+// sitemapDoc - и urlset, и sitemapindex, заполнится то, что есть в документе
+type sitemapDoc struct {
+	URLs     []sitemapLoc `xml:"url"`
+	Sitemaps []sitemapLoc `xml:"sitemap"`
+}
+
+// LoadSitesFromSitemap скачивает sitemap.xml и ставит его урлы в очередь вместе
+// с сайтами из файла, который передается в Start. Вложенные sitemapindex
+// раскрываются на один уровень. Запросы идут через общий клиент и лимиты
+func (c *Crawler) LoadSitesFromSitemap(sitemapURL string) error {
+	ctx := context.Background()
+	doc, err := c.fetchSitemap(ctx, sitemapURL)
+	if err != nil {
+		return err
+	}
+
+	locs := doc.URLs
+	var errs *multierror.Error
+	for _, child := range doc.Sitemaps {
+		childDoc, err := c.fetchSitemap(ctx, strings.TrimSpace(child.Loc))
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		locs = append(locs, childDoc.URLs...)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, loc := range locs {
+		if u := strings.TrimSpace(loc.Loc); u != "" {
+			c.queued = append(c.queued, &Site{Url: u, State: "active", Categories: []string{sitemapCategory}})
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) (*sitemapDoc, error) {
+	if err := c.parser.wait(ctx, sitemapURL); err != nil {
+		return nil, err
+	}
+	req, err := c.parser.requestBuilder(ctx, nil, sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.parser.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, &HTTPStatusError{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+	}
+
+	var doc sitemapDoc
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, maxSitemapSize)).Decode(&doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadSitesFromSitemap(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/sitemap_index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/pages.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/nested_index.xml</loc></sitemap>
+  <sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		case "/pages.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/a</loc><lastmod>2024-01-01</lastmod></url>
+  <url><loc> %[1]s/b </loc></url>
+</urlset>`, srv.URL)
+		case "/nested_index.xml":
+			fmt.Fprintf(w, `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%s/too_deep.xml</loc></sitemap>
+</sitemapindex>`, srv.URL)
+		case "/missing.xml":
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, "<html><head><title>ok</title></head></html>")
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.LoadSitesFromSitemap(srv.URL + "/sitemap_index.xml")
+	if err == nil || !strings.Contains(err.Error(), "unexpected status 404") {
+		t.Errorf("expected the missing child sitemap to be reported, got %v", err)
+	}
+
+	var queued []string
+	for _, site := range c.queued {
+		if site.State != "active" || len(site.Categories) != 1 || site.Categories[0] != "default" {
+			t.Errorf("unexpected synthetic site %+v", site)
+		}
+		queued = append(queued, site.Url)
+	}
+	sort.Strings(queued)
+	if expected := []string{srv.URL + "/a", srv.URL + "/b"}; strings.Join(queued, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %v queued, got %v", expected, queued)
+	}
+
+	// урлы из sitemap и из файла идут в один поток и дедуплицируются вместе
+	if err := c.Start(context.Background(), writeSites(t, srv.URL+"/a", srv.URL+"/c")); err != nil {
+		t.Fatal(err)
+	}
+	for path, n := range map[string]int{"/a": 1, "/b": 1, "/c": 1, "/too_deep.xml": 0} {
+		if hits[path] != n {
+			t.Errorf("expected %s to be fetched %d times, got %d", path, n, hits[path])
+		}
+	}
+	if c.duplicateCounter != 1 {
+		t.Errorf("expected 1 duplicate between file and sitemap, got %d", c.duplicateCounter)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// openSource: "-" - stdin, http(s):// - скачать общим клиентом парсера, иначе путь к файлу
+func (c *Crawler) openSource(ctx context.Context, source string) (io.ReadCloser, error) {
+	switch {
+	case source == "-":
+		return io.NopCloser(os.Stdin), nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		req, err := c.parser.requestBuilder(ctx, nil, source)
+		if err != nil {
+			return nil, err
+		}
+		// таймаут клиента считается вместе с чтением тела, а список читается долго
+		client := *c.parser.client
+		client.Timeout = 0
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+			return nil, &HTTPStatusError{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode}
+		}
+		return resp.Body, nil
+	default:
+		return os.Open(source)
+	}
+}
+
+// reportMalformed считает битые строки и отдает их OnMalformedSite или в лог
+func (c *Crawler) reportMalformed(source string) func(line int, err error) {
+	return func(line int, err error) {
+		atomic.AddUint32(&c.malformedCounter, 1)
+		if c.onMalformedSite != nil {
+			c.onMalformedSite(source, line, err)
+		} else {
+			log.Printf("%s:%d: skipping malformed site: %v", source, line, err)
+		}
+	}
+}
+
+// decodeSites читает jsonl построчно, не загружая вход целиком. Битая строка
+// уходит в onMalformed с номером и пропускается, остальные сайты грузятся как обычно
+func (c *Crawler) decodeSites(source string, r io.Reader, onMalformed func(line int, err error)) ([]*Site, error) {
+	var sites []*Site
+	reader := bufio.NewReader(r)
+	for lineNo := 1; ; lineNo++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var site *Site
+			if jErr := json.Unmarshal(line, &site); jErr != nil || site == nil {
+				if jErr == nil {
+					jErr = errors.New("null site")
+				}
+				onMalformed(lineNo, jErr)
+			} else {
+				site.line = lineNo
+				sites = append(sites, site)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return sites, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadSitesSources(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	var lines []string
+	for _, path := range []string{"/a", "/b"} {
+		lines = append(lines, fmt.Sprintf(`{"url": "%s%s", "state": "checked", "categories": ["good_site"]}`, srv.URL, path))
+	}
+	// битые строки пропускаются, пустые просто игнорируются
+	jsonl := lines[0] + "\n{\"url\": broken\n\nnull\n" + lines[1]
+
+	list := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/sites.jsonl" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(jsonl))
+	}))
+	defer list.Close()
+
+	stdinPath := filepath.Join(t.TempDir(), "stdin.jsonl")
+	if err := os.WriteFile(stdinPath, []byte(jsonl), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, source := range map[string]string{"file": stdinPath, "stdin": "-", "url": list.URL + "/sites.jsonl"} {
+		t.Run(name, func(t *testing.T) {
+			if source == "-" {
+				stdin, err := os.Open(stdinPath)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer stdin.Close()
+				orig := os.Stdin
+				os.Stdin = stdin
+				defer func() { os.Stdin = orig }()
+			}
+
+			c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Status: DefaultStatusPolicy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Start(context.Background(), source); err != nil {
+				t.Fatal(err)
+			}
+			if report := c.Report(); report.Total != 2 || report.Succeeded != 2 || report.Malformed != 2 {
+				t.Errorf("unexpected report %+v", report)
+			}
+		})
+	}
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), list.URL+"/missing.jsonl"); err == nil || !strings.Contains(err.Error(), "unexpected status 404") {
+		t.Errorf("expected a status error for a missing list, got %v", err)
+	}
+}
+
+func TestLoadSitesSingleProducer(t *testing.T) {
+	const sites = 50000
+	var sb strings.Builder
+	for i := 0; i < sites; i++ {
+		fmt.Fprintf(&sb, `{"url": "http://site%d.example/", "state": "checked", "categories": ["good_site"]}`+"\n", i)
+		if i%10000 == 0 {
+			sb.WriteString("{broken\n")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var malformed []int
+	onMalformed := func(source string, line int, err error) {
+		malformed = append(malformed, line)
+	}
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy, OnMalformedSite: onMalformed, SitesBuffer: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := runtime.NumGoroutine()
+	sitesChan, err := c.loadSites(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// продюсер и горутина, которая закроет канал
+	if n := runtime.NumGoroutine() - before; n > 2 {
+		t.Errorf("expected at most 2 new goroutines, got %d", n)
+	}
+	if len(malformed) != 5 || malformed[0] != 2 {
+		t.Errorf("unexpected malformed lines %v", malformed)
+	}
+
+	seen := make(map[string]int, sites)
+	for site := range sitesChan {
+		seen[site.Url]++
+		if len(seen)%10000 == 0 {
+			if n := runtime.NumGoroutine() - before; n > 2 {
+				t.Errorf("goroutines grew to %d while draining", n)
+			}
+		}
+	}
+	if len(seen) != sites {
+		t.Errorf("expected %d sites, got %d", sites, len(seen))
+	}
+	for url, n := range seen {
+		if n != 1 {
+			t.Errorf("%s arrived %d times", url, n)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const defaultSQLitePath = "crawl.db"
+
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS results (
+	url TEXT,
+	title TEXT,
+	description TEXT,
+	category TEXT,
+	crawled_at INTEGER
+)`
+
+// sqliteBatch - после стольких строк открытая транзакция коммитится сама
+const sqliteBatch = 100
+
+var errSQLiteClosed = errors.New("sqlite writer is closed")
+
+// sqliteDB - одна база и одно соединение на все категории, писатели
+// разных категорий пишут в общую транзакцию по очереди
+type sqliteDB struct {
+	mu      sync.Mutex
+	path    string
+	db      *sql.DB
+	tx      *sql.Tx
+	stmt    *sql.Stmt
+	pending int
+	refs    int
+}
+
+var (
+	sqliteDBsMu sync.Mutex
+	sqliteDBs   = map[string]*sqliteDB{}
+)
+
+// openSQLiteDB открывает базу при первом писателе и отдает ее же остальным
+func openSQLiteDB(path string) (*sqliteDB, error) {
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+	if sdb, ok := sqliteDBs[path]; ok {
+		sdb.refs++
+		return sdb, nil
+	}
+
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if err := migrateSQLite(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	sdb := &sqliteDB{path: path, db: db, refs: 1}
+	sqliteDBs[path] = sdb
+	return sdb, nil
+}
+
+// migrateSQLite создает таблицу, а в базах старых запусков переименовывает ctime в crawled_at
+func migrateSQLite(db *sql.DB) error {
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		return err
+	}
+	var n int
+	err := db.QueryRow("SELECT count(*) FROM pragma_table_info('results') WHERE name = 'ctime'").Scan(&n)
+	if err != nil || n == 0 {
+		return err
+	}
+	_, err = db.Exec("ALTER TABLE results RENAME COLUMN ctime TO crawled_at")
+	return err
+}
+
+// insert добавляет строку в открытую транзакцию, каждые sqliteBatch строк - коммит
+func (sdb *sqliteDB) insert(rec Record) error {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	if sdb.tx == nil {
+		tx, err := sdb.db.Begin()
+		if err != nil {
+			return err
+		}
+		stmt, err := tx.Prepare("INSERT INTO results (url, title, description, category, crawled_at) VALUES (?, ?, ?, ?, ?)")
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		sdb.tx, sdb.stmt = tx, stmt
+	}
+	if _, err := sdb.stmt.Exec(rec.URL, rec.Title, rec.Description, rec.Category, rec.FetchedAt); err != nil {
+		return err
+	}
+	sdb.pending++
+	if sdb.pending >= sqliteBatch {
+		return sdb.commitLocked()
+	}
+	return nil
+}
+
+func (sdb *sqliteDB) commit() error {
+	sdb.mu.Lock()
+	defer sdb.mu.Unlock()
+	return sdb.commitLocked()
+}
+
+func (sdb *sqliteDB) commitLocked() error {
+	if sdb.tx == nil {
+		return nil
+	}
+	sdb.stmt.Close()
+	err := sdb.tx.Commit()
+	sdb.tx, sdb.stmt, sdb.pending = nil, nil, 0
+	return err
+}
+
+// release коммитит открытую транзакцию, последний писатель закрывает базу
+func (sdb *sqliteDB) release() error {
+	err := sdb.commit()
+
+	sqliteDBsMu.Lock()
+	defer sqliteDBsMu.Unlock()
+	sdb.refs--
+	if sdb.refs > 0 {
+		return err
+	}
+	delete(sqliteDBs, sdb.path)
+	return errors.Join(err, sdb.db.Close())
+}
+
+// SQLiteWriter пишет каждую запись строкой в results общей базы, категории
+// различаются колонкой category. Строки копятся в транзакции и коммитятся
+// каждые sqliteBatch штук, на Flush и на Close. Это RecordWriter, поэтому
+// в tsv/json он не оборачивается
+type SQLiteWriter struct {
+	db       *sqliteDB
+	category string
+	closed   bool
+}
+
+func NewSQLiteWriter(path, category string) (*SQLiteWriter, error) {
+	sdb, err := openSQLiteDB(path)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteWriter{db: sdb, category: category}, nil
+}
+
+func (sw *SQLiteWriter) WriteRecord(rec Record) error {
+	if sw.closed {
+		return errSQLiteClosed
+	}
+	if rec.Category == "" {
+		rec.Category = sw.category
+	}
+	if rec.FetchedAt == 0 {
+		rec.FetchedAt = time.Now().Unix()
+	}
+	return sw.db.insert(rec)
+}
+
+// Write принимает строку tsv, как от TSVWriter: url, title, description
+func (sw *SQLiteWriter) Write(data string) error {
+	columns := strings.SplitN(strings.TrimSuffix(data, "\n"), "\t", 4)
+	for len(columns) < 3 {
+		columns = append(columns, "")
+	}
+	for i, col := range columns {
+		columns[i] = tsvUnescaper.Replace(col)
+	}
+	return sw.WriteRecord(Record{URL: columns[0], Title: columns[1], Description: columns[2]})
+}
+
+func (sw *SQLiteWriter) Flush() error {
+	if sw.closed {
+		return nil
+	}
+	return sw.db.commit()
+}
+
+func (sw *SQLiteWriter) Close() error {
+	if sw.closed {
+		return nil
+	}
+	sw.closed = true
+	return sw.db.release()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWriterRegistry(t *testing.T) {
+	var mu sync.Mutex
+	created := map[string]*memWriter{}
+	RegisterWriterFactory("test-mem", func(category string) (DataWriter, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created[category] = &memWriter{}
+		return created[category], nil
+	})
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, WriterType: "test-mem-json", Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := c.createWriterForCategory("good_site")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := w.(*JSONWriter); !ok || created["good_site"] == nil {
+		t.Errorf("expected json writer over the registered factory, got %#v", w)
+	}
+}
+
+func TestSQLiteWriter(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const sites = 40
+	for i := 0; i < sites; i++ {
+		category := []string{"good_site", "bad_site", "news"}[i%3]
+		fmt.Fprintf(file, `{"url": "%s/%d", "state": "checked", "categories": [%q], "ctime": 1567713280}`+"\n", srv.URL, i, category)
+	}
+	file.Close()
+
+	wd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(wd)
+
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 8, WriterType: "sqlite", Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := sql.Open("sqlite3", defaultSQLitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	rows, err := db.Query("SELECT category, count(*), min(title) FROM results GROUP BY category")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	counts := map[string]int{}
+	for rows.Next() {
+		var category, title string
+		var n int
+		if err := rows.Scan(&category, &n, &title); err != nil {
+			t.Fatal(err)
+		}
+		if title != "ok" {
+			t.Errorf("unexpected title %q for %s", title, category)
+		}
+		counts[category] = n
+	}
+	if counts["good_site"] != 14 || counts["bad_site"] != 13 || counts["news"] != 13 {
+		t.Errorf("unexpected rows per category %v", counts)
+	}
+	if len(sqliteDBs) != 0 {
+		t.Errorf("expected the shared database to be closed, got %v", sqliteDBs)
+	}
+}
+
+func TestSQLiteWriterBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.db")
+	news, err := NewSQLiteWriter(path, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sport, err := NewSQLiteWriter(path, "sport")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	count := func() int {
+		t.Helper()
+		var n int
+		if err := db.QueryRow("SELECT count(*) FROM results").Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	for i := 0; i < 120; i++ {
+		w := news
+		if i%2 == 1 {
+			w = sport
+		}
+		if err := w.WriteRecord(Record{URL: fmt.Sprintf("http://example.com/%d", i), Title: "t", FetchedAt: 1567713280}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// писатели делят транзакцию, 100 строк коммитятся сами
+	if n := count(); n != sqliteBatch {
+		t.Errorf("expected %d committed rows before Flush, got %d", sqliteBatch, n)
+	}
+	if err := news.Write("http://example.com/raw\tmulti\\tline\tdesc\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := news.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 121 {
+		t.Errorf("expected 121 rows after Flush, got %d", n)
+	}
+	var title, description, category string
+	var crawledAt int64
+	err = db.QueryRow("SELECT title, description, category, crawled_at FROM results WHERE url = 'http://example.com/raw'").Scan(&title, &description, &category, &crawledAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "multi\tline" || description != "desc" || category != "news" || time.Since(time.Unix(crawledAt, 0)) > time.Minute {
+		t.Errorf("unexpected raw row %q %q %q %d", title, description, category, crawledAt)
+	}
+
+	sport.WriteRecord(Record{URL: "http://example.com/last"})
+	if err := news.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sport.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 122 {
+		t.Errorf("expected Close to commit, got %d rows", n)
+	}
+	if err := sport.WriteRecord(Record{URL: "http://example.com/late"}); err != errSQLiteClosed {
+		t.Errorf("expected errSQLiteClosed, got %v", err)
+	}
+}
+
+func TestSQLiteMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE results (url TEXT, title TEXT, description TEXT, category TEXT, ctime INTEGER)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO results VALUES ('http://old.example', 'old', '', 'news', 1567713280)"); err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := NewSQLiteWriter(path, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRecord(Record{URL: "http://new.example", FetchedAt: 1700000000}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var sum int64
+	if err := db.QueryRow("SELECT sum(crawled_at) FROM results").Scan(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if sum != 1567713280+1700000000 {
+		t.Errorf("expected both rows in crawled_at, got sum %d", sum)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultMaxRedirects = 10
+
+// RedirectError - цепочка редиректов зациклилась
+type RedirectError struct {
+	URL   string
+	Chain []string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("%s: redirect loop: %s", e.URL, strings.Join(e.Chain, " -> "))
+}
+
+// StatusPolicy решает, что делать с ответом не 200 после всех повторов:
+// коды из ErrorCodes - ошибка сайта, остальные, включая SkipCodes, -
+// тихий пропуск со счетчиком. SkipCodes важнее ErrorCodes.
+// Без FollowRedirects 3xx не раскрываются и тоже идут по этим правилам.
+// MaxRedirects 0 не раскрывает ни одного редиректа, отрицательный значит 10, как в http.Client.
+// Сверх лимита остается последний 3xx ответ со своим Location
+type StatusPolicy struct {
+	FollowRedirects bool
+	MaxRedirects    int
+	SkipCodes       []int
+	ErrorCodes      []int
+}
+
+var DefaultStatusPolicy = StatusPolicy{
+	FollowRedirects: true,
+	MaxRedirects:    defaultMaxRedirects,
+	SkipCodes:       []int{http.StatusNotFound, http.StatusGone},
+	ErrorCodes:      []int{http.StatusInternalServerError, http.StatusServiceUnavailable},
+}
+
+func (sp StatusPolicy) isZero() bool {
+	return !sp.FollowRedirects && sp.MaxRedirects == 0 && len(sp.SkipCodes) == 0 && len(sp.ErrorCodes) == 0
+}
+
+func (sp StatusPolicy) isError(code int) bool {
+	for _, c := range sp.SkipCodes {
+		if c == code {
+			return false
+		}
+	}
+	for _, c := range sp.ErrorCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (sp StatusPolicy) checkRedirect(req *http.Request, via []*http.Request) error {
+	if !sp.FollowRedirects {
+		return http.ErrUseLastResponse
+	}
+	chain := make([]string, 0, len(via)+1)
+	for _, prev := range via {
+		chain = append(chain, prev.URL.String())
+	}
+	chain = append(chain, req.URL.String())
+	for _, prev := range via {
+		if prev.URL.String() == req.URL.String() {
+			return &RedirectError{URL: via[0].URL.String(), Chain: chain}
+		}
+	}
+	max := sp.MaxRedirects
+	if max < 0 {
+		max = defaultMaxRedirects
+	}
+	if len(via) > max {
+		return http.ErrUseLastResponse
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStatusPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	})
+	mux.Handle("/moved", http.RedirectHandler("/ok", http.StatusMovedPermanently))
+	for path, code := range map[string]int{"/missing": 404, "/gone": 410, "/teapot": 418, "/down": 503, "/error": 500} {
+		code := code
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+	}
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	noRedirects := DefaultStatusPolicy
+	noRedirects.FollowRedirects = false
+	skipServerErrors := DefaultStatusPolicy
+	skipServerErrors.SkipCodes = []int{http.StatusServiceUnavailable}
+
+	cases := []struct {
+		name    string
+		policy  StatusPolicy
+		path    string
+		skipped bool
+		failed  bool
+	}{
+		{"ok", DefaultStatusPolicy, "/ok", false, false},
+		{"redirect followed", DefaultStatusPolicy, "/moved", false, false},
+		{"redirect not followed", noRedirects, "/moved", true, false},
+		{"404 skipped", DefaultStatusPolicy, "/missing", true, false},
+		{"410 skipped", DefaultStatusPolicy, "/gone", true, false},
+		{"other codes skipped", DefaultStatusPolicy, "/teapot", true, false},
+		{"503 is an error", DefaultStatusPolicy, "/down", false, true},
+		{"500 is an error", DefaultStatusPolicy, "/error", false, true},
+		{"skip codes win", skipServerErrors, "/down", true, false},
+		{"empty policy skips everything", StatusPolicy{}, "/error", true, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: tc.policy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Start(context.Background(), writeSites(t, srv.URL+tc.path)); err != nil {
+				t.Fatal(err)
+			}
+			if skipped := c.skippedCounter == 1; skipped != tc.skipped {
+				t.Errorf("expected skipped=%v, got %d skipped", tc.skipped, c.skippedCounter)
+			}
+			if failed := c.failedCounter == 1; failed != tc.failed {
+				t.Errorf("expected failed=%v, got %d failed", tc.failed, c.failedCounter)
+			}
+		})
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	target := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>landing</title></head></html>"))
+	}))
+	defer target.Close()
+
+	var loopHits uint32
+	mux := http.NewServeMux()
+	mux.Handle("/elsewhere", http.RedirectHandler(target.URL+"/landing", http.StatusMovedPermanently))
+	mux.HandleFunc("/loop1", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint32(&loopHits, 1)
+		http.Redirect(w, r, "/loop2", http.StatusFound)
+	})
+	mux.Handle("/loop2", http.RedirectHandler("/loop1", http.StatusFound))
+	mux.Handle("/r1", http.RedirectHandler("/r2", http.StatusFound))
+	mux.Handle("/r2", http.RedirectHandler("/r3", http.StatusFound))
+	mux.Handle("/r3", http.RedirectHandler("/elsewhere", http.StatusFound))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	newCrawler := func(maxRedirects int) *Crawler {
+		t.Helper()
+		policy := DefaultStatusPolicy
+		policy.MaxRedirects = maxRedirects
+		retry := DefaultRetryPolicy
+		retry.InitialDelay = time.Millisecond
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Insecure: true, Retry: retry, Status: policy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	t.Run("cross scheme and host", func(t *testing.T) {
+		mw := &memWriter{}
+		writers := newJSONWriters(mw)
+		site := &Site{Url: srv.URL + "/elsewhere", Categories: []string{"good_site"}}
+		if err := newCrawler(-1).checkSite(context.Background(), site, writers); err != nil {
+			t.Fatal(err)
+		}
+		var rec jsonRecord
+		if err := json.Unmarshal([]byte(mw.lines[0]), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec.URL != site.Url || rec.FinalURL != target.URL+"/landing" || rec.Title != "landing" {
+			t.Errorf("unexpected record %+v", rec.Record)
+		}
+	})
+
+	t.Run("loop", func(t *testing.T) {
+		_, err := newCrawler(-1).fetchPage(context.Background(), &Site{Url: srv.URL + "/loop1"})
+		var rErr *RedirectError
+		if !errors.As(err, &rErr) {
+			t.Fatalf("expected redirect loop error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "redirect loop") || len(rErr.Chain) != 3 {
+			t.Errorf("unexpected error %v", err)
+		}
+		if loopHits != 1 {
+			t.Errorf("redirect loop must not be retried, got %d hits", loopHits)
+		}
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		// r1 -> r2 -> r3 -> elsewhere -> landing, на третьем остается 301 с elsewhere
+		_, err := newCrawler(3).fetchPage(context.Background(), &Site{Url: srv.URL + "/r1"})
+		var sErr *HTTPStatusError
+		if !errors.As(err, &sErr) || sErr.StatusCode != http.StatusMovedPermanently || sErr.Location != target.URL+"/landing" {
+			t.Errorf("expected the last 301 after 3 redirects, got %v", err)
+		}
+		if _, err := newCrawler(4).fetchPage(context.Background(), &Site{Url: srv.URL + "/r1"}); err != nil {
+			t.Errorf("4 redirects must be allowed with MaxRedirects 4, got %v", err)
+		}
+	})
+
+	t.Run("none", func(t *testing.T) {
+		_, err := newCrawler(0).fetchPage(context.Background(), &Site{Url: srv.URL + "/r1"})
+		var sErr *HTTPStatusError
+		if !errors.As(err, &sErr) || sErr.StatusCode != http.StatusFound || sErr.Location != srv.URL+"/r2" {
+			t.Errorf("expected the first 302 with MaxRedirects 0, got %v", err)
+		}
+	})
+
+	t.Run("not followed", func(t *testing.T) {
+		c := newCrawler(-1)
+		c.parser.status.FollowRedirects = false
+		c.parser.client = c.parser.newClient(nil)
+		_, err := c.fetchPage(context.Background(), &Site{Url: srv.URL + "/r1"})
+		var sErr *HTTPStatusError
+		if !errors.As(err, &sErr) || sErr.StatusCode != http.StatusFound || sErr.Location != srv.URL+"/r2" {
+			t.Fatalf("expected 302 with the redirect target, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "redirect to "+srv.URL+"/r2") {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
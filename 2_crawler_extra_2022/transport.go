@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TransportPolicy - таймауты по фазам запроса и переиспользование соединений.
+// Нулевой таймаут фазу не ограничивает, остается только общий Timeout
+type TransportPolicy struct {
+	// DialTimeout - на установку TCP соединения, мертвые хосты отваливаются по нему
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout - на TLS рукопожатие после соединения
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout - от отправки запроса до заголовков ответа
+	ResponseHeaderTimeout time.Duration
+	// Timeout - на весь запрос вместе с редиректами и чтением тела
+	Timeout time.Duration
+	// MaxIdleConnsPerHost - сколько простаивающих соединений держать на хост
+	MaxIdleConnsPerHost int
+	// DisableKeepAlives закрывает соединение после каждого запроса, как раньше
+	DisableKeepAlives bool
+}
+
+var DefaultTransportPolicy = TransportPolicy{
+	DialTimeout:           5 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ResponseHeaderTimeout: 10 * time.Second,
+	Timeout:               30 * time.Second,
+	MaxIdleConnsPerHost:   4,
+}
+
+// newTransport с dns != nil разрешает имена через кэш
+func (tp TransportPolicy) newTransport(dns *dnsCache) *http.Transport {
+	dialer := &net.Dialer{Timeout: tp.DialTimeout, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if dns != nil {
+		dial = dns.dialContext(dialer)
+	}
+	return &http.Transport{
+		DialContext:           dial,
+		TLSHandshakeTimeout:   tp.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: tp.ResponseHeaderTimeout,
+		MaxIdleConnsPerHost:   tp.MaxIdleConnsPerHost,
+		IdleConnTimeout:       90 * time.Second,
+		DisableKeepAlives:     tp.DisableKeepAlives,
+	}
+}
+
+// timeoutPhase - на какой фазе запроса истек таймаут, "" если это не таймаут.
+// Транспорт не экспортирует типы своих ошибок, поэтому заголовки и TLS
+// узнаются по тексту
+func timeoutPhase(err error) string {
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		return ""
+	}
+	var opErr *net.OpError
+	var parseErr *ParseError
+	msg := err.Error()
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "connect"
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return "tls"
+	case strings.Contains(msg, "awaiting response headers"), strings.Contains(msg, "awaiting headers"):
+		return "headers"
+	case errors.As(err, &parseErr), strings.Contains(msg, "reading body"):
+		return "body"
+	default:
+		return ""
+	}
+}
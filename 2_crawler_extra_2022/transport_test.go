@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// dialTimeout - net.Error, как от net.Dialer по истечении DialTimeout
+type dialTimeout struct{}
+
+func (dialTimeout) Error() string   { return "i/o timeout" }
+func (dialTimeout) Timeout() bool   { return true }
+func (dialTimeout) Temporary() bool { return true }
+
+func TestTimeoutPhases(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow-headers", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(300 * time.Millisecond)
+	})
+	mux.HandleFunc("/slow-body", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>partial"))
+		w.(http.Flusher).Flush()
+		time.Sleep(300 * time.Millisecond)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// принимает соединения и молчит, TLS рукопожатие не завершится
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	cases := []struct {
+		name   string
+		policy TransportPolicy
+		url    string
+		class  string
+	}{
+		{"headers", TransportPolicy{ResponseHeaderTimeout: 50 * time.Millisecond, Timeout: time.Second}, srv.URL + "/slow-headers", "timeout_headers"},
+		{"overall before headers", TransportPolicy{Timeout: 50 * time.Millisecond}, srv.URL + "/slow-headers", "timeout_headers"},
+		{"body", TransportPolicy{ResponseHeaderTimeout: time.Second, Timeout: 100 * time.Millisecond}, srv.URL + "/slow-body", "timeout_body"},
+		{"tls", TransportPolicy{TLSHandshakeTimeout: 50 * time.Millisecond, Timeout: time.Second}, "https://" + silent.Addr().String() + "/", "timeout_tls"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewCrawler(Options{Transport: tc.policy, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = c.fetchPage(context.Background(), &Site{Url: tc.url})
+			if class := classifyError(err); class != tc.class {
+				t.Errorf("expected %s, got %s for %v", tc.class, class, err)
+			}
+		})
+	}
+
+	connect := &net.OpError{Op: "dial", Net: "tcp", Err: dialTimeout{}}
+	if class := classifyError(connect); class != "timeout_connect" {
+		t.Errorf("expected timeout_connect, got %s", class)
+	}
+	if class := classifyError(context.DeadlineExceeded); class != "timeout" {
+		t.Errorf("a timeout of unknown phase must stay timeout, got %s", class)
+	}
+}
+
+func TestKeepAlive(t *testing.T) {
+	var conns uint32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddUint32(&conns, 1)
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	for _, disable := range []bool{false, true} {
+		atomic.StoreUint32(&conns, 0)
+		policy := DefaultTransportPolicy
+		policy.DisableKeepAlives = disable
+		c, err := NewCrawler(Options{Transport: policy, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 5; i++ {
+			if _, err := c.fetchPage(context.Background(), &Site{Url: srv.URL}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected := uint32(1)
+		if disable {
+			expected = 5
+		}
+		if n := atomic.LoadUint32(&conns); n != expected {
+			t.Errorf("DisableKeepAlives=%v: expected %d connections, got %d", disable, expected, n)
+		}
+	}
+}
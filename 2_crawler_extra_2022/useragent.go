@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// userAgentPicker выбирает User-Agent на каждый запрос случайно из списка
+type userAgentPicker struct {
+	mu     sync.Mutex
+	agents []string
+	rnd    *rand.Rand
+}
+
+func newUserAgentPicker(agents []string) *userAgentPicker {
+	if len(agents) == 0 {
+		agents = []string{defaultUserAgent}
+	}
+	return &userAgentPicker{
+		agents: append([]string(nil), agents...),
+		rnd:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (uap *userAgentPicker) pick() string {
+	if len(uap.agents) == 1 {
+		return uap.agents[0]
+	}
+	uap.mu.Lock()
+	defer uap.mu.Unlock()
+	return uap.agents[uap.rnd.Intn(len(uap.agents))]
+}
+
+// SeedUserAgents делает выбор User-Agent воспроизводимым, например для тестов
+func (c *Crawler) SeedUserAgents(seed int64) {
+	c.parser.agents.mu.Lock()
+	defer c.parser.agents.mu.Unlock()
+	c.parser.agents.rnd = rand.New(rand.NewSource(seed))
+}
+
+func (c *Crawler) countUserAgent(agent string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.userAgentStats == nil {
+		c.userAgentStats = make(map[string]uint32)
+	}
+	c.userAgentStats[agent]++
+}
+
+// UserAgentCounts - сколько запросов ушло с каждым User-Agent
+func (c *Crawler) UserAgentCounts() map[string]uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]uint32, len(c.userAgentStats))
+	for agent, n := range c.userAgentStats {
+		counts[agent] = n
+	}
+	return counts
+}
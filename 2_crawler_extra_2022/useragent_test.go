@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUserAgentRotation(t *testing.T) {
+	var mu sync.Mutex
+	seen := map[string]uint32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen[r.UserAgent()]++
+		mu.Unlock()
+		w.Write([]byte("<html><head><title>ok</title></head></html>"))
+	}))
+	defer srv.Close()
+
+	agents := []string{"agent-a", "agent-b", "agent-c"}
+	run := func(seed int64) map[string]uint32 {
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, UserAgents: agents, Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.SeedUserAgents(seed)
+		for i := 0; i < 300; i++ {
+			if _, err := c.fetchPage(context.Background(), &Site{Url: srv.URL}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return c.UserAgentCounts()
+	}
+
+	stats := run(42)
+	for _, agent := range agents {
+		if stats[agent] < 60 || stats[agent] != seen[agent] {
+			t.Errorf("unexpected distribution %v, server saw %v", stats, seen)
+		}
+	}
+	again := run(42)
+	for _, agent := range agents {
+		if again[agent] != stats[agent] {
+			t.Errorf("same seed gave %v and %v", stats, again)
+		}
+	}
+}
+
+func TestUserAgentFallback(t *testing.T) {
+	c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 1, Status: DefaultStatusPolicy})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := c.parser.requestBuilder(context.Background(), nil, "http://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ua := req.Header.Get("User-Agent"); ua != defaultUserAgent || c.UserAgentCounts()[defaultUserAgent] != 1 {
+		t.Errorf("expected the default user agent, got %q and %v", ua, c.UserAgentCounts())
+	}
+}
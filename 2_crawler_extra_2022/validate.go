@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"sync/atomic"
+)
+
+// KnownSiteStates - значения Site.State, которые встречаются во входных файлах
+// и у сайтов из sitemap, main проверяет по ним Options.KnownStates
+var KnownSiteStates = []string{"checked", "checking", "active"}
+
+// ValidationIssue - одна проблема во входном файле, Line считается с 1
+type ValidationIssue struct {
+	Line   int    `json:"line"`
+	URL    string `json:"url,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError возвращает Start в режиме DryRun, если во входе есть проблемы
+type ValidationError struct {
+	Issues []ValidationIssue
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%d invalid sites", len(e.Issues))
+}
+
+// siteProblems - все причины, по которым сайт нельзя обходить. Состояние
+// проверяется, только если задан KnownStates
+func (c *Crawler) siteProblems(site *Site) []string {
+	var problems []string
+	u, err := url.Parse(site.Url)
+	switch {
+	case site.Url == "":
+		problems = append(problems, "empty url")
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("unparseable url: %v", err))
+	case u.Scheme != "http" && u.Scheme != "https":
+		problems = append(problems, fmt.Sprintf("url scheme %q is not http(s)", u.Scheme))
+	case u.Host == "":
+		problems = append(problems, "url has no host")
+	}
+	if len(site.Categories) == 0 {
+		problems = append(problems, "no categories")
+	}
+	if len(c.knownStates) > 0 && !contains(c.knownStates, site.State) {
+		problems = append(problems, fmt.Sprintf("unknown state %q", site.State))
+	}
+	return problems
+}
+
+// Validate читает source и проверяет каждый сайт, ничего не скачивая, кроме
+// самого списка, если он задан url'ом. Битый json тоже попадает в проблемы
+func (c *Crawler) Validate(ctx context.Context, source string) ([]ValidationIssue, error) {
+	r, err := c.openSource(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var issues []ValidationIssue
+	sites, err := c.decodeSites(source, r, func(line int, err error) {
+		issues = append(issues, ValidationIssue{Line: line, Reason: fmt.Sprintf("malformed json: %v", err)})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, site := range sites {
+		for _, problem := range c.siteProblems(site) {
+			issues = append(issues, ValidationIssue{Line: site.line, URL: site.Url, Reason: problem})
+		}
+	}
+	sortIssues(issues)
+	return issues, nil
+}
+
+func sortIssues(issues []ValidationIssue) {
+	// битые строки добавлены раньше остальных, а в отчете нужен порядок файла
+	for i := 1; i < len(issues); i++ {
+		for j := i; j > 0 && issues[j].Line < issues[j-1].Line; j-- {
+			issues[j], issues[j-1] = issues[j-1], issues[j]
+		}
+	}
+}
+
+func writeValidationReport(w io.Writer, source string, issues []ValidationIssue) {
+	for _, issue := range issues {
+		fmt.Fprintf(w, "%s:%d\t%s\t%s\n", source, issue.Line, issue.URL, issue.Reason)
+	}
+	fmt.Fprintf(w, "%d problems found\n", len(issues))
+}
+
+// dropInvalid в обычном режиме пропускает сайты, которые иначе упали бы на
+// http.NewRequest с невнятной ошибкой
+func (c *Crawler) dropInvalid(source string, sites []*Site) []*Site {
+	valid := sites[:0]
+	for _, site := range sites {
+		if problems := c.siteProblems(site); len(problems) > 0 {
+			atomic.AddUint32(&c.invalidCounter, 1)
+			log.Printf("%s:%d: skipping invalid site %q: %s", source, site.line, site.Url, problems[0])
+			continue
+		}
+		valid = append(valid, site)
+	}
+	return valid
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateSites(t *testing.T) {
+	var hits uint32
+	srv := newCountingServer(t, &hits)
+	lines := []string{
+		fmt.Sprintf(`{"url": "%s/ok", "state": "checked", "categories": ["good_site"]}`, srv.URL),
+		`{"url": "example.com/no-scheme", "state": "checked", "categories": ["good_site"]}`,
+		`{"url": "ftp://example.com/", "state": "checking", "categories": ["good_site"]}`,
+		`not json`,
+		fmt.Sprintf(`{"url": "%s/bare", "state": "deleted", "categories": []}`, srv.URL),
+		`{"url": "http://", "state": "checked", "categories": ["good_site"]}`,
+	}
+	path := filepath.Join(t.TempDir(), "sites.jsonl")
+	var data string
+	for _, line := range lines {
+		data += line + "\n"
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	newCrawler := func(dryRun bool) *Crawler {
+		c, err := NewCrawler(Options{Transport: TransportPolicy{Timeout: time.Second}, RPS: 1000, Workers: 2, WriterType: "console", KnownStates: KnownSiteStates, DryRun: dryRun, Status: DefaultStatusPolicy})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := newCrawler(true)
+	err := c.Start(context.Background(), path)
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	var got []string
+	for _, issue := range vErr.Issues {
+		got = append(got, fmt.Sprintf("%d %s", issue.Line, issue.Reason))
+	}
+	want := []string{
+		`2 url scheme "" is not http(s)`,
+		`3 url scheme "ftp" is not http(s)`,
+		`4 malformed json: invalid character 'o' in literal null (expecting 'u')`,
+		`5 no categories`,
+		`5 unknown state "deleted"`,
+		`6 url has no host`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected issues:\n got %q\nwant %q", got, want)
+	}
+	if n := atomic.LoadUint32(&hits); n != 0 {
+		t.Errorf("dry run must not fetch sites, got %d requests", n)
+	}
+
+	// в обычном режиме невалидные сайты пропускаются со счетчиком
+	c = newCrawler(false)
+	if err := c.Start(context.Background(), path); err != nil {
+		t.Fatal(err)
+	}
+	report := c.Report()
+	if report.Invalid != 4 || report.Malformed != 1 || report.Succeeded != 1 || report.Failed != 0 {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if n := atomic.LoadUint32(&hits); n != 1 {
+		t.Errorf("expected only the valid site to be fetched, got %d requests", n)
+	}
+}
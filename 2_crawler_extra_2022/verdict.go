@@ -0,0 +1,48 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	VerdictOK            = "ok"
+	VerdictNoindex       = "noindex"
+	VerdictBlockedRobots = "blocked_robots"
+	// VerdictSlowHost - Crawl-delay хоста больше MaxCrawlDelay, сайт не качали
+	VerdictSlowHost = "skipped_slow_host"
+)
+
+// siteVerdict сводит все сигналы по сайту в одно значение "можно ли им пользоваться".
+// Порядок важен, побеждает первый подошедший:
+//  1. robots.txt запретил обход - blocked_robots, страницу мы даже не качали
+//  2. ошибка загрузки или разбора - error_<класс из classifyError>, например
+//     error_dns, error_tls, error_timeout_connect, error_http_4xx, error_http_5xx
+//  3. meta robots noindex - noindex
+//  4. иначе ok
+//
+// Детектора припаркованных доменов и квот в краулере нет, поэтому parked и
+// skipped_quota не выдаются
+func siteVerdict(err error, robots string) string {
+	var robotsErr *RobotsDisallowedError
+	switch {
+	case errors.As(err, &robotsErr):
+		return VerdictBlockedRobots
+	case err != nil:
+		return "error_" + classifyError(err)
+	case strings.Contains(robots, "noindex"):
+		return VerdictNoindex
+	default:
+		return VerdictOK
+	}
+}
+
+// recordVerdict считает вердикты по сайтам для отчета, один сайт - один вердикт
+func (c *Crawler) recordVerdict(verdict string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.verdicts == nil {
+		c.verdicts = make(map[string]int)
+	}
+	c.verdicts[verdict]++
+}
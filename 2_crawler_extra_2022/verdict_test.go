@@ -0,0 +1,29 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSiteVerdict(t *testing.T) {
+	cases := []struct {
+		err     error
+		robots  string
+		verdict string
+	}{
+		{nil, "", "ok"},
+		{nil, "index, nofollow", "ok"},
+		{nil, "noindex, nofollow", "noindex"},
+		{&RobotsDisallowedError{URL: "http://a"}, "", "blocked_robots"},
+		// ошибка важнее noindex, а robots.txt важнее любой ошибки
+		{&HTTPStatusError{URL: "http://a", StatusCode: 503}, "noindex", "error_http_5xx"},
+		{&HTTPStatusError{URL: "http://a", StatusCode: 404}, "", "error_http_4xx"},
+		{&ParseError{URL: "http://a", Err: errors.New("bad")}, "noindex", "error_parse"},
+		{errors.Join(&RobotsDisallowedError{URL: "http://a"}, &HTTPStatusError{URL: "http://a", StatusCode: 500}), "", "blocked_robots"},
+	}
+	for _, tc := range cases {
+		if got := siteVerdict(tc.err, tc.robots); got != tc.verdict {
+			t.Errorf("%v, %q: expected verdict %q, got %q", tc.err, tc.robots, tc.verdict, got)
+		}
+	}
+}
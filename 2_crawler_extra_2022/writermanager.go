@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	defaultFlushInterval = 5 * time.Second
+	defaultFlushLines    = 1000
+)
+
+var errWriterManagerClosed = errors.New("writer manager is closed")
+
+// WriterManager владеет writer'ами по категориям: создает их при первой записи,
+// пишет под своим мьютексом и сбрасывает буферы раз в interval и каждые
+// flushLines строк категории, чтобы при падении терялось не больше этого
+type WriterManager struct {
+	create     func(category string) (RecordWriter, error)
+	flushLines int
+
+	mu      sync.Mutex
+	writers map[string]RecordWriter
+	pending map[string]int
+	closed  bool
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// NewWriterManager с interval <= 0 не сбрасывает по таймеру, с flushLines <= 0 - по строкам
+func NewWriterManager(create func(category string) (RecordWriter, error), interval time.Duration, flushLines int) *WriterManager {
+	wm := &WriterManager{
+		create:     create,
+		flushLines: flushLines,
+		writers:    make(map[string]RecordWriter),
+		pending:    make(map[string]int),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	if interval <= 0 {
+		close(wm.done)
+		return wm
+	}
+	go func() {
+		defer close(wm.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := wm.Flush(); err != nil {
+					log.Printf("flush writers: %v", err)
+				}
+			case <-wm.stop:
+				return
+			}
+		}
+	}()
+	return wm
+}
+
+// WriteRecord пишет rec в writer категории rec.Category
+func (wm *WriterManager) WriteRecord(rec Record) error {
+	return wm.WriteRecordCtx(context.Background(), rec)
+}
+
+// WriteRecordCtx - WriteRecord, который бросает запись, если ctx отменили,
+// пока она ждала мьютекс или очередь writer'а
+func (wm *WriterManager) WriteRecordCtx(ctx context.Context, rec Record) error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	if wm.closed {
+		return errWriterManagerClosed
+	}
+	w, ok := wm.writers[rec.Category]
+	if !ok {
+		var err error
+		if w, err = wm.create(rec.Category); err != nil {
+			return err
+		}
+		wm.writers[rec.Category] = w
+	}
+	if err := writeRecordCtx(ctx, w, rec); err != nil {
+		return err
+	}
+	wm.pending[rec.Category]++
+	if wm.flushLines > 0 && wm.pending[rec.Category] >= wm.flushLines {
+		wm.pending[rec.Category] = 0
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush сбрасывает буферы всех writer'ов, ошибки собираются в одну
+func (wm *WriterManager) Flush() error {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	var errs *multierror.Error
+	for category, w := range wm.writers {
+		if err := w.Flush(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		wm.pending[category] = 0
+	}
+	return errs.ErrorOrNil()
+}
+
+// Close останавливает таймер, сбрасывает и закрывает каждый writer.
+// Ошибка одного не мешает закрыть остальные, повторный Close ничего не делает
+func (wm *WriterManager) Close() error {
+	wm.mu.Lock()
+	if wm.closed {
+		wm.mu.Unlock()
+		return nil
+	}
+	wm.closed = true
+	close(wm.stop)
+	wm.mu.Unlock()
+	<-wm.done
+
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+	var errs *multierror.Error
+	for _, w := range wm.writers {
+		if err := w.Flush(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+		if err := w.Close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs.ErrorOrNil()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newJSONWriters пишет все категории в один memWriter и сам ничего не сбрасывает
+func newJSONWriters(mw *memWriter) *WriterManager {
+	return NewWriterManager(func(string) (RecordWriter, error) {
+		return NewJSONWriter(mw), nil
+	}, 0, 0)
+}
+
+// lockedWriter - memWriter под мьютексом, тикер сбрасывает его из своей горутины
+type lockedWriter struct {
+	mu sync.Mutex
+	memWriter
+	flushErr error
+}
+
+func (lw *lockedWriter) Write(data string) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.memWriter.Write(data)
+}
+
+func (lw *lockedWriter) Flush() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	lw.memWriter.Flush()
+	return lw.flushErr
+}
+
+func (lw *lockedWriter) counts() (lines, flushes int, closed bool) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return len(lw.lines), lw.flushes, lw.closed
+}
+
+func TestWriterManager(t *testing.T) {
+	newManager := func(interval time.Duration, flushLines int) (*WriterManager, map[string]*lockedWriter) {
+		created := make(map[string]*lockedWriter)
+		wm := NewWriterManager(func(category string) (RecordWriter, error) {
+			if category == "broken" {
+				return nil, errors.New("cannot create writer")
+			}
+			created[category] = &lockedWriter{}
+			return NewTSVWriter(created[category]), nil
+		}, interval, flushLines)
+		return wm, created
+	}
+
+	t.Run("flush every n lines", func(t *testing.T) {
+		wm, created := newManager(0, 3)
+		for i := 0; i < 7; i++ {
+			if err := wm.WriteRecord(Record{URL: "http://example.com", Category: "good_site"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := wm.WriteRecord(Record{Category: "other"}); err != nil {
+			t.Fatal(err)
+		}
+		if lines, flushes, _ := created["good_site"].counts(); lines != 7 || flushes != 2 {
+			t.Errorf("expected 7 lines and 2 flushes, got %d and %d", lines, flushes)
+		}
+		if _, flushes, _ := created["other"].counts(); flushes != 0 {
+			t.Errorf("lines are counted per category, got %d flushes", flushes)
+		}
+		if err := wm.WriteRecord(Record{Category: "broken"}); err == nil {
+			t.Errorf("expected writer creation error")
+		}
+		if err := wm.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("periodic flush", func(t *testing.T) {
+		wm, created := newManager(10*time.Millisecond, 0)
+		if err := wm.WriteRecord(Record{Category: "good_site"}); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(time.Second)
+		for {
+			if _, flushes, _ := created["good_site"].counts(); flushes > 0 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("writer was not flushed by the ticker")
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if err := wm.Close(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		wm, created := newManager(time.Hour, 0)
+		for _, category := range []string{"a", "b", "c"} {
+			if err := wm.WriteRecord(Record{Category: category}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		created["a"].flushErr = errors.New("disk full")
+		created["b"].flushErr = errors.New("disk gone")
+
+		err := wm.Close()
+		if err == nil || !strings.Contains(err.Error(), "disk full") || !strings.Contains(err.Error(), "disk gone") {
+			t.Errorf("expected both flush errors, got %v", err)
+		}
+		for category, w := range created {
+			if _, flushes, closed := w.counts(); flushes != 1 || !closed {
+				t.Errorf("%s: expected flush before close, got %d flushes, closed=%v", category, flushes, closed)
+			}
+		}
+		if err := wm.WriteRecord(Record{Category: "a"}); !errors.Is(err, errWriterManagerClosed) {
+			t.Errorf("expected errWriterManagerClosed, got %v", err)
+		}
+		if err := wm.Close(); err != nil {
+			t.Errorf("second Close must be a no-op, got %v", err)
+		}
+	})
+}
+
+func TestFileWriterCloseFlushes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "good_site.tsv")
+	w, err := NewFileWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write("http://example.com\tok\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "http://example.com\tok\n" {
+		t.Errorf("expected the buffered line in the file, got %q", data)
+	}
+}
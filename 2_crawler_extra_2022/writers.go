@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// WriterFactory создает DataWriter для одной категории
+type WriterFactory func(category string) (DataWriter, error)
+
+// fileWriterTypes - встроенные типы, которые пишут в файл по категории. Их
+// фабрики получают не саму категорию, а путь к файлу без расширения из
+// categoryFiles, с OutputDir и безопасным именем
+var fileWriterTypes = map[string]bool{"file": true, "file-json": true, "gzip": true, "gzip-json": true, "csv": true}
+
+var (
+	writerFactoriesMu sync.RWMutex
+	writerFactories   = map[string]WriterFactory{
+		"console": func(string) (DataWriter, error) {
+			return NewConsoleWriter()
+		},
+		"file": func(path string) (DataWriter, error) {
+			return NewFileWriter(fmt.Sprintf("%s.tsv", path))
+		},
+		"file-json": func(path string) (DataWriter, error) {
+			return NewFileWriter(fmt.Sprintf("%s.jsonl", path))
+		},
+		"gzip": func(path string) (DataWriter, error) {
+			return NewGzipFileWriter(fmt.Sprintf("%s.tsv.gz", path))
+		},
+		"gzip-json": func(path string) (DataWriter, error) {
+			return NewGzipFileWriter(fmt.Sprintf("%s.jsonl.gz", path))
+		},
+		"csv": func(path string) (DataWriter, error) {
+			return NewCSVWriter(fmt.Sprintf("%s.csv", path))
+		},
+		"sqlite": func(category string) (DataWriter, error) {
+			return NewSQLiteWriter(defaultSQLitePath, category)
+		},
+	}
+)
+
+// RegisterWriterFactory добавляет или заменяет writerType для NewCrawler.
+// Суффикс -json в writerType по-прежнему переключает выдачу на jsonl, поэтому
+// фабрику можно зарегистрировать и под именем с суффиксом, и без него.
+// Зарегистрированная фабрика всегда получает категорию как есть
+func RegisterWriterFactory(name string, factory func(category string) (DataWriter, error)) {
+	writerFactoriesMu.Lock()
+	defer writerFactoriesMu.Unlock()
+	writerFactories[name] = factory
+	delete(fileWriterTypes, name)
+}
+
+// writerFactory ищет сначала полное имя, потом без -json, незнакомые типы пишут
+// в консоль. file - фабрике нужен путь из categoryFiles, а не категория
+func writerFactory(writerType, kind string) (factory WriterFactory, file bool) {
+	writerFactoriesMu.RLock()
+	defer writerFactoriesMu.RUnlock()
+	if factory, ok := writerFactories[writerType]; ok {
+		return factory, fileWriterTypes[writerType]
+	}
+	if factory, ok := writerFactories[kind]; ok {
+		return factory, fileWriterTypes[kind]
+	}
+	return writerFactories["console"], false
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+var ErrBudgetExhausted = errors.New("submitter time budget is exhausted")
+
+// Budgets ограничивает суммарное время выполнения задач одного отправителя
+// за скользящее окно. Задача засчитывается, когда заканчивается, так что
+// запущенные до исчерпания дорабатывают и могут выйти за лимит
+type Budgets struct {
+	Clock Clock
+
+	mu     sync.Mutex
+	limit  time.Duration
+	window time.Duration
+	spent  map[string][]budgetCharge
+}
+
+type budgetCharge struct {
+	at       time.Time
+	duration time.Duration
+}
+
+// BudgetUsage - потраченное отправителем за текущее окно для PoolStats
+type BudgetUsage struct {
+	Submitter string        `json:"submitter"`
+	Used      time.Duration `json:"used"`
+	Limit     time.Duration `json:"limit"`
+	Window    time.Duration `json:"window"`
+}
+
+func NewBudgets(limit, window time.Duration) *Budgets {
+	return &Budgets{limit: limit, window: window, spent: make(map[string][]budgetCharge)}
+}
+
+// Set меняет лимит и окно на лету, уже потраченное пересчитывается по новому окну.
+// limit 0 - без лимита
+func (b *Budgets) Set(limit, window time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.limit, b.window = limit, window
+}
+
+func (b *Budgets) now() time.Time {
+	if b.Clock == nil {
+		return time.Now()
+	}
+	return b.Clock.Now()
+}
+
+// usedLocked выкидывает вышедшее из окна и возвращает остальное
+func (b *Budgets) usedLocked(submitter string, now time.Time) time.Duration {
+	charges := b.spent[submitter]
+	for len(charges) > 0 && now.Sub(charges[0].at) >= b.window {
+		charges = charges[1:]
+	}
+	if len(charges) == 0 {
+		delete(b.spent, submitter)
+		return 0
+	}
+	b.spent[submitter] = charges
+	var used time.Duration
+	for _, c := range charges {
+		used += c.duration
+	}
+	return used
+}
+
+func (b *Budgets) allow(submitter string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.limit > 0 && b.usedLocked(submitter, b.now()) >= b.limit {
+		return fmt.Errorf("%s: %w", submitter, ErrBudgetExhausted)
+	}
+	return nil
+}
+
+func (b *Budgets) charge(submitter string, duration time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent[submitter] = append(b.spent[submitter], budgetCharge{at: b.now(), duration: duration})
+}
+
+func (b *Budgets) usage() []BudgetUsage {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	var list []BudgetUsage
+	for submitter := range b.spent {
+		if used := b.usedLocked(submitter, now); used > 0 {
+			list = append(list, BudgetUsage{Submitter: submitter, Used: used, Limit: b.limit, Window: b.window})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Submitter < list[j].Submitter })
+	return list
+}
+
+// retryIn - через сколько submitter снова уложится в лимит, 0 если уже укладывается
+func (b *Budgets) retryIn(submitter string) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.now()
+	used := b.usedLocked(submitter, now)
+	if b.limit <= 0 || used < b.limit {
+		return 0
+	}
+	for _, c := range b.spent[submitter] {
+		used -= c.duration
+		if used < b.limit {
+			return c.at.Add(b.window).Sub(now)
+		}
+	}
+	return 0
+}
+
+// budgeted - task, время которого засчитывается submitter, или ErrBudgetExhausted,
+// если тот уже выбрал лимит. Без Budgets task отдается как есть
+func (wp *WorkerPool) budgeted(submitter string, task func()) (func(), error) {
+	budgets := wp.Budgets
+	if budgets == nil {
+		return task, nil
+	}
+	if err := budgets.allow(submitter); err != nil {
+		return nil, err
+	}
+	return func() {
+		start := budgets.now()
+		defer func() { budgets.charge(submitter, budgets.now().Sub(start)) }()
+		task()
+	}, nil
+}
+
+// SubmitAs - Submit от имени submitter: если задан Budgets и отправитель
+// выбрал лимит за окно, задача не принимается с ErrBudgetExhausted.
+// Без Budgets это просто Submit
+func (wp *WorkerPool) SubmitAs(ctx context.Context, submitter, name string, task func()) error {
+	task, err := wp.budgeted(submitter, task)
+	if err != nil {
+		return err
+	}
+	return wp.submit(ctx, poolTask{name: name, fn: task})
+}
+
+// SubmitAndWaitAs - SubmitAndWait от имени submitter с теми же Budgets, что у SubmitAs
+func (wp *WorkerPool) SubmitAndWaitAs(ctx context.Context, submitter, name string, task func()) error {
+	task, err := wp.budgeted(submitter, task)
+	if err != nil {
+		return err
+	}
+	return wp.SubmitAndWait(ctx, name, task)
+}
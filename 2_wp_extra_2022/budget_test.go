@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBudgets(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	wp := NewWorkerPool(1)
+	wp.Budgets = NewBudgets(time.Minute, time.Hour)
+	wp.Budgets.Clock = clock
+	wp.StartWorker()
+	defer wp.Down()
+
+	// задача "выполняется" столько, на сколько двигает часы
+	run := func(submitter string, d time.Duration) error {
+		done := make(chan struct{})
+		err := wp.SubmitAs(context.Background(), submitter, "work", func() {
+			defer close(done)
+			clock.Advance(d)
+		})
+		if err == nil {
+			<-done
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := run("a", 40*time.Second); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := run("a", time.Second); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted over the budget, got %v", err)
+	}
+	if err := run("b", 10*time.Second); err != nil {
+		t.Errorf("other submitter must not be affected, got %v", err)
+	}
+	expected := []BudgetUsage{
+		{Submitter: "a", Used: 80 * time.Second, Limit: time.Minute, Window: time.Hour},
+		{Submitter: "b", Used: 10 * time.Second, Limit: time.Minute, Window: time.Hour},
+	}
+	if got := wp.Stats().Budgets; len(got) != 2 || got[0] != expected[0] || got[1] != expected[1] {
+		t.Errorf("expected usage %+v, got %+v", expected, got)
+	}
+
+	// первая задача "a" уходит из окна, остается 40 с из 60
+	clock.Advance(time.Hour - 50*time.Second)
+	if err := run("a", 30*time.Second); err != nil {
+		t.Errorf("expected recovery after the window slides, got %v", err)
+	}
+	if err := run("a", time.Second); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted again, got %v", err)
+	}
+
+	// лимит меняется на лету
+	wp.Budgets.Set(2*time.Minute, time.Hour)
+	if err := run("a", time.Second); err != nil {
+		t.Errorf("expected a raised budget to accept, got %v", err)
+	}
+}
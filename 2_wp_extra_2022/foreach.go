@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotStarted - элемент не успели отдать воркеру до отмены ctx
+var ErrNotStarted = errors.New("item not started")
+
+// ForEach прогоняет fn по items через воркеров пула, одновременно работает
+// не больше воркеров, чем сейчас в пуле. errs[i] - результат items[i].
+// После отмены ctx новые элементы не раздаются и получают ErrNotStarted,
+// а уже запущенные дорабатывают с отмененным ctx
+func ForEach[T any](ctx context.Context, pool *WorkerPool, items []T, fn func(ctx context.Context, item T) error) []error {
+	errs := make([]error, len(items))
+	for i := range errs {
+		errs[i] = ErrNotStarted
+	}
+
+	var wg sync.WaitGroup
+	for i, item := range items {
+		i, item := i, item
+		wg.Add(1)
+		err := pool.Submit(ctx, func() {
+			defer wg.Done()
+			errs[i] = fn(ctx, item)
+		})
+		if err != nil {
+			wg.Done()
+			break
+		}
+	}
+	wg.Wait()
+	return errs
+}
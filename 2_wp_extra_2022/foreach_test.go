@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func startedPool(t *testing.T, workers int) *WorkerPool {
+	t.Helper()
+	wp := NewWorkerPool(int32(workers))
+	for i := 0; i < workers; i++ {
+		wp.StartWorker()
+	}
+	t.Cleanup(wp.Down)
+	return wp
+}
+
+func TestForEach(t *testing.T) {
+	const workers = 3
+	items := make([]int, 30)
+	for i := range items {
+		items[i] = i
+	}
+
+	t.Run("all succeed within the limit", func(t *testing.T) {
+		var inFlight, maxInFlight, done int32
+		errs := ForEach(context.Background(), startedPool(t, workers), items, func(ctx context.Context, item int) error {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&done, 1)
+			return nil
+		})
+		for i, err := range errs {
+			if err != nil {
+				t.Errorf("item %d: %v", i, err)
+			}
+		}
+		if done != int32(len(items)) || maxInFlight > workers {
+			t.Errorf("expected %d items with at most %d at a time, got %d with %d", len(items), workers, done, maxInFlight)
+		}
+	})
+
+	t.Run("errors keep their index", func(t *testing.T) {
+		errs := ForEach(context.Background(), startedPool(t, workers), items, func(ctx context.Context, item int) error {
+			if item%4 == 0 {
+				return fmt.Errorf("item %d", item)
+			}
+			return nil
+		})
+		for i, err := range errs {
+			if i%4 == 0 && (err == nil || err.Error() != fmt.Sprintf("item %d", i)) {
+				t.Errorf("expected an error for item %d, got %v", i, err)
+			}
+			if i%4 != 0 && err != nil {
+				t.Errorf("unexpected error for item %d: %v", i, err)
+			}
+		}
+	})
+
+	t.Run("cancellation", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var started int32
+		errs := ForEach(ctx, startedPool(t, workers), items, func(ctx context.Context, item int) error {
+			// все воркеры заняты, пока ctx не отменят
+			if atomic.AddInt32(&started, 1) == workers {
+				cancel()
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		var canceled, notStarted int
+		for i, err := range errs {
+			switch {
+			case errors.Is(err, context.Canceled):
+				canceled++
+			case errors.Is(err, ErrNotStarted):
+				notStarted++
+				if i < workers {
+					t.Errorf("item %d was started before cancel, got %v", i, err)
+				}
+			default:
+				t.Errorf("item %d: unexpected %v", i, err)
+			}
+		}
+		if canceled != int(started) || canceled+notStarted != len(items) || notStarted == 0 {
+			t.Errorf("expected %d canceled and the rest not started, got %d and %d", started, canceled, notStarted)
+		}
+	})
+}
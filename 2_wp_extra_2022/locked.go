@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"log"
+	"runtime"
+	"sync/atomic"
+)
+
+var errNoLockedWorkers = errors.New("worker pool has no locked workers")
+
+// lockedWorkers - отдельные воркеры под LockOSThread, у каждого свой вход,
+// чтобы задачи с одним ключом всегда попадали на один поток
+type lockedWorkers struct {
+	inputs []chan poolTask
+	stop   chan struct{}
+	busy   int32
+	tasks  uint64
+}
+
+// LockedStats - воркеры с закрепленным потоком, в PoolStats.Workers они не входят.
+// Tasks - сколько задач они взяли
+type LockedStats struct {
+	Workers int    `json:"workers"`
+	Busy    int32  `json:"busy"`
+	Tasks   uint64 `json:"tasks"`
+}
+
+// StartLockedWorkers запускает n воркеров, каждый из которых на все время
+// жизни закрепляет свой поток ОС, например для cgo библиотек с состоянием
+// в потоке. Их немного и они не масштабируются, обычные задачи на них не
+// попадают. Вызывается один раз до SubmitLocked, останавливаются они вместе с Down.
+// n < 1 запускает одного воркера
+func (wp *WorkerPool) StartLockedWorkers(n int) {
+	if n < 1 {
+		n = 1
+	}
+	lw := &lockedWorkers{inputs: make([]chan poolTask, n), stop: make(chan struct{})}
+	for i := range lw.inputs {
+		input := make(chan poolTask)
+		lw.inputs[i] = input
+		wp.wg.Add(1)
+		go func() {
+			defer wp.wg.Done()
+			runtime.LockOSThread()
+			defer runtime.UnlockOSThread()
+			for {
+				select {
+				case <-lw.stop:
+					log.Printf("Locked worker stopped")
+					return
+				case task := <-input:
+					atomic.AddUint64(&lw.tasks, 1)
+					atomic.AddInt32(&lw.busy, 1)
+					wp.Memory.run(task)
+					atomic.AddInt32(&lw.busy, -1)
+				}
+			}
+		}()
+	}
+	wp.locked = lw
+}
+
+// SubmitLocked - Submit на воркера с закрепленным потоком. Задачи с одним key
+// выполняются одним воркером по очереди, а значит и на одном потоке
+func (wp *WorkerPool) SubmitLocked(ctx context.Context, key, name string, task func()) error {
+	lw := wp.locked
+	if lw == nil {
+		return errNoLockedWorkers
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	select {
+	case lw.inputs[h.Sum32()%uint32(len(lw.inputs))] <- poolTask{name: name, fn: task}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (lw *lockedWorkers) stats() *LockedStats {
+	if lw == nil {
+		return nil
+	}
+	return &LockedStats{
+		Workers: len(lw.inputs),
+		Busy:    atomic.LoadInt32(&lw.busy),
+		Tasks:   atomic.LoadUint64(&lw.tasks),
+	}
+}
+
+func (lw *lockedWorkers) close() {
+	if lw != nil {
+		close(lw.stop)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// goroutineID - номер горутины из runtime.Stack: воркер под LockOSThread
+// не меняет поток, так что одна горутина значит и один поток
+func goroutineID() string {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	return string(bytes.Fields(buf)[1])
+}
+
+func TestLockedWorkers(t *testing.T) {
+	wp := NewWorkerPool(4)
+	for i := 0; i < 4; i++ {
+		wp.StartWorker()
+	}
+	if err := wp.SubmitLocked(context.Background(), "a", "cgo", func() {}); err != errNoLockedWorkers {
+		t.Errorf("expected errNoLockedWorkers before StartLockedWorkers, got %v", err)
+	}
+	wp.StartLockedWorkers(2)
+	defer wp.Down()
+
+	// задачи одного ключа по очереди попадают на одну горутину
+	seen := make(map[string]map[string]bool)
+	for i := 0; i < 5; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			key := key
+			done := make(chan struct{})
+			err := wp.SubmitLocked(context.Background(), key, "cgo", func() {
+				defer close(done)
+				if seen[key] == nil {
+					seen[key] = make(map[string]bool)
+				}
+				seen[key][goroutineID()] = true
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			<-done
+		}
+	}
+	for key, ids := range seen {
+		if len(ids) != 1 {
+			t.Errorf("key %s ran on %d goroutines", key, len(ids))
+		}
+	}
+
+	// вперемешку под нагрузкой
+	const n = 200
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ran := map[string]int{}
+	for i := 0; i < n; i++ {
+		kind := "plain"
+		if i%2 == 0 {
+			kind = "locked"
+		}
+		task := func() {
+			defer wg.Done()
+			mu.Lock()
+			ran[kind]++
+			mu.Unlock()
+		}
+		wg.Add(1)
+		go func(i int) {
+			var err error
+			if kind == "locked" {
+				err = wp.SubmitLocked(context.Background(), fmt.Sprint(i%7), "cgo", task)
+			} else {
+				err = wp.Submit(context.Background(), task)
+			}
+			if err != nil {
+				t.Error(err)
+				wg.Done()
+			}
+		}(i)
+	}
+	wg.Wait()
+	if ran["locked"] != n/2 || ran["plain"] != n/2 {
+		t.Errorf("expected %d tasks of each kind, got %v", n/2, ran)
+	}
+	stats := wp.Stats()
+	if stats.Workers != 4 || stats.Locked == nil || stats.Locked.Workers != 2 || stats.Locked.Tasks != 15+n/2 {
+		t.Errorf("expected locked workers reported separately, got %+v %+v", stats, stats.Locked)
+	}
+}
+
+// без воркеров SubmitLocked делил хэш ключа на ноль
+func TestLockedWorkersZero(t *testing.T) {
+	wp := NewWorkerPool(1)
+	wp.StartLockedWorkers(0)
+	defer wp.Down()
+
+	done := make(chan struct{})
+	if err := wp.SubmitLocked(context.Background(), "a", "cgo", func() { close(done) }); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if workers := wp.Stats().Locked.Workers; workers != 1 {
+		t.Errorf("expected 1 locked worker, got %d", workers)
+	}
+}
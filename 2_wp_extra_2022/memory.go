@@ -0,0 +1,125 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+const defaultTopK = 10
+
+// MemoryAccounting включает выборочный учет памяти по задачам: у доли
+// SampleRate задач до и после запуска снимается runtime.MemStats, и разница
+// TotalAlloc записывается на имя задачи.
+//
+// Цифры шумные и годятся только для поиска самых прожорливых:
+//   - MemStats общий на процесс, в дельту попадает все, что за это время
+//     выделили другие воркеры и сам рантайм, поэтому смотреть надо на среднее
+//     по многим замерам, а не на один;
+//   - TotalAlloc считает выделенное, а не удержанное: задача, которая
+//     много раз берет и отпускает маленький буфер, выглядит так же, как
+//     задача с одним большим;
+//   - ReadMemStats останавливает мир, поэтому SampleRate лучше держать маленьким
+type MemoryAccounting struct {
+	// SampleRate - доля замеряемых задач от 0 до 1
+	SampleRate float64
+	// TopK - сколько худших задач держать в Stats, по умолчанию 10
+	TopK int
+
+	mu    sync.Mutex
+	tasks map[string]*taskMemory
+}
+
+type taskMemory struct {
+	samples    int
+	allocTotal uint64
+	allocMax   uint64
+	timeTotal  time.Duration
+}
+
+// TaskMemory - усредненный замер по одному имени задачи
+type TaskMemory struct {
+	Name          string        `json:"name"`
+	Samples       int           `json:"samples"`
+	AvgAllocBytes uint64        `json:"avg_alloc_bytes"`
+	MaxAllocBytes uint64        `json:"max_alloc_bytes"`
+	AvgDuration   time.Duration `json:"avg_duration"`
+}
+
+// taskName - имя функции задачи, у замыканий это имя с .funcN
+func taskName(fn func()) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
+
+// run выполняет задачу и, если она попала в выборку, записывает замер
+func (ma *MemoryAccounting) run(task poolTask) {
+	if ma == nil || rand.Float64() >= ma.SampleRate {
+		task.fn()
+		return
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	task.fn()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	ma.record(task.name, after.TotalAlloc-before.TotalAlloc, elapsed)
+}
+
+func (ma *MemoryAccounting) record(name string, alloc uint64, elapsed time.Duration) {
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	if ma.tasks == nil {
+		ma.tasks = make(map[string]*taskMemory)
+	}
+	tm, ok := ma.tasks[name]
+	if !ok {
+		tm = &taskMemory{}
+		ma.tasks[name] = tm
+	}
+	tm.samples++
+	tm.allocTotal += alloc
+	tm.timeTotal += elapsed
+	if alloc > tm.allocMax {
+		tm.allocMax = alloc
+	}
+}
+
+// offenders - TopK задач по среднему выделению
+func (ma *MemoryAccounting) offenders() []TaskMemory {
+	if ma == nil {
+		return nil
+	}
+	ma.mu.Lock()
+	defer ma.mu.Unlock()
+	list := make([]TaskMemory, 0, len(ma.tasks))
+	for name, tm := range ma.tasks {
+		list = append(list, TaskMemory{
+			Name:          name,
+			Samples:       tm.samples,
+			AvgAllocBytes: tm.allocTotal / uint64(tm.samples),
+			MaxAllocBytes: tm.allocMax,
+			AvgDuration:   tm.timeTotal / time.Duration(tm.samples),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].AvgAllocBytes != list[j].AvgAllocBytes {
+			return list[i].AvgAllocBytes > list[j].AvgAllocBytes
+		}
+		return list[i].Name < list[j].Name
+	})
+	topK := ma.TopK
+	if topK <= 0 {
+		topK = defaultTopK
+	}
+	if len(list) > topK {
+		list = list[:topK]
+	}
+	return list
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestMemoryAccounting(t *testing.T) {
+	const bigSize = 8 << 20
+	wp := NewWorkerPool(2)
+	wp.Memory = &MemoryAccounting{SampleRate: 1, TopK: 2}
+	wp.StartWorker()
+	wp.StartWorker()
+	defer wp.Down()
+
+	tasks := map[string]func(){
+		"big": func() {
+			// своя переменная у каждого запуска, воркеров два
+			buf := make([]byte, bigSize)
+			runtime.KeepAlive(buf)
+		},
+		"tiny": func() {
+			_ = make([]byte, 16)
+		},
+		"idle": func() {},
+	}
+	// большие задачи - редкость, иначе любой замер соседей их зацепит
+	for i := 0; i < 200; i++ {
+		name := "tiny"
+		switch {
+		case i%20 == 0:
+			name = "big"
+		case i%2 == 0:
+			name = "idle"
+		}
+		if err := wp.SubmitNamed(context.Background(), name, tasks[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// задачи без очереди: после еще двух Submit все прежние уже завершены
+	for i := 0; i < 2; i++ {
+		block := make(chan struct{})
+		wp.Submit(context.Background(), func() { <-block })
+		defer close(block)
+	}
+
+	stats := wp.Stats()
+	if stats.Workers != 2 || len(stats.Offenders) != 2 {
+		t.Fatalf("expected 2 workers and top 2 offenders, got %+v", stats)
+	}
+	top := stats.Offenders[0]
+	if top.Name != "big" || top.Samples != 10 || top.AvgAllocBytes < bigSize {
+		t.Errorf("expected big on top with 10 samples of at least %d bytes, got %+v", bigSize, top)
+	}
+	if second := stats.Offenders[1]; second.AvgAllocBytes >= top.AvgAllocBytes/2 {
+		t.Errorf("expected small tasks far below the big one, got %+v", stats.Offenders)
+	}
+
+	rec := httptest.NewRecorder()
+	wp.DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/pool", nil))
+	var decoded PoolStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Offenders) != 2 || decoded.Offenders[0].Name != "big" {
+		t.Errorf("unexpected debug output %s", rec.Body)
+	}
+}
+
+func namedTask() {}
+
+func TestTaskName(t *testing.T) {
+	if name := taskName(namedTask); !strings.HasSuffix(name, ".namedTask") {
+		t.Errorf("unexpected task name %q", name)
+	}
+}
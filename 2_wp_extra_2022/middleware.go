@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMinRetryAfter = time.Second
+	defaultMaxRetryAfter = time.Minute
+)
+
+// ShedOpts - настройки PoolMiddleware
+type ShedOpts struct {
+	// Timeout - сколько запрос ждет воркера, поверх дедлайна самого запроса.
+	// 0 - только дедлайн запроса
+	Timeout time.Duration
+	// MinRetryAfter и MaxRetryAfter ограничивают Retry-After, по умолчанию 1 с и 1 мин
+	MinRetryAfter time.Duration
+	MaxRetryAfter time.Duration
+	// Name - имя задач для учета памяти, по умолчанию "http"
+	Name string
+	// Submitter - на кого из Budgets записывать запрос, по умолчанию на хост клиента
+	Submitter func(r *http.Request) string
+}
+
+// clientHost - хост из RemoteAddr, Submitter по умолчанию
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// retryAfter - EstimatedWait в целых секундах вверх, в пределах opts
+func (opts ShedOpts) retryAfter(wait time.Duration) int {
+	min, max := opts.MinRetryAfter, opts.MaxRetryAfter
+	if min <= 0 {
+		min = defaultMinRetryAfter
+	}
+	if max <= 0 {
+		max = defaultMaxRetryAfter
+	}
+	if wait < min {
+		wait = min
+	}
+	if wait > max {
+		wait = max
+	}
+	return int(math.Ceil(wait.Seconds()))
+}
+
+// PoolMiddleware выполняет обработчик на воркере пула через SubmitAndWaitAs,
+// чтобы к http запросам применялись те же очередь, бюджеты и отказы, что и к задачам.
+// Отказ пула - полная очередь, истекшее ожидание воркера или остановка - это
+// 503 с Retry-After по текущей оценке ожидания, исчерпанный бюджет клиента -
+// 429 с Retry-After до освобождения бюджета. Такие запросы считает PoolStats.Shed.
+// Если клиент ушел сам, ответа нет
+func PoolMiddleware(pool *WorkerPool, opts ShedOpts) func(http.Handler) http.Handler {
+	name := opts.Name
+	if name == "" {
+		name = "http"
+	}
+	submitterOf := opts.Submitter
+	if submitterOf == nil {
+		submitterOf = clientHost
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if opts.Timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+				defer cancel()
+			}
+			submitter := submitterOf(r)
+			err := pool.SubmitAndWaitAs(ctx, submitter, name, func() {
+				next.ServeHTTP(w, r)
+			})
+			if err == nil || errors.Is(r.Context().Err(), context.Canceled) {
+				return
+			}
+			atomic.AddUint64(&pool.shed, 1)
+			status, wait := http.StatusServiceUnavailable, pool.EstimatedWait()
+			if errors.Is(err, ErrBudgetExhausted) {
+				status, wait = http.StatusTooManyRequests, pool.Budgets.retryIn(submitter)
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(opts.retryAfter(wait)))
+			http.Error(w, err.Error(), status)
+		})
+	}
+}
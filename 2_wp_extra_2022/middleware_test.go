@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolMiddleware(t *testing.T) {
+	wp := NewWorkerPool(1)
+	wp.Queue = NewAdaptiveQueue(1, 1, time.Hour)
+	wp.Queue.OnEvent = func(QueueEvent) {}
+	wp.StartWorker()
+
+	release := make(chan struct{})
+	handler := PoolMiddleware(wp, ShedOpts{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+		w.Write([]byte("ok"))
+	}))
+	serve := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	// первый запрос занимает единственного воркера, второй - место в очереди
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = serve("/slow").Code
+		}(i)
+		for atomic.LoadInt32(&wp.busy) == 0 || (i == 1 && len(wp.Queue.ch()) == 0) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	rec := serve("/")
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 503 with Retry-After: 1 on a saturated pool, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if stats := wp.Stats(); stats.Shed != 1 || stats.Queue.Rejected != 1 {
+		t.Errorf("expected one shed request, got %+v", stats)
+	}
+
+	close(release)
+	wg.Wait()
+	if codes[0] != http.StatusOK || codes[1] != http.StatusOK {
+		t.Errorf("expected the accepted requests to finish with 200, got %v", codes)
+	}
+	if rec := serve("/"); rec.Code != http.StatusOK || rec.Body.String() != "ok" {
+		t.Errorf("expected 200 once capacity frees, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	wp.Down()
+	if rec := serve("/"); rec.Code != http.StatusServiceUnavailable || wp.Stats().Shed != 2 {
+		t.Errorf("expected 503 after Down, got %d", rec.Code)
+	}
+}
+
+func TestPoolMiddlewareTimeout(t *testing.T) {
+	wp := NewWorkerPool(1)
+	wp.StartWorker()
+	defer wp.Down()
+
+	release := make(chan struct{})
+	if err := wp.Submit(context.Background(), func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	defer close(release)
+
+	var ran int32
+	handler := PoolMiddleware(wp, ShedOpts{Timeout: 20 * time.Millisecond})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&ran, 1)
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" || atomic.LoadInt32(&ran) != 0 {
+		t.Errorf("expected 503 without running the handler when no worker frees in time, got %d", rec.Code)
+	}
+
+	opts := ShedOpts{MaxRetryAfter: 10 * time.Second}
+	for wait, expected := range map[time.Duration]int{0: 1, 2500 * time.Millisecond: 3, time.Hour: 10} {
+		if got := opts.retryAfter(wait); got != expected {
+			t.Errorf("retryAfter(%v) = %d, want %d", wait, got, expected)
+		}
+	}
+}
+
+func TestPoolMiddlewareBudget(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	wp := NewWorkerPool(1)
+	wp.Budgets = NewBudgets(time.Minute, time.Hour)
+	wp.Budgets.Clock = clock
+	wp.StartWorker()
+	defer wp.Down()
+
+	// обработчик "работает" полторы минуты, больше бюджета клиента
+	handler := PoolMiddleware(wp, ShedOpts{MaxRetryAfter: 2 * time.Hour})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		clock.Advance(90 * time.Second)
+	}))
+	serve := func(client string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = client + ":1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := serve("10.0.0.1"); rec.Code != http.StatusOK {
+		t.Fatalf("expected the first request to pass, got %d", rec.Code)
+	}
+	rec := serve("10.0.0.1")
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "3600" {
+		t.Errorf("expected 429 with Retry-After: 3600 over the budget, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serve("10.0.0.2"); rec.Code != http.StatusOK {
+		t.Errorf("expected another client to keep its own budget, got %d", rec.Code)
+	}
+	if shed := wp.Stats().Shed; shed != 1 {
+		t.Errorf("expected one shed request, got %d", shed)
+	}
+
+	clock.Advance(time.Hour)
+	if rec := serve("10.0.0.1"); rec.Code != http.StatusOK {
+		t.Errorf("expected the budget to free up after the window, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrQueueFull = errors.New("worker pool queue is full")
+
+// Clock - источник времени очереди, в тестах его подменяют
+type Clock interface {
+	Now() time.Time
+}
+
+// QueueEvent - изменение границы очереди
+type QueueEvent struct {
+	Time   time.Time `json:"time"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	Reason string    `json:"reason"`
+}
+
+// QueueStats - состояние очереди для PoolStats
+type QueueStats struct {
+	Bound    int    `json:"bound"`
+	Base     int    `json:"base"`
+	Max      int    `json:"max"`
+	Length   int    `json:"length"`
+	Rejected uint64 `json:"rejected"`
+	Grows    int    `json:"grows"`
+	Shrinks  int    `json:"shrinks"`
+	// Starvations - сколько раз сработал SLA
+	Starvations int `json:"starvations"`
+}
+
+// TaskQueue - очередь перед воркерами для Enqueue. Воркеры берут из нее
+// наравне с Submit, так что под постоянным потоком Submit задача в очереди
+// может ждать сколько угодно, за этим следит SLA.
+//
+// Очередь от NewAdaptiveQueue меняет границу: та растет вдвое, до Max, когда
+// задачи отклоняются при занятых воркерах, и вдвое убывает, до Base, если
+// очередь была почти пустой (не больше четверти границы) дольше ShrinkAfter.
+// Уже поставленные задачи граница не трогает, она ограничивает только новые
+type TaskQueue struct {
+	Base int
+	Max  int
+	// GrowAfter - сколько отказов при занятых воркерах нужно для роста, по умолчанию 1
+	GrowAfter   int
+	ShrinkAfter time.Duration
+	Clock       Clock
+	// OnEvent получает каждое изменение границы, по умолчанию пишет в лог
+	OnEvent func(QueueEvent)
+	// SLA, если задан, - сколько задача может ждать воркера, см. StarvationEvent
+	SLA time.Duration
+	// StarvationInterval - не чаще скольких раз сообщать о голодании, по умолчанию SLA
+	StarvationInterval time.Duration
+	// Promote отдает задачам сверх SLA воркеров раньше задач от Submit
+	Promote bool
+	// OnStarvation получает каждое срабатывание SLA, по умолчанию пишет в лог
+	OnStarvation func(StarvationEvent)
+
+	tasks    chan poolTask
+	rejected uint64
+
+	mu             sync.Mutex
+	bound          int
+	pressure       int
+	quietSince     time.Time
+	grows, shrinks int
+	// enqueued - время постановки задач в порядке очереди
+	enqueued       []time.Time
+	lastStarvation time.Time
+	starvations    int
+	// promoted - сколько задач из головы очереди воркеры берут вне очереди Submit
+	promoted int
+}
+
+// NewTaskQueue - очередь постоянного размера на size задач
+func NewTaskQueue(size int) *TaskQueue {
+	return NewAdaptiveQueue(size, size, 0)
+}
+
+// NewAdaptiveQueue - очередь с границей от base до max, с max <= base это
+// очередь постоянного размера base
+func NewAdaptiveQueue(base, max int, shrinkAfter time.Duration) *TaskQueue {
+	if max < base {
+		max = base
+	}
+	return &TaskQueue{
+		Base:        base,
+		Max:         max,
+		ShrinkAfter: shrinkAfter,
+		tasks:       make(chan poolTask, max),
+		bound:       base,
+	}
+}
+
+func (q *TaskQueue) now() time.Time {
+	if q.Clock == nil {
+		return time.Now()
+	}
+	return q.Clock.Now()
+}
+
+// ch - nil у пула без очереди, воркеры тогда из нее просто не читают
+func (q *TaskQueue) ch() chan poolTask {
+	if q == nil {
+		return nil
+	}
+	return q.tasks
+}
+
+// push кладет задачу, если она проходит по границе. saturated - все воркеры заняты
+func (q *TaskQueue) push(task poolTask, saturated bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.now()
+	q.observeLocked(now)
+	if len(q.tasks) < q.bound {
+		q.tasks <- task
+		q.enqueued = append(q.enqueued, now)
+		return nil
+	}
+	atomic.AddUint64(&q.rejected, 1)
+	if !saturated || q.bound >= q.Max {
+		return ErrQueueFull
+	}
+	growAfter := q.GrowAfter
+	if growAfter < 1 {
+		growAfter = 1
+	}
+	if q.pressure++; q.pressure < growAfter {
+		return ErrQueueFull
+	}
+	next := q.bound * 2
+	if next < 1 {
+		next = 1
+	}
+	if next > q.Max {
+		next = q.Max
+	}
+	q.setBoundLocked(now, next, "grow")
+	q.grows++
+	// отказ остается отказом, место появится у следующих задач
+	return ErrQueueFull
+}
+
+// observe вызывается при каждом движении очереди и по таймеру из AdjustWorkers,
+// сжимает ее после затишья и проверяет SLA
+func (q *TaskQueue) observe() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.observeLocked(q.now())
+}
+
+// taken - воркер взял задачу из головы очереди
+func (q *TaskQueue) taken() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.popLocked()
+	q.observeLocked(q.now())
+}
+
+func (q *TaskQueue) popLocked() {
+	if len(q.enqueued) > 0 {
+		q.enqueued = q.enqueued[1:]
+	}
+}
+
+func (q *TaskQueue) observeLocked(now time.Time) {
+	q.checkStarvationLocked(now)
+	if len(q.tasks) > q.bound/4 || q.bound <= q.Base {
+		q.quietSince = time.Time{}
+		return
+	}
+	if q.quietSince.IsZero() {
+		q.quietSince = now
+		return
+	}
+	if now.Sub(q.quietSince) < q.ShrinkAfter {
+		return
+	}
+	next := q.bound / 2
+	if next < q.Base {
+		next = q.Base
+	}
+	q.setBoundLocked(now, next, "shrink")
+	q.shrinks++
+	q.quietSince = now
+}
+
+func (q *TaskQueue) setBoundLocked(now time.Time, bound int, reason string) {
+	event := QueueEvent{Time: now, From: q.bound, To: bound, Reason: reason}
+	q.bound = bound
+	q.pressure = 0
+	if q.OnEvent != nil {
+		q.OnEvent(event)
+	} else {
+		log.Printf("Queue %s: %d -> %d\n", reason, event.From, event.To)
+	}
+}
+
+func (q *TaskQueue) stats() *QueueStats {
+	if q == nil {
+		return nil
+	}
+	q.observe()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return &QueueStats{
+		Bound:       q.bound,
+		Base:        q.Base,
+		Max:         q.Max,
+		Length:      len(q.tasks),
+		Rejected:    atomic.LoadUint64(&q.rejected),
+		Grows:       q.grows,
+		Shrinks:     q.shrinks,
+		Starvations: q.starvations,
+	}
+}
+
+var errNoQueue = errors.New("worker pool has no queue")
+
+// Enqueue ставит задачу в WorkerPool.Queue и сразу возвращается, при
+// заполненной очереди - с ErrQueueFull
+func (wp *WorkerPool) Enqueue(name string, task func()) error {
+	if wp.Queue == nil {
+		return errNoQueue
+	}
+	saturated := atomic.LoadInt32(&wp.busy) >= atomic.LoadInt32(&wp.workersCounter)
+	return wp.Queue.push(poolTask{name: name, fn: task}, saturated)
+}
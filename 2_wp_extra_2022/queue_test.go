@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (fc *fakeClock) Now() time.Time {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.now
+}
+
+func (fc *fakeClock) Advance(d time.Duration) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.now = fc.now.Add(d)
+}
+
+func TestEnqueue(t *testing.T) {
+	wp := NewWorkerPool(1)
+	if err := wp.Enqueue("none", func() {}); err != errNoQueue {
+		t.Errorf("expected errNoQueue without Queue, got %v", err)
+	}
+	wp.Queue = NewTaskQueue(2)
+	wp.StartWorker()
+	defer wp.Down()
+
+	release := make(chan struct{})
+	if err := wp.Submit(context.Background(), func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadInt32(&wp.busy) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var done sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		done.Add(1)
+		if err := wp.Enqueue("task", done.Done); err != nil {
+			done.Done()
+			if i < 2 || err != ErrQueueFull {
+				t.Errorf("task %d: unexpected %v", i, err)
+			}
+		}
+	}
+	if stats := wp.Stats().Queue; stats.Bound != 2 || stats.Length != 2 || stats.Rejected != 1 {
+		t.Errorf("expected a full queue with one rejection, got %+v", stats)
+	}
+	close(release)
+	done.Wait()
+}
+
+func TestAdaptiveQueue(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	var events []QueueEvent
+	wp := NewWorkerPool(1)
+	wp.Queue = NewAdaptiveQueue(2, 8, time.Minute)
+	wp.Queue.Clock = clock
+	wp.Queue.OnEvent = func(e QueueEvent) { events = append(events, e) }
+	wp.StartWorker()
+	defer wp.Down()
+
+	// единственный воркер занят, пока не откроем release
+	release := make(chan struct{})
+	if err := wp.Submit(context.Background(), func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadInt32(&wp.busy) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var done sync.WaitGroup
+	task := func() { done.Done() }
+	accepted := 0
+	for i := 0; i < 50; i++ {
+		done.Add(1)
+		if err := wp.Enqueue("burst", task); err != nil {
+			done.Done()
+			if err != ErrQueueFull {
+				t.Fatal(err)
+			}
+			continue
+		}
+		accepted++
+		if stats := wp.Stats().Queue; stats.Length > stats.Max || stats.Bound > 8 {
+			t.Fatalf("hard max exceeded: %+v", stats)
+		}
+	}
+	stats := wp.Stats().Queue
+	if stats.Bound != 8 || stats.Length != 8 || accepted != 8 || stats.Grows != 2 {
+		t.Errorf("expected the queue to grow to 8 under the burst, got %+v with %d accepted", stats, accepted)
+	}
+	if stats.Rejected != 42 {
+		t.Errorf("expected 42 rejections, got %d", stats.Rejected)
+	}
+
+	// очередь полная, сжатие ее не трогает, сколько бы времени ни прошло
+	clock.Advance(time.Hour)
+	if stats := wp.Stats().Queue; stats.Bound != 8 || stats.Length != 8 {
+		t.Errorf("a full queue must not shrink, got %+v", stats)
+	}
+
+	close(release)
+	done.Wait()
+	// затишье отсчитывается с первого замера пустой очереди
+	wp.Stats()
+	clock.Advance(59 * time.Second)
+	if stats := wp.Stats().Queue; stats.Bound != 8 {
+		t.Errorf("shrunk before ShrinkAfter: %+v", stats)
+	}
+	clock.Advance(time.Second)
+	if stats := wp.Stats().Queue; stats.Bound != 4 {
+		t.Errorf("expected the first shrink to 4, got %+v", stats)
+	}
+	clock.Advance(time.Minute)
+	clock.Advance(time.Minute)
+	if stats := wp.Stats().Queue; stats.Bound != 2 || stats.Shrinks != 2 {
+		t.Errorf("expected decay back to base, got %+v", stats)
+	}
+
+	expected := []string{"grow 2->4", "grow 4->8", "shrink 8->4", "shrink 4->2"}
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %v, got %+v", expected, events)
+	}
+	for i, e := range events {
+		if got := fmt.Sprintf("%s %d->%d", e.Reason, e.From, e.To); got != expected[i] {
+			t.Errorf("event %d: expected %s, got %s", i, expected[i], got)
+		}
+	}
+}
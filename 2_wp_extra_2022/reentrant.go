@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+var ErrPoolClosed = errors.New("worker pool is shutting down")
+
+const defaultChildHeadroom = 4
+
+// workerKey - метка в ctx задачи от Go: по ней видно, что Go зовут изнутри задачи пула
+type workerKey struct{}
+
+// Go запускает task на воркере и передает ей ctx с меткой пула. Задача может
+// сама вызывать Go с этим ctx, и такие вложенные задачи не ждут воркера, как
+// Submit, иначе родители, ждущие детей, заняли бы всех воркеров навсегда:
+//   - свободный воркер берет ребенка сразу;
+//   - иначе ребенок получает свою горутину из резерва на ChildHeadroom задач
+//     сверх воркеров;
+//   - если и резерв занят, ребенок выполняется тут же в горутине родителя.
+//
+// После Drain новые задачи получают ErrPoolClosed, а вложенные принимаются,
+// пока не доработают все начатые
+func (wp *WorkerPool) Go(ctx context.Context, name string, task func(ctx context.Context)) error {
+	child := ctx.Value(workerKey{}) == wp
+	if !wp.begin(child) {
+		return ErrPoolClosed
+	}
+	taskCtx := context.WithValue(ctx, workerKey{}, wp)
+	pt := poolTask{name: name, fn: func() {
+		defer wp.end()
+		task(taskCtx)
+	}}
+	if !child {
+		err := wp.submit(ctx, pt)
+		if err != nil {
+			wp.end()
+		}
+		return err
+	}
+	select {
+	case wp.tasks <- pt:
+		return nil
+	default:
+	}
+	headroom := wp.ChildHeadroom
+	if headroom <= 0 {
+		headroom = defaultChildHeadroom
+	}
+	if atomic.AddInt32(&wp.extra, 1) <= headroom {
+		go func() {
+			defer atomic.AddInt32(&wp.extra, -1)
+			wp.runTask(pt)
+		}()
+		return nil
+	}
+	atomic.AddInt32(&wp.extra, -1)
+	wp.runTask(pt)
+	return nil
+}
+
+// begin считает задачу от Go, после Drain - только вложенную
+func (wp *WorkerPool) begin(child bool) bool {
+	wp.inflightMu.Lock()
+	defer wp.inflightMu.Unlock()
+	if !child && atomic.LoadInt32(&wp.closed) != 0 {
+		return false
+	}
+	wp.inflight++
+	return true
+}
+
+func (wp *WorkerPool) end() {
+	wp.inflightMu.Lock()
+	defer wp.inflightMu.Unlock()
+	if wp.inflight--; wp.inflight == 0 {
+		wp.inflightDone.Broadcast()
+	}
+}
+
+// Drain - мягкая остановка: новые задачи от Go больше не принимаются, начатые
+// дорабатывают вместе со всеми вложенными, и только потом пул делает Down.
+// Задачи от Submit и Enqueue Drain не ждет
+func (wp *WorkerPool) Drain() {
+	wp.inflightMu.Lock()
+	atomic.StoreInt32(&wp.closed, 1)
+	for wp.inflight > 0 {
+		wp.inflightDone.Wait()
+	}
+	wp.inflightMu.Unlock()
+	wp.Down()
+}
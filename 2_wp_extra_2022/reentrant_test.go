@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoReentrant(t *testing.T) {
+	const roots, fanOut, depth = 4, 3, 3
+	wp := NewWorkerPool(2)
+	wp.ChildHeadroom = 1
+	wp.StartWorker()
+	wp.StartWorker()
+
+	// каждый родитель ждет своих детей, как ждал бы результатов: с Submit
+	// два воркера-родителя встали бы навсегда уже на первом уровне
+	var leaves uint32
+	var spawn func(ctx context.Context, level int)
+	spawn = func(ctx context.Context, level int) {
+		if level == depth {
+			atomic.AddUint32(&leaves, 1)
+			time.Sleep(time.Millisecond)
+			return
+		}
+		var wg sync.WaitGroup
+		for i := 0; i < fanOut; i++ {
+			wg.Add(1)
+			err := wp.Go(ctx, "child", func(ctx context.Context) {
+				defer wg.Done()
+				spawn(ctx, level+1)
+			})
+			if err != nil {
+				t.Errorf("child rejected at level %d: %v", level+1, err)
+				wg.Done()
+			}
+		}
+		wg.Wait()
+	}
+	for i := 0; i < roots; i++ {
+		if err := wp.Go(context.Background(), "root", func(ctx context.Context) { spawn(ctx, 0) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Drain начинается, пока деревья еще растут, и ждет их целиком
+	drained := make(chan struct{})
+	go func() {
+		wp.Drain()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("deadlock: %d of %d leaves done", atomic.LoadUint32(&leaves), roots*27)
+	}
+	if n := atomic.LoadUint32(&leaves); n != roots*27 {
+		t.Errorf("expected %d leaves, got %d", roots*27, n)
+	}
+	if err := wp.Go(context.Background(), "late", func(context.Context) {}); err != ErrPoolClosed {
+		t.Errorf("expected ErrPoolClosed after Drain, got %v", err)
+	}
+}
+
+// Drain с отложенным Down закрывал workerChan второй раз
+func TestDrainThenDown(t *testing.T) {
+	wp := NewWorkerPool(2)
+	wp.StartWorker()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("repeated shutdown panicked: %v", r)
+		}
+	}()
+	defer wp.Down()
+	wp.Drain()
+	wp.Down()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+type ScaleDecision string
+
+const (
+	ScaleUp   ScaleDecision = "up"
+	ScaleDown ScaleDecision = "down"
+	ScaleKeep ScaleDecision = "keep"
+)
+
+// ScalePolicy - когда добавлять и убирать воркера: выше High добавляем,
+// ниже Low убираем, между ними - целевая полоса, ничего не трогаем
+type ScalePolicy struct {
+	Low        float64
+	High       float64
+	MinWorkers int32
+	MaxWorkers int32
+}
+
+func (sp ScalePolicy) Decide(metric float64, workers int32) ScaleDecision {
+	switch {
+	case metric > sp.High && workers < sp.MaxWorkers:
+		return ScaleUp
+	case metric < sp.Low && workers > sp.MinWorkers:
+		return ScaleDown
+	default:
+		return ScaleKeep
+	}
+}
+
+func (sp ScalePolicy) inBand(metric float64) bool {
+	return metric >= sp.Low && metric <= sp.High
+}
+
+// ScaleEvent - одна строка трейса: замер, решение и сколько воркеров было до него
+type ScaleEvent struct {
+	Time     time.Time     `json:"time"`
+	Metric   float64       `json:"metric"`
+	Decision ScaleDecision `json:"decision"`
+	Workers  int32         `json:"workers"`
+}
+
+type ReplayPoint struct {
+	Time    time.Time
+	Workers int32
+}
+
+// ReplayResult - как вел бы себя пул с другой политикой на записанной нагрузке
+type ReplayResult struct {
+	Timeline    []ReplayPoint
+	ScaleEvents int
+	OutsideBand time.Duration
+}
+
+// ReplayPolicy прогоняет политику по трейсу от записи в WorkerPool.Trace.
+// Время берется из трейса, так что живой пул и реальные часы не нужны.
+// Начинаем с числа воркеров из первой строки, замер действует до следующего
+func ReplayPolicy(trace io.Reader, policy ScalePolicy) (ReplayResult, error) {
+	var events []ScaleEvent
+	decoder := json.NewDecoder(trace)
+	for decoder.More() {
+		var event ScaleEvent
+		if err := decoder.Decode(&event); err != nil {
+			return ReplayResult{}, err
+		}
+		events = append(events, event)
+	}
+
+	var result ReplayResult
+	if len(events) == 0 {
+		return result, nil
+	}
+	workers := events[0].Workers
+	for i, event := range events {
+		switch policy.Decide(event.Metric, workers) {
+		case ScaleUp:
+			workers++
+			result.ScaleEvents++
+		case ScaleDown:
+			workers--
+			result.ScaleEvents++
+		}
+		result.Timeline = append(result.Timeline, ReplayPoint{Time: event.Time, Workers: workers})
+		if i+1 < len(events) && !policy.inBand(event.Metric) {
+			result.OutsideBand += events[i+1].Time.Sub(event.Time)
+		}
+	}
+	return result, nil
+}
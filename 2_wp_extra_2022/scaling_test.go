@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReplayPolicy(t *testing.T) {
+	var trace bytes.Buffer
+	wp := NewWorkerPool(10)
+	wp.Trace = &trace
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, metric := range []float64{1, 5, 5, 5, 1, 1, 3, 0} {
+		wp.record(ScaleEvent{Time: start.Add(time.Duration(i) * time.Second), Metric: metric, Decision: ScaleKeep, Workers: 1})
+	}
+
+	cases := []struct {
+		name        string
+		policy      ScalePolicy
+		workers     []int32
+		events      int
+		outsideBand time.Duration
+	}{
+		{"default", wp.Policy, []int32{1, 2, 3, 4, 3, 2, 3, 2}, 7, 7 * time.Second},
+		{"wide band", ScalePolicy{Low: 0.5, High: 4, MinWorkers: 1, MaxWorkers: 3}, []int32{1, 2, 3, 3, 3, 3, 3, 2}, 3, 3 * time.Second},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ReplayPolicy(bytes.NewReader(trace.Bytes()), tc.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var workers []int32
+			for i, point := range result.Timeline {
+				if !point.Time.Equal(start.Add(time.Duration(i) * time.Second)) {
+					t.Errorf("unexpected time %v at %d", point.Time, i)
+				}
+				workers = append(workers, point.Workers)
+			}
+			if !reflect.DeepEqual(workers, tc.workers) {
+				t.Errorf("expected workers %v, got %v", tc.workers, workers)
+			}
+			if result.ScaleEvents != tc.events || result.OutsideBand != tc.outsideBand {
+				t.Errorf("expected %d events and %v outside the band, got %d and %v", tc.events, tc.outsideBand, result.ScaleEvents, result.OutsideBand)
+			}
+		})
+	}
+}
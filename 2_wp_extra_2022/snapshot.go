@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Snapshot - состояние пула на остановке, чтобы сравнить запуски после инцидента
+type Snapshot struct {
+	Time       time.Time     `json:"time"`
+	MaxWorkers int32         `json:"max_workers"`
+	Policy     ScalePolicy   `json:"policy"`
+	Tasks      int64         `json:"tasks"`
+	AvgTask    time.Duration `json:"avg_task"`
+	Stats      PoolStats     `json:"stats"`
+}
+
+// snapshotFields - что попадает в дифф, config - поля настроек для сравнения
+// при старте, когда статистики у нового запуска еще нет
+var snapshotFields = []struct {
+	name   string
+	config bool
+	value  func(s Snapshot) string
+}{
+	{"max workers", true, func(s Snapshot) string { return fmt.Sprint(s.MaxWorkers) }},
+	{"policy", true, func(s Snapshot) string {
+		p := s.Policy
+		return fmt.Sprintf("%g..%g%% %d-%d", p.Low, p.High, p.MinWorkers, p.MaxWorkers)
+	}},
+	{"workers", false, func(s Snapshot) string { return fmt.Sprint(s.Stats.Workers) }},
+	{"tasks", false, func(s Snapshot) string { return fmt.Sprint(s.Tasks) }},
+	{"avg task", false, func(s Snapshot) string { return s.AvgTask.String() }},
+	{"shed", false, func(s Snapshot) string { return fmt.Sprint(s.Stats.Shed) }},
+	{"queue bound", false, func(s Snapshot) string { return queueValue(s, func(q *QueueStats) int { return q.Bound }) }},
+	{"queue rejected", false, func(s Snapshot) string { return queueValue(s, func(q *QueueStats) int { return int(q.Rejected) }) }},
+	{"starvations", false, func(s Snapshot) string { return queueValue(s, func(q *QueueStats) int { return q.Starvations }) }},
+}
+
+func queueValue(s Snapshot, value func(q *QueueStats) int) string {
+	if s.Stats.Queue == nil {
+		return "-"
+	}
+	return fmt.Sprint(value(s.Stats.Queue))
+}
+
+// DiffSnapshots - изменившиеся поля через запятую, например
+// "max workers 10→20, avg task 40ms→900ms", пустая строка без изменений
+func DiffSnapshots(prev, cur Snapshot) string {
+	return diffSnapshots(prev, cur, false)
+}
+
+func diffSnapshots(prev, cur Snapshot, configOnly bool) string {
+	var changes []string
+	for _, f := range snapshotFields {
+		if configOnly && !f.config {
+			continue
+		}
+		if from, to := f.value(prev), f.value(cur); from != to {
+			changes = append(changes, fmt.Sprintf("%s %s→%s", f.name, from, to))
+		}
+	}
+	return strings.Join(changes, ", ")
+}
+
+func (wp *WorkerPool) snapshot() Snapshot {
+	s := Snapshot{
+		Time:       time.Now(),
+		MaxWorkers: wp.maxWorkers,
+		Policy:     wp.Policy,
+		Stats:      wp.Stats(),
+	}
+	s.Tasks, s.AvgTask = wp.taskTotals()
+	return s
+}
+
+func (wp *WorkerPool) taskTotals() (count int64, avg time.Duration) {
+	if count = atomic.LoadInt64(&wp.taskCount); count > 0 {
+		avg = time.Duration(atomic.LoadInt64(&wp.taskNanos) / count)
+	}
+	return count, avg
+}
+
+// WriteSnapshot пишет во временный файл рядом и переименовывает, так что
+// по path всегда лежит либо старый снимок, либо новый целиком
+func WriteSnapshot(path string, s Snapshot) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	enc := json.NewEncoder(tmp)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func LoadSnapshot(path string) (Snapshot, error) {
+	var s Snapshot
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return s, err
+	}
+	err = json.Unmarshal(data, &s)
+	return s, err
+}
+
+// LoadPreviousSnapshot читает снимок прошлого запуска из SnapshotPath и пишет
+// в лог, чем отличаются настройки. Ошибки только логируются
+func (wp *WorkerPool) LoadPreviousSnapshot() {
+	prev, err := LoadSnapshot(wp.SnapshotPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Snapshot: %v\n", err)
+		}
+		return
+	}
+	wp.previous = &prev
+	log.Printf("Previous run stopped at %s\n", prev.Time.Format(time.RFC3339))
+	if diff := diffSnapshots(prev, wp.snapshot(), true); diff != "" {
+		log.Printf("Config since previous run: %s\n", diff)
+	}
+}
+
+// saveSnapshot - на Down: дифф с прошлым запуском в лог и новый снимок на диск.
+// Ошибки только логируются, остановку пула они не задерживают
+func (wp *WorkerPool) saveSnapshot(s Snapshot) {
+	if wp.previous != nil {
+		if diff := DiffSnapshots(*wp.previous, s); diff != "" {
+			log.Printf("Since previous run: %s\n", diff)
+		}
+	}
+	if err := WriteSnapshot(wp.SnapshotPath, s); err != nil {
+		log.Printf("Snapshot: %v\n", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pool.json")
+	s := Snapshot{
+		Time:       time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+		MaxWorkers: 10,
+		Policy:     ScalePolicy{Low: 2, High: 2, MinWorkers: 1, MaxWorkers: 10},
+		Tasks:      100,
+		AvgTask:    40 * time.Millisecond,
+		Stats:      PoolStats{Workers: 3, Shed: 2, Queue: &QueueStats{Bound: 4, Length: 1}},
+	}
+	if err := WriteSnapshot(path, s); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("expected %+v, got %+v", s, got)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("expected only the snapshot, got %d files", len(entries))
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	prev := Snapshot{MaxWorkers: 10, Tasks: 5, AvgTask: 40 * time.Millisecond}
+	cur := prev
+	if diff := DiffSnapshots(prev, cur); diff != "" {
+		t.Errorf("expected no diff, got %q", diff)
+	}
+	cur.MaxWorkers, cur.AvgTask = 20, 900*time.Millisecond
+	if diff := DiffSnapshots(prev, cur); diff != "max workers 10→20, avg task 40ms→900ms" {
+		t.Errorf("unexpected diff %q", diff)
+	}
+	cur.Stats.Queue = &QueueStats{Bound: 4}
+	if diff := diffSnapshots(prev, cur, true); diff != "max workers 10→20" {
+		t.Errorf("config diff must skip stats, got %q", diff)
+	}
+}
+
+func TestDownSnapshot(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	path := filepath.Join(t.TempDir(), "pool.json")
+	if err := WriteSnapshot(path, Snapshot{MaxWorkers: 5}); err != nil {
+		t.Fatal(err)
+	}
+	wp := NewWorkerPool(10)
+	wp.SnapshotPath = path
+	wp.LoadPreviousSnapshot()
+	wp.StartWorker()
+	if err := wp.Submit(context.Background(), func() {}); err != nil {
+		t.Fatal(err)
+	}
+	wp.Down()
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.MaxWorkers != 10 || s.Stats.Workers != 1 {
+		t.Errorf("unexpected snapshot %+v", s)
+	}
+	if !strings.Contains(logs.String(), "Config since previous run: max workers 5→10") {
+		t.Errorf("expected the config diff on load, got %q", logs.String())
+	}
+
+	// запись не удалась - пул все равно останавливается
+	wp = NewWorkerPool(1)
+	wp.SnapshotPath = filepath.Join(t.TempDir(), "missing", "pool.json")
+	wp.LoadPreviousSnapshot()
+	wp.StartWorker()
+	wp.Down()
+	if !strings.Contains(logs.String(), "Snapshot:") {
+		t.Errorf("expected the write error in the log, got %q", logs.String())
+	}
+}
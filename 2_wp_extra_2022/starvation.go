@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// StarvationEvent - задачи в очереди ждут воркера дольше SLA
+type StarvationEvent struct {
+	Time time.Time `json:"time"`
+	// Count - сколько задач сейчас ждут дольше SLA, OldestWait - ожидание самой старой
+	Count      int           `json:"count"`
+	OldestWait time.Duration `json:"oldest_wait"`
+}
+
+// checkStarvationLocked смотрит только на время постановки: очередь FIFO,
+// так что голова - самая старая задача, а задачи сверх SLA - ее префикс.
+// О голодании сообщается не чаще StarvationInterval
+func (q *TaskQueue) checkStarvationLocked(now time.Time) {
+	if q.SLA <= 0 || len(q.enqueued) == 0 || now.Sub(q.enqueued[0]) <= q.SLA {
+		return
+	}
+	interval := q.StarvationInterval
+	if interval <= 0 {
+		interval = q.SLA
+	}
+	if !q.lastStarvation.IsZero() && now.Sub(q.lastStarvation) < interval {
+		return
+	}
+	q.lastStarvation = now
+	q.starvations++
+	event := StarvationEvent{
+		Time: now,
+		Count: sort.Search(len(q.enqueued), func(i int) bool {
+			return now.Sub(q.enqueued[i]) <= q.SLA
+		}),
+		OldestWait: now.Sub(q.enqueued[0]),
+	}
+	if q.Promote {
+		q.promoted = event.Count
+	}
+	if q.OnStarvation != nil {
+		q.OnStarvation(event)
+	} else {
+		log.Printf("WARN queue starvation: %d tasks waited over %s, oldest %s\n", event.Count, q.SLA, event.OldestWait)
+	}
+}
+
+// promotedTask отдает воркеру задачу из головы очереди, если она повышена
+// после срабатывания SLA, чтобы ее не обгоняли задачи от Submit
+func (q *TaskQueue) promotedTask() (poolTask, bool) {
+	if q == nil {
+		return poolTask{}, false
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.promoted == 0 {
+		return poolTask{}, false
+	}
+	select {
+	case task := <-q.tasks:
+		q.promoted--
+		q.popLocked()
+		return task, true
+	default:
+		q.promoted = 0
+		return poolTask{}, false
+	}
+}
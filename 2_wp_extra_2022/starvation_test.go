@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStarvation(t *testing.T) {
+	var logs bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&logs)
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	wp := NewWorkerPool(1)
+	wp.Queue = NewTaskQueue(4)
+	wp.Queue.Clock = clock
+	wp.Queue.SLA = time.Minute
+	wp.Queue.Promote = true
+	wp.StartWorker()
+	defer wp.Down()
+
+	release := make(chan struct{})
+	if err := wp.Submit(context.Background(), func() { <-release }); err != nil {
+		t.Fatal(err)
+	}
+	for atomic.LoadInt32(&wp.busy) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var done sync.WaitGroup
+	task := func(name string) func() {
+		done.Add(1)
+		return func() {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			done.Done()
+		}
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := wp.Enqueue(name, task(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.Advance(30 * time.Second)
+	if err := wp.Enqueue("c", task("c")); err != nil {
+		t.Fatal(err)
+	}
+	if stats := wp.Stats().Queue; stats.Starvations != 0 {
+		t.Fatalf("starvation reported within the SLA: %+v", stats)
+	}
+
+	clock.Advance(45 * time.Second)
+	wp.Stats()
+	if !strings.Contains(logs.String(), "WARN queue starvation: 2 tasks waited over 1m0s, oldest 1m15s") {
+		t.Errorf("expected a starvation warning, got log %q", logs.String())
+	}
+	// не чаще раза в интервал
+	clock.Advance(30 * time.Second)
+	if stats := wp.Stats().Queue; stats.Starvations != 1 {
+		t.Errorf("expected one starvation within the interval, got %+v", stats)
+	}
+	var events []StarvationEvent
+	wp.Queue.mu.Lock()
+	wp.Queue.OnStarvation = func(e StarvationEvent) { events = append(events, e) }
+	wp.Queue.mu.Unlock()
+	clock.Advance(30 * time.Second)
+	if stats := wp.Stats().Queue; stats.Starvations != 2 {
+		t.Errorf("expected the second starvation after the interval, got %+v", stats)
+	}
+	if len(events) != 1 || events[0].Count != 3 || events[0].OldestWait != 135*time.Second {
+		t.Errorf("expected all 3 tasks over the SLA, got %+v", events)
+	}
+
+	// задача от Submit ждет того же воркера, но повышенные идут раньше
+	submitted := make(chan error)
+	go func() {
+		submitted <- wp.Submit(context.Background(), task("submit"))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	if err := <-submitted; err != nil {
+		t.Fatal(err)
+	}
+	done.Wait()
+	if got := strings.Join(order, ","); got != "a,b,c,submit" {
+		t.Errorf("expected promoted tasks before submit, got %s", got)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+)
+
+// PoolStats - текущее состояние пула для Stats и DebugHandler
+type PoolStats struct {
+	Workers int32 `json:"workers"`
+	// Offenders - задачи с самым большим средним выделением памяти, по убыванию
+	Offenders []TaskMemory `json:"offenders,omitempty"`
+	Queue     *QueueStats  `json:"queue,omitempty"`
+	// Shed - запросы, которые PoolMiddleware отклонил с 503 или 429
+	Shed uint64 `json:"shed"`
+	// Budgets - потраченное за окно отправителями с ненулевым расходом
+	Budgets []BudgetUsage `json:"budgets,omitempty"`
+	Locked  *LockedStats  `json:"locked,omitempty"`
+}
+
+func (wp *WorkerPool) Stats() PoolStats {
+	return PoolStats{
+		Workers:   atomic.LoadInt32(&wp.workersCounter),
+		Offenders: wp.Memory.offenders(),
+		Queue:     wp.Queue.stats(),
+		Shed:      atomic.LoadUint64(&wp.shed),
+		Budgets:   wp.Budgets.usage(),
+		Locked:    wp.locked.stats(),
+	}
+}
+
+// DebugHandler отдает Stats в json
+func (wp *WorkerPool) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(wp.Stats())
+	})
+}
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
@@ -16,15 +21,62 @@ const cpuPercentTrigger = 2
 type WorkerPool struct {
 	maxWorkers     int32
 	workersCounter int32
-	workerChan     chan struct{}
-	wg             sync.WaitGroup
+	busy           int32
+	closed         int32
+	shed           uint64
+	// taskNanos и taskCount - для средней длительности задачи в Snapshot и EstimatedWait
+	taskNanos  int64
+	taskCount  int64
+	workerChan chan struct{}
+	tasks      chan poolTask
+	wg         sync.WaitGroup
+	// Policy решает по загрузке CPU, добавить или убрать воркера
+	Policy ScalePolicy
+	// Trace - сюда пишется каждое решение в jsonl для ReplayPolicy
+	Trace io.Writer
+	// Memory, если задан, выборочно замеряет память задач, см. MemoryAccounting
+	Memory *MemoryAccounting
+	// Queue, если задана до StartWorker, принимает задачи от Enqueue
+	Queue *TaskQueue
+	// Budgets, если заданы, ограничивают время задач от SubmitAs по отправителям
+	Budgets *Budgets
+	// ChildHeadroom - сколько вложенных задач от Go может работать сверх
+	// воркеров, по умолчанию 4
+	ChildHeadroom int32
+	extra         int32
+	// locked - воркеры от StartLockedWorkers, nil без них
+	locked *lockedWorkers
+	// SnapshotPath, если задан, - куда Down пишет Snapshot, см. LoadPreviousSnapshot
+	SnapshotPath string
+	previous     *Snapshot
+	// inflight - задачи от Go, которые ждет Drain
+	inflightMu   sync.Mutex
+	inflight     int
+	inflightDone *sync.Cond
+	// downOnce - Down после Drain или повторный Down ничего не делают
+	downOnce sync.Once
+}
+
+// poolTask - задача с именем, под которым ее видно в статистике пула
+type poolTask struct {
+	name string
+	fn   func()
 }
 
 func NewWorkerPool(maxWorkers int32) *WorkerPool {
-	return &WorkerPool{
+	wp := &WorkerPool{
 		maxWorkers: maxWorkers,
 		workerChan: make(chan struct{}),
+		tasks:      make(chan poolTask),
+		Policy: ScalePolicy{
+			Low:        cpuPercentTrigger,
+			High:       cpuPercentTrigger,
+			MinWorkers: 1,
+			MaxWorkers: maxWorkers,
+		},
 	}
+	wp.inflightDone = sync.NewCond(&wp.inflightMu)
+	return wp
 }
 
 func (wp *WorkerPool) StartWorker() {
@@ -34,22 +86,132 @@ func (wp *WorkerPool) StartWorker() {
 		defer wp.wg.Done()
 		defer atomic.AddInt32(&wp.workersCounter, -1)
 		for {
+			if task, ok := wp.Queue.promotedTask(); ok {
+				wp.runTask(task)
+				continue
+			}
 			select {
 			case <-wp.workerChan:
 				log.Printf("Worker stopped")
 				return
+			case task := <-wp.tasks:
+				wp.runTask(task)
+			case task := <-wp.Queue.ch():
+				wp.Queue.taken()
+				wp.runTask(task)
 			}
 		}
 	}()
 }
 
+func (wp *WorkerPool) runTask(task poolTask) {
+	atomic.AddInt32(&wp.busy, 1)
+	defer atomic.AddInt32(&wp.busy, -1)
+	start := time.Now()
+	wp.Memory.run(task)
+	atomic.AddInt64(&wp.taskNanos, int64(time.Since(start)))
+	atomic.AddInt64(&wp.taskCount, 1)
+}
+
+// Submit отдает задачу первому свободному воркеру и ждет, пока ее кто-нибудь
+// возьмет. Если все заняты, ждем вместе с ctx, в Queue задача не попадает
+func (wp *WorkerPool) Submit(ctx context.Context, task func()) error {
+	return wp.SubmitNamed(ctx, taskName(task), task)
+}
+
+// SubmitNamed - Submit с именем задачи для учета памяти, у замыканий
+// автоматическое имя вроде main.handler.func1 мало о чем говорит
+func (wp *WorkerPool) SubmitNamed(ctx context.Context, name string, task func()) error {
+	return wp.submit(ctx, poolTask{name: name, fn: task})
+}
+
+func (wp *WorkerPool) submit(ctx context.Context, task poolTask) error {
+	select {
+	case wp.tasks <- task:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SubmitAndWait отдает задачу через Queue, если она задана, иначе как Submit,
+// и ждет ее завершения. ctx ограничивает только ожидание воркера: задача,
+// которую не успели взять, уже не запустится, а начатая доработает до конца,
+// поэтому ей можно отдать, например, http.ResponseWriter
+func (wp *WorkerPool) SubmitAndWait(ctx context.Context, name string, task func()) error {
+	if atomic.LoadInt32(&wp.closed) != 0 {
+		return ErrPoolClosed
+	}
+	// 0 - ждет воркера, 1 - запущена, 2 - брошена по ctx
+	var state int32
+	done := make(chan struct{})
+	wrapped := func() {
+		if !atomic.CompareAndSwapInt32(&state, 0, 1) {
+			return
+		}
+		defer close(done)
+		task()
+	}
+	var err error
+	if wp.Queue != nil {
+		err = wp.Enqueue(name, wrapped)
+	} else {
+		err = wp.SubmitNamed(ctx, name, wrapped)
+	}
+	if err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		if atomic.CompareAndSwapInt32(&state, 0, 2) {
+			return ctx.Err()
+		}
+		<-done
+		return nil
+	}
+}
+
+// EstimatedWait - сколько примерно ждать воркера новой задаче: очередь плюс
+// она сама, поделенные на воркеров, по средней длительности задачи
+func (wp *WorkerPool) EstimatedWait() time.Duration {
+	count := atomic.LoadInt64(&wp.taskCount)
+	workers := atomic.LoadInt32(&wp.workersCounter)
+	if count == 0 || workers <= 0 {
+		return 0
+	}
+	avg := time.Duration(atomic.LoadInt64(&wp.taskNanos) / count)
+	queued := 0
+	if wp.Queue != nil {
+		queued = len(wp.Queue.ch())
+	}
+	return avg * time.Duration(queued+1) / time.Duration(workers)
+}
+
 func (wp *WorkerPool) StopWorker() {
 	wp.workerChan <- struct{}{}
 }
 
 func (wp *WorkerPool) Down() {
+	wp.downOnce.Do(wp.down)
+}
+
+func (wp *WorkerPool) down() {
+	atomic.StoreInt32(&wp.closed, 1)
+	// воркеров снимаем до остановки, пока они еще в счетчике
+	var snapshot Snapshot
+	if wp.SnapshotPath != "" {
+		snapshot = wp.snapshot()
+	}
 	close(wp.workerChan)
+	wp.locked.close()
 	wp.wg.Wait()
+	if wp.SnapshotPath != "" {
+		// задачи, которые воркеры доделали на остановке, тоже считаются
+		snapshot.Tasks, snapshot.AvgTask = wp.taskTotals()
+		wp.saveSnapshot(snapshot)
+	}
 }
 
 func (wp *WorkerPool) AdjustWorkers() {
@@ -58,14 +220,22 @@ func (wp *WorkerPool) AdjustWorkers() {
 	for {
 		select {
 		case <-ticker.C:
+			if wp.Queue != nil {
+				// SLA проверяется и тогда, когда очередь стоит
+				wp.Queue.observe()
+			}
 			log.Printf("Current workers count: %d\n", atomic.LoadInt32(&wp.workersCounter))
 			percent, _ := cpu.Percent(time.Second, false)
 			currentLoad := percent[0]
 			log.Printf("Current CPU load: %.2f%%\n", currentLoad)
-			if currentLoad > cpuPercentTrigger && wp.maxWorkers > atomic.LoadInt32(&wp.workersCounter) {
+			workers := atomic.LoadInt32(&wp.workersCounter)
+			decision := wp.Policy.Decide(currentLoad, workers)
+			wp.record(ScaleEvent{Time: time.Now(), Metric: currentLoad, Decision: decision, Workers: workers})
+			switch decision {
+			case ScaleUp:
 				log.Println("Add worker")
 				wp.StartWorker()
-			} else if currentLoad < cpuPercentTrigger && int(atomic.LoadInt32(&wp.workersCounter)) > 1 {
+			case ScaleDown:
 				log.Println("Remove worker")
 				wp.StopWorker()
 			}
@@ -73,8 +243,43 @@ func (wp *WorkerPool) AdjustWorkers() {
 	}
 }
 
+func (wp *WorkerPool) record(event ScaleEvent) {
+	if wp.Trace == nil {
+		return
+	}
+	if err := json.NewEncoder(wp.Trace).Encode(event); err != nil {
+		log.Printf("Trace: %v\n", err)
+	}
+}
+
 func main() {
+	tracePath := flag.String("trace", "", "append every scaling decision to this jsonl file")
+	debugAddr := flag.String("debug", "", "serve pool stats as json on this address, e.g. :6060")
+	memorySample := flag.Float64("memory-sample", 0, "fraction of tasks to measure heap allocations for, 0 to disable")
+	snapshotPath := flag.String("snapshot", "", "write pool stats to this json file on shutdown and compare with the previous run")
+	flag.Parse()
+
 	wp := NewWorkerPool(10)
+	if *tracePath != "" {
+		trace, err := os.OpenFile(*tracePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer trace.Close()
+		wp.Trace = trace
+	}
+	if *memorySample > 0 {
+		wp.Memory = &MemoryAccounting{SampleRate: *memorySample}
+	}
+	if *snapshotPath != "" {
+		wp.SnapshotPath = *snapshotPath
+		wp.LoadPreviousSnapshot()
+	}
+	if *debugAddr != "" {
+		go func() {
+			log.Println(http.ListenAndServe(*debugAddr, wp.DebugHandler()))
+		}()
+	}
 	go wp.AdjustWorkers()
 
 	c := make(chan os.Signal, 1)